@@ -5,6 +5,7 @@ import (
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/statistics"
 	"github.com/gnasnik/titan-explorer/pkg/formatter"
 	"net/http"
 	"strconv"
@@ -53,3 +54,71 @@ func reverse(s []*model.FullNodeInfo) {
 		s[i], s[j] = s[j], s[i]
 	}
 }
+
+func GetStatisticRunsHandler(c *gin.Context) {
+	job := c.Query("job")
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	list, total, err := dao.ListStatisticRuns(c.Request.Context(), job, option)
+	if err != nil {
+		log.Errorf("list statistic runs: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"jobs":  statistic.JobNames(),
+		"list":  list,
+		"total": total,
+	}))
+}
+
+func TriggerStatisticJobHandler(c *gin.Context) {
+	job := c.Query("job")
+	if job == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	err := statistic.Trigger(job)
+	if err == statistics.ErrJobNotFound {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("trigger statistic job: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+func GetRewardReconciliationsHandler(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	list, total, err := dao.ListRewardReconciliations(c.Request.Context(), c.Query("username"), option)
+	if err != nil {
+		log.Errorf("list reward reconciliations: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
@@ -12,16 +12,56 @@ import (
 	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/cleanup"
 	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/mailer"
 	"github.com/gnasnik/titan-explorer/core/statistics"
-	"github.com/go-redis/redis/v9"
+	"github.com/gnasnik/titan-explorer/core/webhook"
 	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
-var schedulerAdmin api.Scheduler
+const (
+	etcdDialTimeout    = 5 * time.Second
+	etcdResyncInterval = 5 * time.Second
+)
+
+// the schedulers used by the handlers, they are replaced by the etcd watch while the handlers read them.
+var (
+	schedulerLk    sync.RWMutex
+	schedulerAdmin api.Scheduler
+	schedulerApi   api.Scheduler
+)
+
+func getSchedulerApi() api.Scheduler {
+	schedulerLk.RLock()
+	defer schedulerLk.RUnlock()
+	return schedulerApi
+}
+
+func setSchedulerApi(scheduler api.Scheduler) {
+	schedulerLk.Lock()
+	defer schedulerLk.Unlock()
+	schedulerApi = scheduler
+}
+
+func getSchedulerAdmin() api.Scheduler {
+	schedulerLk.RLock()
+	defer schedulerLk.RUnlock()
+	return schedulerAdmin
+}
 
-var schedulerApi api.Scheduler
+func setSchedulerAdmin(scheduler api.Scheduler) {
+	schedulerLk.Lock()
+	defer schedulerLk.Unlock()
+	schedulerAdmin = scheduler
+}
+
+// statistic is used by the admin handlers to list and trigger the statistic jobs.
+var statistic *statistics.Statistic
 
 //var SchedulerConfigs map[string][]*types.SchedulerCfg
 
@@ -32,18 +72,48 @@ var (
 
 type EtcdClient struct {
 	cli *etcdcli.Client
+	// watcher watches the scheduler configs from the revision loaded, which etcdcli.WatchServers can't do
+	watcher *clientv3.Client
+
+	lk sync.Mutex
+	// revision is the etcd revision the scheduler configs are loaded or watched up to
+	revision int64
 	// key is areaID, value is array of types.SchedulerCfg pointer
 	schedulerConfigs map[string][]*types.SchedulerCfg
 	// key is etcd key, value is types.SchedulerCfg pointer
 	configMap map[string]*types.SchedulerCfg
 }
 
+// SchedulerConfigHandler is notified when a scheduler config is put into or deleted from etcd.
+type SchedulerConfigHandler interface {
+	OnSchedulerPut(cfg *types.SchedulerCfg)
+	OnSchedulerDelete(cfg *types.SchedulerCfg)
+}
+
+// schedulerChange is a scheduler config put or deleted, the changes are collected under the lock and the handler
+// is notified after it's released as the handler dials the schedulers.
+type schedulerChange struct {
+	cfg     *types.SchedulerCfg
+	deleted bool
+}
+
+func notifySchedulerChanges(handler SchedulerConfigHandler, changes []schedulerChange) {
+	for _, change := range changes {
+		if change.deleted {
+			handler.OnSchedulerDelete(change.cfg)
+		} else {
+			handler.OnSchedulerPut(change.cfg)
+		}
+	}
+}
+
 type Server struct {
 	cfg             config.Config
 	router          *gin.Engine
 	etcdClient      *EtcdClient
 	statistic       *statistics.Statistic
 	statisticCloser func()
+	watchCancel     context.CancelFunc
 }
 
 func NewEtcdClient(addresses []string) (*EtcdClient, error) {
@@ -52,10 +122,19 @@ func NewEtcdClient(addresses []string) (*EtcdClient, error) {
 		return nil, err
 	}
 
+	watcher, err := clientv3.New(clientv3.Config{
+		Endpoints:   addresses,
+		DialTimeout: etcdDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	etcdClient := &EtcdClient{
-		cli: etcd,
-		//schedulerConfigs: make(map[string][]*types.SchedulerCfg),
-		configMap: make(map[string]*types.SchedulerCfg),
+		cli:              etcd,
+		watcher:          watcher,
+		schedulerConfigs: make(map[string][]*types.SchedulerCfg),
+		configMap:        make(map[string]*types.SchedulerCfg),
 	}
 
 	//if err := ec.loadSchedulerConfigs(); err != nil {
@@ -71,7 +150,11 @@ func (ec *EtcdClient) loadSchedulerConfigs() (map[string][]*types.SchedulerCfg,
 		return nil, err
 	}
 
+	ec.lk.Lock()
+	defer ec.lk.Unlock()
+
 	schedulerConfigs := make(map[string][]*types.SchedulerCfg)
+	configMap := make(map[string]*types.SchedulerCfg)
 
 	for _, kv := range resp.Kvs {
 		var configScheduler *types.SchedulerCfg
@@ -86,17 +169,231 @@ func (ec *EtcdClient) loadSchedulerConfigs() (map[string][]*types.SchedulerCfg,
 		configs = append(configs, configScheduler)
 
 		schedulerConfigs[configScheduler.AreaID] = configs
-		ec.configMap[string(kv.Key)] = configScheduler
+		configMap[string(kv.Key)] = configScheduler
 	}
 
-	for areaId, cfgs := range schedulerConfigs {
-		if err := SetSchedulerConfigs(context.Background(), fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId), cfgs); err != nil {
+	ec.schedulerConfigs = schedulerConfigs
+	ec.configMap = configMap
+	ec.revision = resp.Header.Revision
+	return schedulerConfigs, nil
+}
+
+// schedulerKeyPrefix is the etcd key prefix of the scheduler configs, the same as etcdcli.WatchServers watches.
+func schedulerKeyPrefix() string {
+	return fmt.Sprintf("/%s/", types.NodeScheduler.String())
+}
+
+// watch keeps the scheduler configs in sync with etcd until the context is done, the configs are reloaded when the
+// watch is closed or compacted as the changes in between are lost.
+func (ec *EtcdClient) watch(ctx context.Context, handler SchedulerConfigHandler) {
+	for {
+		ec.watchFromRevision(ctx, handler)
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := ec.resync(ctx, handler)
+			if err == nil {
+				break
+			}
+
+			log.Errorf("reload scheduler configs: %v", err)
+			select {
+			case <-time.After(etcdResyncInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// watchFromRevision handles the changes after the revision loaded, it returns when the watch is closed or compacted.
+func (ec *EtcdClient) watchFromRevision(ctx context.Context, handler SchedulerConfigHandler) {
+	ec.lk.Lock()
+	revision := ec.revision
+	ec.lk.Unlock()
+
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	watchChan := ec.watcher.Watch(watchCtx, schedulerKeyPrefix(), clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+	for resp := range watchChan {
+		if resp.CompactRevision != 0 {
+			log.Warnf("etcd watch compacted at revision %d, reload scheduler configs", resp.CompactRevision)
+			return
+		}
+
+		if err := resp.Err(); err != nil {
+			log.Errorf("watch scheduler configs: %v", err)
+			return
+		}
+
+		for _, event := range resp.Events {
+			switch event.Type {
+			case mvccpb.PUT:
+				if err := ec.onPut(ctx, event.Kv, handler); err != nil {
+					log.Errorf("handle scheduler config put: %v", err)
+				}
+			case mvccpb.DELETE:
+				if err := ec.onDelete(ctx, event.Kv, handler); err != nil {
+					log.Errorf("handle scheduler config delete: %v", err)
+				}
+			}
+		}
+
+		ec.lk.Lock()
+		ec.revision = resp.Header.Revision
+		ec.lk.Unlock()
+	}
+
+	log.Warnf("etcd watch channel closed, reload scheduler configs")
+}
+
+// resync reloads the scheduler configs and notifies the handler of the schedulers changed since the last load.
+func (ec *EtcdClient) resync(ctx context.Context, handler SchedulerConfigHandler) error {
+	ec.lk.Lock()
+	previous := ec.configMap
+	ec.lk.Unlock()
+
+	if _, err := ec.loadSchedulerConfigs(); err != nil {
+		return err
+	}
+
+	changes, err := ec.diffSchedulerConfigs(ctx, previous)
+	notifySchedulerChanges(handler, changes)
+	return err
+}
+
+// diffSchedulerConfigs returns the changes of the configs loaded since the previous configs and writes the
+// configs of the areas changed to redis.
+func (ec *EtcdClient) diffSchedulerConfigs(ctx context.Context, previous map[string]*types.SchedulerCfg) ([]schedulerChange, error) {
+	ec.lk.Lock()
+	defer ec.lk.Unlock()
+
+	var changes []schedulerChange
+	areas := make(map[string]struct{})
+	for key, old := range previous {
+		if cfg, ok := ec.configMap[key]; !ok || cfg.SchedulerURL != old.SchedulerURL {
+			areas[old.AreaID] = struct{}{}
+			changes = append(changes, schedulerChange{cfg: old, deleted: true})
+		}
+	}
+
+	for key, cfg := range ec.configMap {
+		if old, ok := previous[key]; !ok || old.SchedulerURL != cfg.SchedulerURL || old.AccessToken != cfg.AccessToken {
+			areas[cfg.AreaID] = struct{}{}
+			changes = append(changes, schedulerChange{cfg: cfg})
+		}
+	}
+
+	for areaId := range areas {
+		if err := ec.syncAreaConfigs(ctx, areaId); err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (ec *EtcdClient) close() {
+	if err := ec.watcher.Close(); err != nil {
+		log.Errorf("close etcd watcher: %v", err)
+	}
+}
+
+func (ec *EtcdClient) onPut(ctx context.Context, kv *mvccpb.KeyValue, handler SchedulerConfigHandler) error {
+	var configScheduler *types.SchedulerCfg
+	err := etcdcli.SCUnmarshal(kv.Value, &configScheduler)
+	if err != nil {
+		return err
+	}
+
+	changes, err := ec.putConfig(ctx, string(kv.Key), configScheduler)
+	notifySchedulerChanges(handler, changes)
+	return err
+}
+
+// putConfig replaces the config of the key and returns the changes the handler is notified of.
+func (ec *EtcdClient) putConfig(ctx context.Context, key string, cfg *types.SchedulerCfg) ([]schedulerChange, error) {
+	ec.lk.Lock()
+	defer ec.lk.Unlock()
+
+	var changes []schedulerChange
+	if old, ok := ec.configMap[key]; ok {
+		ec.removeConfig(old)
+		if err := ec.syncAreaConfigs(ctx, old.AreaID); err != nil {
 			return nil, err
 		}
+		if old.SchedulerURL != cfg.SchedulerURL {
+			changes = append(changes, schedulerChange{cfg: old, deleted: true})
+		}
 	}
 
-	//ec.schedulerConfigs = schedulerConfigs
-	return schedulerConfigs, nil
+	ec.configMap[key] = cfg
+	ec.schedulerConfigs[cfg.AreaID] = append(ec.schedulerConfigs[cfg.AreaID], cfg)
+	if err := ec.syncAreaConfigs(ctx, cfg.AreaID); err != nil {
+		return changes, err
+	}
+
+	log.Infof("scheduler %s in %s updated", cfg.SchedulerURL, cfg.AreaID)
+	return append(changes, schedulerChange{cfg: cfg}), nil
+}
+
+func (ec *EtcdClient) onDelete(ctx context.Context, kv *mvccpb.KeyValue, handler SchedulerConfigHandler) error {
+	changes, err := ec.deleteConfig(ctx, string(kv.Key))
+	notifySchedulerChanges(handler, changes)
+	return err
+}
+
+// deleteConfig removes the config of the key and returns the changes the handler is notified of.
+func (ec *EtcdClient) deleteConfig(ctx context.Context, key string) ([]schedulerChange, error) {
+	ec.lk.Lock()
+	defer ec.lk.Unlock()
+
+	old, ok := ec.configMap[key]
+	if !ok {
+		return nil, nil
+	}
+
+	delete(ec.configMap, key)
+	ec.removeConfig(old)
+	changes := []schedulerChange{{cfg: old, deleted: true}}
+	if err := ec.syncAreaConfigs(ctx, old.AreaID); err != nil {
+		return changes, err
+	}
+
+	log.Infof("scheduler %s in %s removed", old.SchedulerURL, old.AreaID)
+	return changes, nil
+}
+
+func (ec *EtcdClient) removeConfig(cfg *types.SchedulerCfg) {
+	configs := ec.schedulerConfigs[cfg.AreaID]
+	for i, c := range configs {
+		if c.SchedulerURL == cfg.SchedulerURL {
+			configs = append(configs[:i], configs[i+1:]...)
+			break
+		}
+	}
+
+	if len(configs) == 0 {
+		delete(ec.schedulerConfigs, cfg.AreaID)
+		return
+	}
+
+	ec.schedulerConfigs[cfg.AreaID] = configs
+}
+
+// syncAreaConfigs writes the scheduler configs of the area to redis, the key will be deleted if there is no scheduler in the area.
+func (ec *EtcdClient) syncAreaConfigs(ctx context.Context, areaId string) error {
+	key := fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId)
+	configs, ok := ec.schedulerConfigs[areaId]
+	if !ok {
+		return dao.RedisCache.Del(ctx, key).Err()
+	}
+
+	return SetSchedulerConfigs(ctx, key, configs)
 }
 
 func NewServer(cfg config.Config) (*Server, error) {
@@ -122,19 +419,37 @@ func NewServer(cfg config.Config) (*Server, error) {
 	if cfg.AdminScheduler.Enable {
 		applyAdminScheduler(cfg.AdminScheduler.Address, cfg.AdminScheduler.Token)
 	}
+	statistic = statistics.New(cfg.Statistic, schedulers)
+
+	if err = mailer.Init(cfg.Email); err != nil {
+		log.Errorf("init mailer: %v", err)
+		return nil, err
+	}
+
+	webhook.Init()
+
 	s := &Server{
 		cfg:        cfg,
 		router:     router,
-		statistic:  statistics.New(cfg.Statistic, schedulers),
+		statistic:  statistic,
 		etcdClient: etcdClient,
 	}
 
 	go cleanup.Run(context.Background())
+	go schedulerPool.run(context.Background())
 
 	return s, nil
 }
 
 func (s *Server) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.watchCancel = cancel
+	go s.etcdClient.watch(ctx, s)
+
+	if s.cfg.MetricsListen != "" {
+		go serveMetrics(s.cfg.MetricsListen)
+	}
+
 	s.statistic.Run()
 	err := s.router.Run(s.cfg.ApiListen)
 	if err != nil {
@@ -143,42 +458,110 @@ func (s *Server) Run() {
 }
 
 func (s *Server) Close() {
+	if s.watchCancel != nil {
+		s.watchCancel()
+	}
+	s.etcdClient.close()
 	s.statistic.Stop()
+	mailer.Close()
+	webhook.Close()
+}
+
+// OnSchedulerPut creates a new rpc client for the scheduler, the previous client of the same scheduler will be closed.
+func (s *Server) OnSchedulerPut(cfg *types.SchedulerCfg) {
+	scheduler, err := newStatisticScheduler(cfg)
+	if err != nil {
+		log.Errorf("create scheduler rpc client: %v", err)
+		return
+	}
+
+	s.statistic.AddScheduler(scheduler)
+	setSchedulerApi(scheduler.Api)
+}
+
+// OnSchedulerDelete closes the rpc client of the removed scheduler, no scheduler is used once the last one is removed.
+func (s *Server) OnSchedulerDelete(cfg *types.SchedulerCfg) {
+	s.statistic.RemoveScheduler(schedulerURLOf(cfg))
+	schedulerPool.remove(cfg)
+
+	schedulers := s.statistic.Schedulers()
+	if len(schedulers) == 0 {
+		setSchedulerApi(nil)
+		return
+	}
+
+	setSchedulerApi(schedulers[len(schedulers)-1].Api)
 }
 
+// FetchSchedulersFromEtcd connects to the schedulers in etcd and caches their configs in redis.
 func FetchSchedulersFromEtcd(etcdClient *EtcdClient) ([]*statistics.Scheduler, error) {
+	schedulerConfigs, err := etcdClient.loadSchedulerConfigs()
+	if err != nil {
+		log.Errorf("load scheduer from etcd: %v", err)
+		return nil, err
+	}
+
+	for areaId, cfgs := range schedulerConfigs {
+		if err := SetSchedulerConfigs(context.Background(), fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId), cfgs); err != nil {
+			return nil, err
+		}
+	}
+
+	return connectSchedulers(schedulerConfigs), nil
+}
 
+// FetchSchedulers connects to the schedulers in etcd without redis, it's used by the tools.
+func FetchSchedulers(etcdClient *EtcdClient) ([]*statistics.Scheduler, error) {
 	schedulerConfigs, err := etcdClient.loadSchedulerConfigs()
 	if err != nil {
 		log.Errorf("load scheduer from etcd: %v", err)
 		return nil, err
 	}
 
+	return connectSchedulers(schedulerConfigs), nil
+}
+
+func connectSchedulers(schedulerConfigs map[string][]*types.SchedulerCfg) []*statistics.Scheduler {
 	var out []*statistics.Scheduler
 
-	for key, schedulerURLs := range schedulerConfigs {
+	for _, schedulerURLs := range schedulerConfigs {
 		for _, SchedulerCfg := range schedulerURLs {
-			// https protocol still in test, we use http for now.
-			schedulerURL := strings.Replace(SchedulerCfg.SchedulerURL, "https", "http", 1)
-			headers := http.Header{}
-			headers.Add("Authorization", "Bearer "+SchedulerCfg.AccessToken)
-			clientInit, closeScheduler, err := client.NewScheduler(context.Background(), schedulerURL, headers)
+			scheduler, err := newStatisticScheduler(SchedulerCfg)
 			if err != nil {
 				log.Errorf("create scheduler rpc client: %v", err)
+				continue
 			}
-			out = append(out, &statistics.Scheduler{
-				Uuid:   schedulerURL,
-				Api:    clientInit,
-				AreaId: key,
-				Closer: closeScheduler,
-			})
-			schedulerApi = clientInit
+			out = append(out, scheduler)
+			setSchedulerApi(scheduler.Api)
 		}
 	}
 
 	log.Infof("fetch %d schedulers from Etcd", len(out))
 
-	return out, nil
+	return out
+}
+
+// schedulerURLOf returns the url used to connect to the scheduler.
+func schedulerURLOf(cfg *types.SchedulerCfg) string {
+	// https protocol still in test, we use http for now.
+	return strings.Replace(cfg.SchedulerURL, "https", "http", 1)
+}
+
+func newStatisticScheduler(cfg *types.SchedulerCfg) (*statistics.Scheduler, error) {
+	schedulerURL := schedulerURLOf(cfg)
+	headers := http.Header{}
+	headers.Add("Authorization", "Bearer "+cfg.AccessToken)
+	clientInit, closeScheduler, err := client.NewScheduler(context.Background(), schedulerURL, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statistics.Scheduler{
+		Uuid:   schedulerURL,
+		Api:    clientInit,
+		AreaId: cfg.AreaID,
+		Closer: closeScheduler,
+	}, nil
 }
 
 func applyAdminScheduler(url string, token string) {
@@ -188,7 +571,7 @@ func applyAdminScheduler(url string, token string) {
 	if err != nil {
 		log.Errorf("create scheduler rpc client: %v", err)
 	}
-	schedulerAdmin = schedClient
+	setSchedulerAdmin(schedClient)
 }
 
 //func (s *Server) sendEmail(sendTo string, registrations []string) error {
@@ -207,28 +590,16 @@ func applyAdminScheduler(url string, token string) {
 //	return nil
 //}
 
+// getSchedulerClient returns a client of the pooled schedulers of the area, the healthy schedulers are picked in
+// round-robin order and the calls fail over to the next scheduler when the rpc connection errors.
 func getSchedulerClient(ctx context.Context, areaId string) (api.Scheduler, error) {
-	schedulers, err := GetSchedulerConfigs(ctx, fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId))
-	if err == redis.Nil && areaId != DefaultAreaId {
-		return getSchedulerClient(ctx, DefaultAreaId)
-	}
-
-	if err != nil || len(schedulers) == 0 {
-		log.Errorf("no scheduler found")
-		return nil, errors.New("no scheduler found")
-	}
-
-	schedulerApiUrl := schedulers[0].SchedulerURL
-	schedulerApiToken := schedulers[0].AccessToken
-	SchedulerURL := strings.Replace(schedulerApiUrl, "https", "http", 1)
-	headers := http.Header{}
-	headers.Add("Authorization", "Bearer "+schedulerApiToken)
-	schedulerClient, _, err := client.NewScheduler(ctx, SchedulerURL, headers)
+	candidates, err := schedulerPool.candidates(ctx, areaId)
 	if err != nil {
-		log.Errorf("create scheduler rpc client: %v", err)
+		log.Errorf("no scheduler found")
+		return nil, err
 	}
 
-	return schedulerClient, nil
+	return newFailoverScheduler(candidates), nil
 }
 
 func GetSchedulerConfigs(ctx context.Context, key string) ([]*types.SchedulerCfg, error) {
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"reflect"
+	"testing"
+)
+
+// lockCheckingHandler records the scheduler changes and checks the etcd client isn't locked when notified.
+type lockCheckingHandler struct {
+	t       *testing.T
+	ec      *EtcdClient
+	changes []string
+}
+
+func (h *lockCheckingHandler) record(op string, cfg *types.SchedulerCfg) {
+	if !h.ec.lk.TryLock() {
+		h.t.Errorf("%s %s notified with the lock held", op, cfg.SchedulerURL)
+		return
+	}
+	h.ec.lk.Unlock()
+	h.changes = append(h.changes, fmt.Sprintf("%s %s", op, cfg.SchedulerURL))
+}
+
+func (h *lockCheckingHandler) OnSchedulerPut(cfg *types.SchedulerCfg) { h.record("put", cfg) }
+
+func (h *lockCheckingHandler) OnSchedulerDelete(cfg *types.SchedulerCfg) { h.record("delete", cfg) }
+
+func newTestEtcdClient() *EtcdClient {
+	return &EtcdClient{
+		schedulerConfigs: make(map[string][]*types.SchedulerCfg),
+		configMap:        make(map[string]*types.SchedulerCfg),
+	}
+}
+
+func TestEtcdClientConfigChanges(t *testing.T) {
+	useMiniRedis(t)
+	ctx := context.Background()
+	ec := newTestEtcdClient()
+
+	s0 := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://s0"}
+	s1 := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://s1"}
+	s0token := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://s0", AccessToken: "token"}
+
+	steps := []struct {
+		name string
+		fn   func() ([]schedulerChange, error)
+		want []schedulerChange
+	}{
+		{"put", func() ([]schedulerChange, error) { return ec.putConfig(ctx, "/scheduler/0", s0) }, []schedulerChange{{cfg: s0}}},
+		{"token changed", func() ([]schedulerChange, error) { return ec.putConfig(ctx, "/scheduler/0", s0token) }, []schedulerChange{{cfg: s0token}}},
+		{"url changed", func() ([]schedulerChange, error) { return ec.putConfig(ctx, "/scheduler/0", s1) },
+			[]schedulerChange{{cfg: s0token, deleted: true}, {cfg: s1}}},
+		{"delete", func() ([]schedulerChange, error) { return ec.deleteConfig(ctx, "/scheduler/0") }, []schedulerChange{{cfg: s1, deleted: true}}},
+		{"delete unknown", func() ([]schedulerChange, error) { return ec.deleteConfig(ctx, "/scheduler/0") }, nil},
+	}
+
+	for _, step := range steps {
+		changes, err := step.fn()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(changes, step.want) {
+			t.Errorf("%s: changes = %v, want %v", step.name, changes, step.want)
+		}
+	}
+
+	if len(ec.configMap) != 0 || len(ec.schedulerConfigs) != 0 {
+		t.Errorf("configs left after delete: %v %v", ec.configMap, ec.schedulerConfigs)
+	}
+}
+
+func TestEtcdClientDiffConfigs(t *testing.T) {
+	useMiniRedis(t)
+	ec := newTestEtcdClient()
+
+	kept := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://kept"}
+	removed := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://removed"}
+	added := &types.SchedulerCfg{AreaID: "Europe", SchedulerURL: "http://added"}
+	ec.configMap = map[string]*types.SchedulerCfg{"/scheduler/kept": kept, "/scheduler/added": added}
+	ec.schedulerConfigs = map[string][]*types.SchedulerCfg{"Asia-China": {kept}, "Europe": {added}}
+
+	previous := map[string]*types.SchedulerCfg{"/scheduler/kept": kept, "/scheduler/removed": removed}
+	changes, err := ec.diffSchedulerConfigs(context.Background(), previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []schedulerChange{{cfg: removed, deleted: true}, {cfg: added}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestEtcdClientNotifiesUnlocked(t *testing.T) {
+	useMiniRedis(t)
+	ctx := context.Background()
+	ec := newTestEtcdClient()
+	handler := &lockCheckingHandler{t: t, ec: ec}
+
+	cfg := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://s0"}
+	changes, err := ec.putConfig(ctx, "/scheduler/0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifySchedulerChanges(handler, changes)
+
+	if err := ec.onDelete(ctx, &mvccpb.KeyValue{Key: []byte("/scheduler/0")}, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"put http://s0", "delete http://s0"}
+	if !reflect.DeepEqual(handler.changes, want) {
+		t.Errorf("changes = %v, want %v", handler.changes, want)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
-	"github.com/gnasnik/titan-explorer/pkg/iptool"
+	"github.com/gnasnik/titan-explorer/core/mailer"
 	"net/http"
 	"strconv"
 	"time"
@@ -41,7 +41,7 @@ func CreateApplicationHandler(c *gin.Context) {
 	params.UpdatedAt = time.Now()
 	params.NodeType = 1
 	params.Status = dao.ApplicationStatusCreated
-	params.Ip = iptool.GetClientIP(c.Request)
+	params.Ip = clientIP(c)
 
 	schedulerClient, err := getSchedulerClient(c.Request.Context(), params.AreaID)
 	if err != nil {
@@ -63,6 +63,7 @@ func handleApplication(ctx context.Context, schedulerClient api.Scheduler, appli
 	registration, err := schedulerClient.RequestActivationCodes(ctx, types.NodeType(1), amount)
 	if err != nil {
 		log.Errorf("register node: %v", err)
+		notifyApplicationResult(application, nil, "the nodes could not be registered, please apply again later")
 		return err
 	}
 	var results []*model.ApplicationResult
@@ -105,9 +106,37 @@ func handleApplication(ctx context.Context, schedulerClient api.Scheduler, appli
 		log.Errorf("add device info: %v", err)
 	}
 
+	var deviceIds []string
+	for _, result := range results {
+		deviceIds = append(deviceIds, result.DeviceID)
+	}
+	notifyApplicationResult(application, deviceIds, "")
+
 	return nil
 }
 
+// notifyApplicationResult mails the result of the application to the applicant, the application is approved with the
+// devices registered or rejected for the reason.
+func notifyApplicationResult(application *model.Application, deviceIds []string, reason string) {
+	if application.Email == "" {
+		return
+	}
+
+	data := mailer.ApplicationResultData{
+		Num:       int32(len(deviceIds)),
+		Approved:  reason == "",
+		DeviceIDs: deviceIds,
+		Reason:    reason,
+	}
+	if !data.Approved {
+		data.Num = application.Amount
+	}
+
+	if err := mailer.Enqueue(application.Email, model.LanguageEN, mailer.TemplateApplicationResult, data); err != nil {
+		log.Errorf("enqueue application result mail: %v", err)
+	}
+}
+
 func GetApplicationsHandler(c *gin.Context) {
 	userID := c.Query("user_id")
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
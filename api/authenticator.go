@@ -1,18 +1,39 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/iptool"
 	"github.com/gnasnik/titan-explorer/pkg/random"
 	"net/http"
 	"strings"
 	"time"
 )
 
+// APIKeyScope is the permission of an api key to call the routes of the api key.
+type APIKeyScope string
+
+const (
+	ScopeFilStorageWrite APIKeyScope = "fil_storage:write"
+	ScopeBackupRead      APIKeyScope = "backup:read"
+	ScopeBackupWrite     APIKeyScope = "backup:write"
+)
+
+var apiKeyScopes = []APIKeyScope{ScopeFilStorageWrite, ScopeBackupRead, ScopeBackupWrite}
+
+const (
+	apiKeyScopesKey = "api_key_scopes"
+	// lastUsedInterval limits how often the last used time of an api key is written back.
+	lastUsedInterval = time.Minute
+)
+
 // AuthAPIKeyMiddlewareFunc makes GinJWTMiddleware implement the Middleware interface.
 func AuthAPIKeyMiddlewareFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -38,30 +59,148 @@ func AuthAPIKeyMiddlewareFunc() gin.HandlerFunc {
 			return
 		}
 
-		if secret.Status == 1 {
+		if secret.Status == dao.UserSecretStatusRevoked {
 			c.JSON(http.StatusUnauthorized, respErrorCode(errors.InvalidAPPKey, c))
 			c.Abort()
 			return
 		}
 
+		if !secret.ExpiredAt.IsZero() && secret.ExpiredAt.Before(time.Now()) {
+			c.JSON(http.StatusUnauthorized, respErrorCode(errors.APPKeyExpired, c))
+			c.Abort()
+			return
+		}
+
+		if allowList := splitList(secret.IPAllowList); len(allowList) > 0 && !iptool.IPAllowed(clientIP(c), allowList) {
+			c.JSON(http.StatusForbidden, respErrorCode(errors.IPNotAllowed, c))
+			c.Abort()
+			return
+		}
+
+		if time.Since(secret.LastUsedAt) > lastUsedInterval {
+			go func(id int64) {
+				if err := dao.UpdateUserSecretLastUsed(context.Background(), id, time.Now()); err != nil {
+					log.Errorf("update secret last used: %v", err)
+				}
+			}(secret.ID)
+		}
+
 		c.Set("user_id", secret.UserID)
+		c.Set(apiKeyScopesKey, splitList(secret.Perms))
 	}
 }
 
+// RequireAPIKeyScope aborts the request if the api key doesn't have the scope,
+// it must be used after AuthAPIKeyMiddlewareFunc.
+func RequireAPIKeyScope(scope APIKeyScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, s := range c.GetStringSlice(apiKeyScopesKey) {
+			if APIKeyScope(s) == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, respErrorCode(errors.PermissionDenied, c))
+		c.Abort()
+	}
+}
+
+// clientIP returns the ip of the client, the proxy headers are only taken from the trusted proxies.
+func clientIP(c *gin.Context) string {
+	return iptool.GetTrustedClientIP(c.Request, config.Cfg.TrustedProxies)
+}
+
+// splitList splits the comma separated values, the blank values are dropped.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseAPIKeyScopes parses the comma separated scopes of an api key, the key gets all the scopes if none is given as
+// the keys created before the scopes.
+func parseAPIKeyScopes(s string) ([]string, bool) {
+	perms := splitList(s)
+	if len(perms) == 0 {
+		for _, scope := range apiKeyScopes {
+			perms = append(perms, string(scope))
+		}
+		return perms, true
+	}
+
+	for _, perm := range perms {
+		var known bool
+		for _, scope := range apiKeyScopes {
+			if APIKeyScope(perm) == scope {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return nil, false
+		}
+	}
+
+	return perms, true
+}
+
+func parseIPAllowList(s string) ([]string, bool) {
+	allowList := splitList(s)
+	for _, entry := range allowList {
+		if !iptool.ValidIPOrCIDR(entry) {
+			return nil, false
+		}
+	}
+	return allowList, true
+}
+
+// CreateNewSecretKeyHandler creates an api key with the comma separated scopes in perm, the expire is the valid
+// duration of the key, e.g. 720h, and ip_allow_list is the comma separated addresses or CIDRs allowed to use the key.
 func CreateNewSecretKeyHandler(c *gin.Context) {
 	claims := jwt.ExtractClaims(c)
 	username := claims[identityKey].(string)
-	//perms := c.Query("perm")
+
+	perms, ok := parseAPIKeyScopes(c.Query("perm"))
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	allowList, ok := parseIPAllowList(c.Query("ip_allow_list"))
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	var expiredAt time.Time
+	if expire := c.Query("expire"); expire != "" {
+		d, err := time.ParseDuration(expire)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		expiredAt = time.Now().Add(d)
+	}
 
 	appKey := random.GenerateRandomString(18)
-	appSecret := fmt.Sprintf("ts-%s", random.GenerateRandomString(48))
+	appSecret := newAppSecret()
 
 	err := dao.AddUserSecret(c.Request.Context(), &model.UserSecret{
-		UserID:    username,
-		AppKey:    appKey,
-		AppSecret: appSecret,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		UserID:      username,
+		AppKey:      appKey,
+		AppSecret:   appSecret,
+		Perms:       strings.Join(perms, ","),
+		IPAllowList: strings.Join(allowList, ","),
+		ExpiredAt:   expiredAt,
+		Status:      dao.UserSecretStatusActive,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	})
 	if err != nil {
 		log.Errorf("Add User secret: %v", err)
@@ -72,5 +211,97 @@ func CreateNewSecretKeyHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"app_key":    appKey,
 		"app_secret": appSecret,
+		"perms":      perms,
+		"expired_at": expiredAt,
+	}))
+}
+
+func newAppSecret() string {
+	return fmt.Sprintf("ts-%s", random.GenerateRandomString(48))
+}
+
+// maskSecret keeps the prefix of the secret only, the full secret is shown once on creation and rotation.
+func maskSecret(secret string) string {
+	if len(secret) <= 7 {
+		return secret
+	}
+	return secret[:7] + "****"
+}
+
+func GetSecretKeysHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	secrets, err := dao.ListUserSecrets(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("list user secrets: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	for _, secret := range secrets {
+		secret.AppSecret = maskSecret(secret.AppSecret)
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  secrets,
+		"total": len(secrets),
+	}))
+}
+
+// getOwnSecret returns the active api key of the user, the response is written if it's not found.
+func getOwnSecret(c *gin.Context, appKey string) (*model.UserSecret, bool) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	secret, err := dao.GetUserSecretByAppKey(c.Request.Context(), username, appKey)
+	if err == sql.ErrNoRows || (err == nil && secret.Status == dao.UserSecretStatusRevoked) {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return nil, false
+	}
+
+	if err != nil {
+		log.Errorf("get user secret: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, false
+	}
+
+	return secret, true
+}
+
+// RotateSecretKeyHandler replaces the secret of the api key, the scopes, expiry and allow list are kept.
+func RotateSecretKeyHandler(c *gin.Context) {
+	secret, ok := getOwnSecret(c, c.Query("app_key"))
+	if !ok {
+		return
+	}
+
+	appSecret := newAppSecret()
+	if err := dao.UpdateUserSecret(c.Request.Context(), secret.ID, appSecret); err != nil {
+		log.Errorf("update user secret: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"app_key":    secret.AppKey,
+		"app_secret": appSecret,
+	}))
+}
+
+func RevokeSecretKeyHandler(c *gin.Context) {
+	secret, ok := getOwnSecret(c, c.Query("app_key"))
+	if !ok {
+		return
+	}
+
+	if err := dao.RevokeUserSecret(c.Request.Context(), secret.ID); err != nil {
+		log.Errorf("revoke user secret: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
 	}))
 }
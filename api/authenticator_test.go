@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseAPIKeyScopes(t *testing.T) {
+	cases := []struct {
+		name string
+		s    string
+		want []string
+		ok   bool
+	}{
+		{"all scopes when none given", "", []string{"fil_storage:write", "backup:read", "backup:write"}, true},
+		{"blank", " , ", []string{"fil_storage:write", "backup:read", "backup:write"}, true},
+		{"one scope", "backup:read", []string{"backup:read"}, true},
+		{"spaces trimmed", " backup:read , backup:write ", []string{"backup:read", "backup:write"}, true},
+		{"unknown scope", "backup:read,admin", nil, false},
+		{"case sensitive", "Backup:Read", nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := parseAPIKeyScopes(c.s)
+			if ok != c.ok || !reflect.DeepEqual(got, c.want) {
+				t.Errorf("parseAPIKeyScopes(%q) = %v %v, want %v %v", c.s, got, ok, c.want, c.ok)
+			}
+		})
+	}
+}
+
+func TestParseIPAllowList(t *testing.T) {
+	cases := []struct {
+		s    string
+		want []string
+		ok   bool
+	}{
+		{"", nil, true},
+		{"1.2.3.4", []string{"1.2.3.4"}, true},
+		{"1.2.3.4, 10.0.0.0/8, ::1", []string{"1.2.3.4", "10.0.0.0/8", "::1"}, true},
+		{"1.2.3.4,example.com", nil, false},
+		{"10.0.0.0/33", nil, false},
+	}
+
+	for _, c := range cases {
+		got, ok := parseIPAllowList(c.s)
+		if ok != c.ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseIPAllowList(%q) = %v %v, want %v %v", c.s, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRequireAPIKeyScope(t *testing.T) {
+	cases := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"scope granted", []string{"backup:read", "backup:write"}, http.StatusOK},
+		{"scope missing", []string{"backup:read"}, http.StatusForbidden},
+		{"no scope", nil, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, w := newClaimsContext(nil)
+			if c.scopes != nil {
+				ctx.Set(apiKeyScopesKey, c.scopes)
+			}
+
+			RequireAPIKeyScope(ScopeBackupWrite)(ctx)
+			if ctx.IsAborted() != (c.status != http.StatusOK) || w.Code != c.status {
+				t.Errorf("status = %d aborted %v, want %d", w.Code, ctx.IsAborted(), c.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"net/http"
+	"strconv"
+)
+
+func GetBackupStatsHandler(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", dao.BackupStatsByDay)
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:      page,
+		PageSize:  pageSize,
+		StartTime: c.Query("from"),
+		EndTime:   c.Query("to"),
+	}
+
+	switch groupBy {
+	case dao.BackupStatsByDay, dao.BackupStatsByProject, dao.BackupStatsByUser:
+	default:
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	list, total, err := dao.GetAssetBackupStats(c.Request.Context(), groupBy, option)
+	if err != nil {
+		log.Errorf("get asset backup stats: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+func GetBackupOverviewHandler(c *gin.Context) {
+	dirs, err := dao.GetBackupDirStats(c.Request.Context())
+	if err != nil {
+		log.Errorf("get backup dir stats: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	oldest, err := dao.GetOldestUnbackedAsset(c.Request.Context())
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("get oldest unbacked asset: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"dirs":            dirs,
+		"oldest_unbacked": oldest,
+	}))
+}
+
+func GetFailedBackupAssetsHandler(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	list, total, err := dao.GetFailedBackupAssets(c.Request.Context(), option)
+	if err != nil {
+		log.Errorf("get failed backup assets: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+func ResetFailedBackupAssetsHandler(c *gin.Context) {
+	var params struct {
+		Cids []string `json:"cids"`
+	}
+
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	affected, err := dao.ResetFailedBackupAssets(c.Request.Context(), params.Cids)
+	if err != nil {
+		log.Errorf("reset failed backup assets: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"affected": affected,
+	}))
+}
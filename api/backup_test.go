@@ -0,0 +1,74 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGetBackupStatsHandlerInvalidParams(t *testing.T) {
+	for _, query := range []string{"group_by=area", "group_by="} {
+		useMockDB(t)
+		ctx, w := newClaimsContext(nil)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+
+		GetBackupStatsHandler(ctx)
+		if got := responseErrorCode(t, w); got != errors.InvalidParams {
+			t.Errorf("GetBackupStatsHandler(%s) error = %d, want %d", query, got, errors.InvalidParams)
+		}
+	}
+}
+
+func TestResetFailedBackupAssetsHandler(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		query string
+		args  []driver.Value
+		err   int
+	}{
+		{"invalid body", `{"cids":"cid1"}`, "", nil, errors.InvalidParams},
+		{"all failed", `{}`, `UPDATE assets SET event = ?, path = '', updated_at = now() WHERE event = ?`,
+			[]driver.Value{dao.AssetEventAdded, dao.AssetEventBackupFailed}, 0},
+		{"by cid", `{"cids":["cid1","cid2"]}`, `UPDATE assets SET event = ?, path = '', updated_at = now() WHERE event = ? AND cid IN (?, ?)`,
+			[]driver.Value{dao.AssetEventAdded, dao.AssetEventBackupFailed, "cid1", "cid2"}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			if c.query != "" {
+				mock.ExpectExec(regexp.QuoteMeta(c.query)).
+					WithArgs(c.args...).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			}
+
+			ctx, w := newClaimsContext(nil)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			ResetFailedBackupAssetsHandler(ctx)
+
+			if got := responseErrorCode(t, w); got != c.err {
+				t.Fatalf("ResetFailedBackupAssetsHandler(%s) error = %d, want %d", c.body, got, c.err)
+			}
+			if c.err != 0 {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Affected int64 `json:"affected"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.Affected != 2 {
+				t.Errorf("response %s, want 2 assets affected", w.Body.String())
+			}
+		})
+	}
+}
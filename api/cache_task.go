@@ -32,7 +32,7 @@ func AddCacheTaskHandler(c *gin.Context) {
 		CID:        strings.TrimSpace(params.CarfileCid),
 		Expiration: expiredTime,
 	}
-	err = schedulerAdmin.PullAsset(c.Request.Context(), info)
+	err = getSchedulerAdmin().PullAsset(c.Request.Context(), info)
 	if err != nil {
 		log.Errorf("api AddCacheTask: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -43,7 +43,7 @@ func AddCacheTaskHandler(c *gin.Context) {
 
 func GetCacheTaskInfoHandler(c *gin.Context) {
 	carFileCID := c.Query("carfile_cid")
-	cacheInfo, err := schedulerAdmin.GetAssetRecord(c.Request.Context(), carFileCID)
+	cacheInfo, err := getSchedulerAdmin().GetAssetRecord(c.Request.Context(), carFileCID)
 	if err != nil {
 		log.Errorf("api GetCarfileRecordInfo: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -60,7 +60,7 @@ func DeleteCacheTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
 		return
 	}
-	err = schedulerAdmin.RemoveAssetRecord(c.Request.Context(), params.CarfileCid)
+	err = getSchedulerAdmin().RemoveAssetRecord(c.Request.Context(), params.CarfileCid)
 	if err != nil {
 		log.Errorf("api RemoveCarfile: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -72,7 +72,7 @@ func DeleteCacheTaskHandler(c *gin.Context) {
 func DeleteCacheTaskByDeviceHandler(c *gin.Context) {
 	carFileCID := c.Query("carfile_cid")
 	deviceID := c.Query("device_id")
-	err := schedulerAdmin.RemoveAssetReplica(c.Request.Context(), carFileCID, deviceID)
+	err := getSchedulerAdmin().RemoveAssetReplica(c.Request.Context(), carFileCID, deviceID)
 	if err != nil {
 		log.Errorf("api RemoveCache: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -84,7 +84,7 @@ func DeleteCacheTaskByDeviceHandler(c *gin.Context) {
 func GetCacheTaskListHandler(c *gin.Context) {
 	page, _ := strconv.ParseInt(c.Query("current"), 10, 64)
 	size, _ := strconv.ParseInt(c.Query("size"), 10, 64)
-	resp, err := schedulerAdmin.GetAssetRecords(c.Request.Context(), int(size), int((page-1)*size), assets.PullingStates, "")
+	resp, err := getSchedulerAdmin().GetAssetRecords(c.Request.Context(), int(size), int((page-1)*size), assets.PullingStates, "")
 	if err != nil {
 		log.Errorf("api ListCarfileRecords: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -99,7 +99,7 @@ func GetCacheTaskListHandler(c *gin.Context) {
 
 func GetCarFileInfoHandler(c *gin.Context) {
 	carFileCID := c.Query("carfile_cid")
-	fileInfo, err := schedulerAdmin.GetAssetRecord(c.Request.Context(), carFileCID)
+	fileInfo, err := getSchedulerAdmin().GetAssetRecord(c.Request.Context(), carFileCID)
 	if err != nil {
 		log.Errorf("get carfile info: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -112,7 +112,7 @@ func GetCarFileInfoHandler(c *gin.Context) {
 
 //func RemoveCacheHandler(c *gin.Context) {
 //	carFileCID := c.Query("carfile_cid")
-//	err := schedulerAdmin.RemoveCarfile(c.Request.Context(), carFileCID)
+//	err := getSchedulerAdmin().RemoveCarfile(c.Request.Context(), carFileCID)
 //	if err != nil {
 //		log.Errorf("remove cahce task: %v", err)
 //		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -0,0 +1,185 @@
+package api
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/webhook"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetDeviceEventsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	total, events, err := dao.GetDeviceEvents(c.Request.Context(), username, c.Query("device_id"), c.Query("event"), option)
+	if err != nil {
+		log.Errorf("get device events: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  events,
+		"total": total,
+	}))
+}
+
+func GetDeviceAlertRulesHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	rules, err := dao.ListDeviceAlertRules(c.Request.Context(), username, c.Query("device_id"))
+	if err != nil {
+		log.Errorf("list device alert rules: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  rules,
+		"total": len(rules),
+	}))
+}
+
+func validDeviceAlertRule(rule *model.DeviceAlertRule) bool {
+	switch rule.Type {
+	case model.DeviceAlertOffline:
+		if rule.Threshold < 0 {
+			return false
+		}
+	case model.DeviceAlertAbnormal:
+	case model.DeviceAlertDiskUsage:
+		if rule.Threshold <= 0 || rule.Threshold >= 100 {
+			return false
+		}
+	default:
+		return false
+	}
+
+	switch rule.Channel {
+	case model.AlertChannelEmail:
+		return true
+	case model.AlertChannelWebhook:
+		return webhook.CheckURL(rule.Webhook) == nil
+	default:
+		return false
+	}
+}
+
+func AddDeviceAlertRuleHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var rule model.DeviceAlertRule
+	if err := c.BindJSON(&rule); err != nil || !validDeviceAlertRule(&rule) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	device, err := dao.GetDeviceInfoByID(c.Request.Context(), rule.DeviceID)
+	if err != nil {
+		log.Errorf("get device info: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if device == nil || device.UserID != username {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceNotExists, c))
+		return
+	}
+
+	rule.ID = 0
+	rule.UserID = username
+	rule.Enabled = true
+	rule.Triggered = false
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+
+	if err = dao.AddDeviceAlertRule(c.Request.Context(), &rule); err != nil {
+		log.Errorf("add device alert rule: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"rule": rule,
+	}))
+}
+
+func UpdateDeviceAlertRuleHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var rule model.DeviceAlertRule
+	if err := c.BindJSON(&rule); err != nil || rule.ID <= 0 || !validDeviceAlertRule(&rule) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	rule.UserID = username
+	rule.UpdatedAt = time.Now()
+
+	err := dao.UpdateDeviceAlertRule(c.Request.Context(), &rule)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("update device alert rule: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	updated, err := dao.GetDeviceAlertRule(c.Request.Context(), username, rule.ID)
+	if err != nil {
+		log.Errorf("get device alert rule: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"rule": updated,
+	}))
+}
+
+func DeleteDeviceAlertRuleHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	err := dao.DeleteDeviceAlertRule(c.Request.Context(), username, params.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("delete device alert rule: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
@@ -0,0 +1,520 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	batchVerifyConcurrency = 16
+	deviceUnbindUndoWindow = 24 * time.Hour
+)
+
+type batchBindRow struct {
+	NodeID    string `json:"node_id"`
+	Signature string `json:"signature"`
+	AreaID    string `json:"area_id"`
+}
+
+// batchBindParams are the rows of a batch binding, all the nodes sign the same code generated by the user.
+type batchBindParams struct {
+	Hash   string          `json:"hash"`
+	AreaID string          `json:"area_id"`
+	DryRun bool            `json:"dry_run"`
+	Items  []*batchBindRow `json:"items"`
+}
+
+type batchUnbindParams struct {
+	DeviceIDs []string `json:"device_ids"`
+	DryRun    bool     `json:"dry_run"`
+}
+
+type batchResult struct {
+	NodeID string `json:"node_id"`
+	Code   int    `json:"err"`
+	Msg    string `json:"msg"`
+}
+
+func newBatchResult(c *gin.Context, nodeId string, code int) *batchResult {
+	result := &batchResult{NodeID: nodeId, Code: code}
+	if code != 0 {
+		result.Msg, _ = respErrorCode(code, c)["msg"].(string)
+	}
+	return result
+}
+
+// readCSVRows reads the rows of the csv, the columns are taken from the header if the first row has the first column
+// name, or are in the order of the columns otherwise.
+func readCSVRows(r io.Reader, columns ...string) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := columns
+	for _, field := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(field), columns[0]) {
+			header = make([]string, len(records[0]))
+			for i, name := range records[0] {
+				header[i] = strings.ToLower(strings.TrimSpace(name))
+			}
+			records = records[1:]
+			break
+		}
+	}
+
+	var out []map[string]string
+	for _, record := range records {
+		row := make(map[string]string)
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		out = append(out, row)
+	}
+
+	return out, nil
+}
+
+// readBatchCSV returns the csv of the request, uploaded as the file of a form or as the body, nil if it's neither.
+func readBatchCSV(c *gin.Context, columns ...string) ([]map[string]string, bool, error) {
+	contentType := c.ContentType()
+	switch {
+	case contentType == "multipart/form-data":
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, true, err
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, true, err
+		}
+		defer f.Close()
+
+		rows, err := readCSVRows(f, columns...)
+		return rows, true, err
+	case contentType == "text/csv":
+		rows, err := readCSVRows(c.Request.Body, columns...)
+		return rows, true, err
+	default:
+		return nil, false, nil
+	}
+}
+
+// batchFormValue returns the value of the form or the query of the csv uploads.
+func batchFormValue(c *gin.Context, key string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return c.Query(key)
+}
+
+func parseBatchBindParams(c *gin.Context) (*batchBindParams, error) {
+	rows, isCSV, err := readBatchCSV(c, "node_id", "signature", "area_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if !isCSV {
+		var params batchBindParams
+		if err = c.BindJSON(&params); err != nil {
+			return nil, err
+		}
+		return &params, nil
+	}
+
+	params := &batchBindParams{
+		Hash:   batchFormValue(c, "hash"),
+		AreaID: batchFormValue(c, "area_id"),
+	}
+	params.DryRun, _ = strconv.ParseBool(batchFormValue(c, "dry_run"))
+
+	for _, row := range rows {
+		params.Items = append(params.Items, &batchBindRow{
+			NodeID:    row["node_id"],
+			Signature: row["signature"],
+			AreaID:    row["area_id"],
+		})
+	}
+
+	return params, nil
+}
+
+func parseBatchUnbindParams(c *gin.Context) (*batchUnbindParams, error) {
+	rows, isCSV, err := readBatchCSV(c, "node_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if !isCSV {
+		var params batchUnbindParams
+		if err = c.BindJSON(&params); err != nil {
+			return nil, err
+		}
+		return &params, nil
+	}
+
+	params := &batchUnbindParams{}
+	params.DryRun, _ = strconv.ParseBool(batchFormValue(c, "dry_run"))
+	for _, row := range rows {
+		params.DeviceIDs = append(params.DeviceIDs, row["node_id"])
+	}
+
+	return params, nil
+}
+
+// verifyBindRow checks the node of the row can be bound and the code is signed by the node.
+func verifyBindRow(ctx context.Context, row *batchBindRow, hash, areaId string) int {
+	if row.NodeID == "" || row.Signature == "" {
+		return errors.InvalidParams
+	}
+
+	deviceInfo, err := dao.GetDeviceInfo(ctx, row.NodeID)
+	if err == dao.ErrNoRow {
+		return errors.DeviceNotExists
+	}
+
+	if err != nil {
+		log.Errorf("get device info: %v", err)
+		return errors.InternalServer
+	}
+
+	if deviceInfo.UserID != "" {
+		return errors.DeviceBound
+	}
+
+	if row.AreaID == "" {
+		row.AreaID = areaId
+	}
+
+	schedulerClient, err := getSchedulerClient(ctx, row.AreaID)
+	if err != nil {
+		return errors.NoSchedulerFound
+	}
+
+	return verifyNodeSignature(ctx, schedulerClient, row.NodeID, row.Signature, hash)
+}
+
+// BatchDeviceBindingHandler binds the nodes of the rows to the user, the signatures of the rows are checked concurrently
+// against the scheduler of their area. Only the rows passing the checks are bound and nothing is bound in the dry run.
+func BatchDeviceBindingHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	params, err := parseBatchBindParams(c)
+	if err != nil || params.Hash == "" || len(params.Items) == 0 || len(params.Items) > maxDevicesPerRequest {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	sign, err := dao.GetSignatureByHash(c.Request.Context(), params.Hash)
+	if err == dao.ErrNoRow || (err == nil && sign.Username != username) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidSignature, c))
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if sign.Signature != "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceBound, c))
+		return
+	}
+
+	if params.AreaID == "" {
+		params.AreaID = dao.GetAreaID(c.Request.Context(), username)
+	}
+
+	codes := make([]int, len(params.Items))
+	seen := make(map[string]struct{})
+	for i, row := range params.Items {
+		if _, ok := seen[row.NodeID]; ok {
+			codes[i] = errors.InvalidParams
+			continue
+		}
+		seen[row.NodeID] = struct{}{}
+		codes[i] = -1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchVerifyConcurrency)
+	for i, row := range params.Items {
+		if codes[i] != -1 {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, row *batchBindRow) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			codes[i] = verifyBindRow(c.Request.Context(), row, params.Hash, params.AreaID)
+		}(i, row)
+	}
+	wg.Wait()
+
+	var bound int
+	results := make([]*batchResult, len(params.Items))
+	for i, row := range params.Items {
+		if codes[i] == 0 && !params.DryRun {
+			codes[i] = bindBatchRow(c.Request.Context(), username, row, sign, bound == 0)
+			if codes[i] == 0 {
+				bound++
+			}
+		}
+		results[i] = newBatchResult(c, row.NodeID, codes[i])
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"dry_run": params.DryRun,
+		"bound":   bound,
+		"list":    results,
+		"total":   len(results),
+	}))
+}
+
+// bindBatchRow binds the node like DeviceBindingHandler does, the first node takes the signature record of the code
+// and the signatures of the other nodes are added to it.
+func bindBatchRow(ctx context.Context, username string, row *batchBindRow, sign *model.Signature, first bool) int {
+	if err := dao.UpdateUserDeviceInfo(ctx, &model.DeviceInfo{
+		UserID:     username,
+		DeviceID:   row.NodeID,
+		BindStatus: "binding",
+	}); err != nil {
+		log.Errorf("update device binding status: %v", err)
+		return errors.InternalServer
+	}
+
+	var err error
+	if first {
+		err = dao.UpdateSignature(ctx, row.Signature, row.NodeID, row.AreaID, sign.Hash)
+	} else {
+		err = dao.AddSignature(ctx, &model.Signature{
+			Username:  username,
+			NodeId:    row.NodeID,
+			AreaId:    row.AreaID,
+			Message:   sign.Message,
+			Hash:      sign.Hash,
+			Signature: row.Signature,
+		})
+	}
+	if err != nil {
+		log.Errorf("save signature: %v", err)
+		return errors.InternalServer
+	}
+
+	if err = addBindDeviceReward(ctx, username, row.NodeID); err != nil {
+		log.Errorf("add bind device reward: %v", err)
+	}
+
+	return 0
+}
+
+// BatchDeviceUnBindingHandler unbinds the devices of the user like DeviceUnBindingHandlerOld does, the batch can be
+// undone by BatchDeviceUnBindingUndoHandler. Nothing is unbound in the dry run.
+func BatchDeviceUnBindingHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	params, err := parseBatchUnbindParams(c)
+	if err != nil || len(params.DeviceIDs) == 0 || len(params.DeviceIDs) > maxDevicesPerRequest {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	devices, err := dao.GetDeviceInfoByIDs(c.Request.Context(), params.DeviceIDs)
+	if err != nil {
+		log.Errorf("get device info by ids: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	codes := make([]int, len(params.DeviceIDs))
+	seen := make(map[string]struct{})
+	var deviceIds []string
+	for i, deviceId := range params.DeviceIDs {
+		device, ok := devices[deviceId]
+		_, duplicated := seen[deviceId]
+		switch {
+		case duplicated || deviceId == "":
+			codes[i] = errors.InvalidParams
+		case !ok:
+			codes[i] = errors.DeviceNotExists
+		case device.UserID != username:
+			codes[i] = errors.UnbindingNotAllowed
+		default:
+			deviceIds = append(deviceIds, deviceId)
+		}
+		seen[deviceId] = struct{}{}
+	}
+
+	var batch *model.DeviceUnbindBatch
+	if !params.DryRun && len(deviceIds) > 0 {
+		var unbound []string
+		batch, unbound, err = dao.UnbindUserDevices(c.Request.Context(), username, deviceIds)
+		if err != nil {
+			log.Errorf("unbind user devices: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+
+		removeDeviceLeaderboards(c.Request.Context(), unbound...)
+
+		done := make(map[string]struct{})
+		for _, deviceId := range unbound {
+			done[deviceId] = struct{}{}
+		}
+
+		for i, deviceId := range params.DeviceIDs {
+			if _, ok := done[deviceId]; !ok && codes[i] == 0 {
+				codes[i] = errors.UnbindingNotAllowed
+			}
+		}
+	}
+
+	results := make([]*batchResult, len(params.DeviceIDs))
+	for i, deviceId := range params.DeviceIDs {
+		results[i] = newBatchResult(c, deviceId, codes[i])
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"dry_run": params.DryRun,
+		"batch":   batch,
+		"list":    results,
+		"total":   len(results),
+	}))
+}
+
+// deviceUnbindUndoable returns whether the batch can still be undone, once and within the undo window.
+func deviceUnbindUndoable(batch *model.DeviceUnbindBatch, now time.Time) bool {
+	return !batch.Undone && now.Sub(batch.CreatedAt) <= deviceUnbindUndoWindow
+}
+
+// BatchDeviceUnBindingUndoHandler binds the devices of the batch back to the user within the undo window.
+func BatchDeviceUnBindingUndoHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params struct {
+		BatchID int64 `json:"batch_id"`
+	}
+	if err := c.BindJSON(&params); err != nil || params.BatchID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	batch, err := dao.GetDeviceUnbindBatch(c.Request.Context(), username, params.BatchID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("get device unbind batch: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if !deviceUnbindUndoable(batch, time.Now()) {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceBatchUndoNotAllowed, c))
+		return
+	}
+
+	restored, err := dao.UndoUnbindDevices(c.Request.Context(), username, params.BatchID)
+	if err == dao.ErrDeviceBatchUndone {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceBatchUndoNotAllowed, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("undo unbind devices: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"restored": restored,
+		"skipped":  batch.Total - int64(len(restored)),
+	}))
+}
+
+func GetDeviceUnbindBatchesHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	total, batches, err := dao.ListDeviceUnbindBatches(c.Request.Context(), username, option)
+	if err != nil {
+		log.Errorf("list device unbind batches: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  batches,
+		"total": total,
+	}))
+}
+
+func GetDeviceUnbindBatchHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	id, _ := strconv.ParseInt(c.Query("id"), 10, 64)
+	batch, err := dao.GetDeviceUnbindBatch(c.Request.Context(), username, id)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("get device unbind batch: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	items, err := dao.GetDeviceUnbindItems(c.Request.Context(), batch.ID)
+	if err != nil {
+		log.Errorf("get device unbind items: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"batch":      batch,
+		"items":      items,
+		"undoable":   !batch.Undone && time.Since(batch.CreatedAt) <= deviceUnbindUndoWindow,
+		"undo_until": batch.CreatedAt.Add(deviceUnbindUndoWindow).Format(time.DateTime),
+	}))
+}
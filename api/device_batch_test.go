@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSVRows(t *testing.T) {
+	cases := []struct {
+		name string
+		csv  string
+		want []map[string]string
+	}{
+		{"empty", "", nil},
+		{"no header", "n1,s1,a1\nn2,s2,a2\n", []map[string]string{
+			{"node_id": "n1", "signature": "s1", "area_id": "a1"},
+			{"node_id": "n2", "signature": "s2", "area_id": "a2"},
+		}},
+		{"header", "node_id,signature\nn1,s1\n", []map[string]string{
+			{"node_id": "n1", "signature": "s1"},
+		}},
+		{"header reordered", "Area_ID, Signature, NODE_ID\na1,s1,n1\n", []map[string]string{
+			{"node_id": "n1", "signature": "s1", "area_id": "a1"},
+		}},
+		{"header only", "node_id,signature,area_id\n", nil},
+		{"short rows", "n1\nn2,s2\n", []map[string]string{
+			{"node_id": "n1"},
+			{"node_id": "n2", "signature": "s2"},
+		}},
+		{"extra columns dropped", "n1,s1,a1,extra\n", []map[string]string{
+			{"node_id": "n1", "signature": "s1", "area_id": "a1"},
+		}},
+		{"spaces trimmed", " n1 , s1 \n", []map[string]string{
+			{"node_id": "n1", "signature": "s1"},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := readCSVRows(strings.NewReader(c.csv), "node_id", "signature", "area_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("readCSVRows() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRowsInvalid(t *testing.T) {
+	if _, err := readCSVRows(strings.NewReader("n1,\"s1\n"), "node_id"); err == nil {
+		t.Error("readCSVRows() of an unterminated quote should fail")
+	}
+}
+
+func newBatchContext(req *http.Request) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	return c
+}
+
+func TestParseBatchUnbindParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	writer.WriteField("dry_run", "true")
+	part, _ := writer.CreateFormFile("file", "devices.csv")
+	part.Write([]byte("node_id\nn1\nn2\n"))
+	writer.Close()
+
+	multipartReq := httptest.NewRequest(http.MethodPost, "/", form)
+	multipartReq.Header.Set("Content-Type", writer.FormDataContentType())
+
+	csvReq := httptest.NewRequest(http.MethodPost, "/?dry_run=1", strings.NewReader("n1\nn2\n"))
+	csvReq.Header.Set("Content-Type", "text/csv")
+
+	jsonReq := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"device_ids":["n1","n2"]}`))
+	jsonReq.Header.Set("Content-Type", "application/json")
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		want batchUnbindParams
+	}{
+		{"multipart", multipartReq, batchUnbindParams{DeviceIDs: []string{"n1", "n2"}, DryRun: true}},
+		{"csv body", csvReq, batchUnbindParams{DeviceIDs: []string{"n1", "n2"}, DryRun: true}},
+		{"json", jsonReq, batchUnbindParams{DeviceIDs: []string{"n1", "n2"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseBatchUnbindParams(newBatchContext(c.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, c.want) {
+				t.Errorf("parseBatchUnbindParams() = %+v, want %+v", *got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchBindParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	req := httptest.NewRequest(http.MethodPost, "/?hash=h1&area_id=a1", strings.NewReader("n1,s1\nn2,s2,a2\n"))
+	req.Header.Set("Content-Type", "text/csv")
+
+	got, err := parseBatchBindParams(newBatchContext(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := batchBindParams{Hash: "h1", AreaID: "a1", Items: []*batchBindRow{
+		{NodeID: "n1", Signature: "s1"},
+		{NodeID: "n2", Signature: "s2", AreaID: "a2"},
+	}}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("parseBatchBindParams() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestDeviceUnbindUndoable(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		batch *model.DeviceUnbindBatch
+		want  bool
+	}{
+		{"just unbound", &model.DeviceUnbindBatch{CreatedAt: now.Add(-time.Minute)}, true},
+		{"end of the window", &model.DeviceUnbindBatch{CreatedAt: now.Add(-deviceUnbindUndoWindow)}, true},
+		{"window passed", &model.DeviceUnbindBatch{CreatedAt: now.Add(-deviceUnbindUndoWindow - time.Second)}, false},
+		{"already undone", &model.DeviceUnbindBatch{Undone: true, CreatedAt: now.Add(-time.Minute)}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := deviceUnbindUndoable(c.batch, now); got != c.want {
+				t.Errorf("deviceUnbindUndoable() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxDeviceGroupNameLength = 64
+	maxDeviceTagLength       = 32
+	maxDevicesPerRequest     = 500
+)
+
+// applyDeviceFilter reads the group and the tag the devices are filtered by from the query, they are the group and the
+// tags of the user signed in, so the routes without authentication are not filtered.
+func applyDeviceFilter(c *gin.Context, option *dao.QueryOption) {
+	username, _ := jwt.ExtractClaims(c)[identityKey].(string)
+	if username == "" {
+		return
+	}
+
+	option.FilterUserID = username
+	option.GroupID, _ = strconv.ParseInt(c.Query("group_id"), 10, 64)
+	option.Tag = strings.TrimSpace(c.Query("tag"))
+}
+
+// ownDevices checks all the devices are bound to the user.
+func ownDevices(c *gin.Context, username string, deviceIds []string) (bool, error) {
+	count, err := dao.CountUserDevices(c.Request.Context(), username, deviceIds)
+	if err != nil {
+		return false, err
+	}
+	return count == int64(len(deviceIds)), nil
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]struct{})
+	var out []string
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if _, ok := seen[s]; ok || s == "" {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	return out
+}
+
+func GetDeviceGroupsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	groups, err := dao.ListDeviceGroupStats(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("list device groups: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  groups,
+		"total": len(groups),
+	}))
+}
+
+type deviceGroupParams struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	DeviceIDs []string `json:"device_ids"`
+	Tags      []string `json:"tags"`
+}
+
+func AddDeviceGroupHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params deviceGroupParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxDeviceGroupNameLength {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	_, err := dao.GetDeviceGroupByName(c.Request.Context(), username, name)
+	if err == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceGroupExists, c))
+		return
+	}
+
+	if err != dao.ErrNoRow {
+		log.Errorf("get device group by name: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	group := &model.DeviceGroup{
+		UserID:    username,
+		Name:      name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err = dao.AddDeviceGroup(c.Request.Context(), group); err != nil {
+		log.Errorf("add device group: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"group": group,
+	}))
+}
+
+func UpdateDeviceGroupHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params deviceGroupParams
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxDeviceGroupNameLength {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	existing, err := dao.GetDeviceGroupByName(c.Request.Context(), username, name)
+	if err == nil && existing.ID != params.ID {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceGroupExists, c))
+		return
+	}
+
+	if err != nil && err != dao.ErrNoRow {
+		log.Errorf("get device group by name: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	group := &model.DeviceGroup{
+		ID:        params.ID,
+		UserID:    username,
+		Name:      name,
+		UpdatedAt: time.Now(),
+	}
+
+	err = dao.UpdateDeviceGroup(c.Request.Context(), group)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("update device group: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func DeleteDeviceGroupHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params deviceGroupParams
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	err := dao.DeleteDeviceGroup(c.Request.Context(), username, params.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("delete device group: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+// SetDeviceGroupHandler moves the devices to the group of the id, the zero id takes the devices out of their group.
+func SetDeviceGroupHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params deviceGroupParams
+	if err := c.BindJSON(&params); err != nil || params.ID < 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	deviceIds := uniqueStrings(params.DeviceIDs)
+	if len(deviceIds) == 0 || len(deviceIds) > maxDevicesPerRequest {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	if params.ID > 0 {
+		_, err := dao.GetDeviceGroup(c.Request.Context(), username, params.ID)
+		if err == dao.ErrNoRow {
+			c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+			return
+		}
+
+		if err != nil {
+			log.Errorf("get device group: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			return
+		}
+	}
+
+	owned, err := ownDevices(c, username, deviceIds)
+	if err != nil {
+		log.Errorf("count user devices: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if !owned {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceNotExists, c))
+		return
+	}
+
+	if err = dao.SetDeviceGroup(c.Request.Context(), username, params.ID, deviceIds); err != nil {
+		log.Errorf("set device group: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func GetDeviceTagsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	tags, err := dao.ListDeviceTags(c.Request.Context(), username, c.Query("device_id"))
+	if err != nil {
+		log.Errorf("list device tags: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  tags,
+		"total": len(tags),
+	}))
+}
+
+func AddDeviceTagsHandler(c *gin.Context) {
+	updateDeviceTags(c, dao.AddDeviceTags)
+}
+
+func RemoveDeviceTagsHandler(c *gin.Context) {
+	updateDeviceTags(c, dao.RemoveDeviceTags)
+}
+
+func updateDeviceTags(c *gin.Context, update func(ctx context.Context, userID string, deviceIds, tags []string) error) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params deviceGroupParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	deviceIds := uniqueStrings(params.DeviceIDs)
+	tags := uniqueStrings(params.Tags)
+	if len(deviceIds) == 0 || len(deviceIds) > maxDevicesPerRequest || len(tags) == 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxDeviceTagLength {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+
+	owned, err := ownDevices(c, username, deviceIds)
+	if err != nil {
+		log.Errorf("count user devices: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if !owned {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceNotExists, c))
+		return
+	}
+
+	if err = update(c.Request.Context(), username, deviceIds, tags); err != nil {
+		log.Errorf("update device tags: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"github.com/golang-module/carbon/v2"
+	"net/http"
+	"time"
+)
+
+// GetDeviceReliabilityHandler returns the current uptime and quality score of the device with the daily reliability
+// between from and to, the last 30 days by default.
+func GetDeviceReliabilityHandler(c *gin.Context) {
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	deviceInfo, err := dao.GetDeviceInfoByID(c.Request.Context(), deviceID)
+	if err != nil {
+		log.Errorf("get device info: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if deviceInfo == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.DeviceNotExists, c))
+		return
+	}
+
+	option := dao.QueryOption{
+		StartTime: carbon.Now().SubDays(30).StartOfDay().String(),
+		EndTime:   carbon.Now().EndOfDay().String(),
+	}
+
+	if from := c.Query("from"); from != "" {
+		start, err := time.ParseInLocation(formatter.TimeFormatDateOnly, from, time.Local)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		option.StartTime = start.Format(formatter.TimeFormatDatetime)
+	}
+
+	if to := c.Query("to"); to != "" {
+		end, err := time.ParseInLocation(formatter.TimeFormatDateOnly, to, time.Local)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+		option.EndTime = end.Add(24 * time.Hour).Add(-time.Second).Format(formatter.TimeFormatDatetime)
+	}
+
+	list, err := dao.GetDeviceReliabilityList(c.Request.Context(), deviceID, option)
+	if err != nil {
+		log.Errorf("get device reliability: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"uptime_24h":    deviceInfo.Uptime24h,
+		"uptime_7d":     deviceInfo.Uptime7d,
+		"uptime_30d":    deviceInfo.Uptime30d,
+		"quality_score": deviceInfo.QualityScore,
+		"list":          list,
+		"total":         len(list),
+	}))
+}
@@ -30,7 +30,13 @@ func GetCacheListHandler(c *gin.Context) {
 	//
 
 	// todo: get scheduler from area id
-	resp, err := schedulerApi.GetReplicaEventsForNode(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
+	schedulerClient := getSchedulerApi()
+	if schedulerClient == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
+		return
+	}
+
+	resp, err := schedulerClient.GetReplicaEventsForNode(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
 	if err != nil {
 		log.Errorf("api GetReplicaEventsForNode: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -47,7 +53,13 @@ func GetValidationListHandler(c *gin.Context) {
 	nodeId := c.Query("device_id")
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
 	page, _ := strconv.Atoi(c.Query("page"))
-	resp, err := schedulerApi.GetValidationResults(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
+	schedulerClient := getSchedulerApi()
+	if schedulerClient == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
+		return
+	}
+
+	resp, err := schedulerClient.GetValidationResults(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
 	if err != nil {
 		log.Errorf("api GetValidationResults: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -81,12 +93,14 @@ func GetAllocateStorageHandler(c *gin.Context) {
 	}
 
 	areaId := dao.GetAreaID(c.Request.Context(), userId)
-	schedulerClient, err := getSchedulerClient(c.Request.Context(), areaId)
-	if err != nil {
+	err = withSchedulerClient(c.Request.Context(), areaId, func(schedulerClient api.Scheduler) error {
+		_, err := schedulerClient.AllocateStorage(c.Request.Context(), userId)
+		return err
+	})
+	if err == errNoSchedulerFound {
 		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
 		return
 	}
-	_, err = schedulerClient.AllocateStorage(c.Request.Context(), userId)
 	if err != nil {
 		log.Errorf("api GetValidationResults: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -154,12 +168,15 @@ func GetUserVipInfoHandler(c *gin.Context) {
 func GetUserAccessTokenHandler(c *gin.Context) {
 	UserId := c.Query("user_id")
 	areaId := dao.GetAreaID(c.Request.Context(), UserId)
-	schedulerClient, err := getSchedulerClient(c.Request.Context(), areaId)
-	if err != nil {
+	var token string
+	err := withSchedulerClient(c.Request.Context(), areaId, func(schedulerClient api.Scheduler) (err error) {
+		token, err = schedulerClient.GetUserAccessToken(c.Request.Context(), UserId)
+		return err
+	})
+	if err == errNoSchedulerFound {
 		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
 		return
 	}
-	token, err := schedulerClient.GetUserAccessToken(c.Request.Context(), UserId)
 	if err != nil {
 		log.Errorf("api GetUserAccessToken: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
@@ -286,12 +303,13 @@ func DeleteKeyHandler(c *gin.Context) {
 	userId := c.Query("user_id")
 	keyName := c.Query("key_name")
 	areaId := dao.GetAreaID(c.Request.Context(), userId)
-	schedulerClient, err := getSchedulerClient(c.Request.Context(), areaId)
-	if err != nil {
+	err := withSchedulerClient(c.Request.Context(), areaId, func(schedulerClient api.Scheduler) error {
+		return schedulerClient.DeleteAPIKey(c.Request.Context(), userId, keyName)
+	})
+	if err == errNoSchedulerFound {
 		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
 		return
 	}
-	err = schedulerClient.DeleteAPIKey(c.Request.Context(), userId, keyName)
 	if err != nil {
 		log.Errorf("api DeleteAPIKey: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
@@ -306,12 +324,13 @@ func DeleteAssetHandler(c *gin.Context) {
 	UserId := c.Query("user_id")
 	cid := c.Query("asset_cid")
 	areaId := dao.GetAreaID(c.Request.Context(), UserId)
-	schedulerClient, err := getSchedulerClient(c.Request.Context(), areaId)
-	if err != nil {
+	err := withSchedulerClient(c.Request.Context(), areaId, func(schedulerClient api.Scheduler) error {
+		return schedulerClient.DeleteAsset(c.Request.Context(), UserId, cid)
+	})
+	if err == errNoSchedulerFound {
 		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
 		return
 	}
-	err = schedulerClient.DeleteAsset(c.Request.Context(), UserId, cid)
 	if err != nil {
 		log.Errorf("api DeleteAsset: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -776,7 +795,13 @@ func GetRetrievalListHandler(c *gin.Context) {
 	nodeId := c.Query("device_id")
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
 	page, _ := strconv.Atoi(c.Query("page"))
-	resp, err := schedulerApi.GetRetrieveEventRecords(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
+	schedulerClient := getSchedulerApi()
+	if schedulerClient == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.NoSchedulerFound, c))
+		return
+	}
+
+	resp, err := schedulerClient.GetRetrieveEventRecords(c.Request.Context(), nodeId, pageSize, (page-1)*pageSize)
 	if err != nil {
 		log.Errorf("api GetRetrieveEventRecords: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -37,7 +37,8 @@ type loginResponse struct {
 var identityKey = "id"
 
 func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
-	return jwt.New(&jwt.GinJWTMiddleware{
+	var mw *jwt.GinJWTMiddleware
+	mw = &jwt.GinJWTMiddleware{
 		Realm:             "User",
 		Key:               []byte(secretKey),
 		Timeout:           time.Hour,
@@ -48,6 +49,8 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 			if v, ok := data.(*model.User); ok {
 				return jwt.MapClaims{
 					identityKey: v.Username,
+					roleKey:     v.Role,
+					jtiKey:      newJTI(),
 				}
 			}
 			return jwt.MapClaims{}
@@ -56,9 +59,27 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 			claims := jwt.ExtractClaims(c)
 			return &model.User{
 				Username: claims[identityKey].(string),
+				Role:     roleFromClaims(claims),
 			}
 		},
+		Authorizator: sessionAuthorizator,
 		LoginResponse: func(c *gin.Context, code int, token string, expire time.Time) {
+			parsed, err := mw.ParseTokenString(token)
+			if err != nil {
+				log.Errorf("parse token: %v", err)
+				c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+				return
+			}
+
+			claims := jwt.ExtractClaimsFromToken(parsed)
+			username, _ := claims[identityKey].(string)
+			jti, _ := claims[jtiKey].(string)
+			if err = createSession(c, username, jti); err != nil {
+				log.Errorf("create session: %v", err)
+				c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+				return
+			}
+
 			c.JSON(http.StatusOK, gin.H{
 				"code": 0,
 				"data": loginResponse{
@@ -68,11 +89,20 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 			})
 		},
 		LogoutResponse: func(c *gin.Context, code int) {
+			claims, err := mw.GetClaimsFromJWT(c)
+			if err == nil {
+				username, _ := claims[identityKey].(string)
+				jti, _ := claims[jtiKey].(string)
+				if err = revokeSession(c.Request.Context(), username, jti); err != nil {
+					log.Errorf("revoke session: %v", err)
+				}
+			}
+
 			c.JSON(http.StatusOK, gin.H{
 				"code": 0,
 			})
 		},
-		Authenticator: func(c *gin.Context) (interface{}, error) {
+		Authenticator: func(c *gin.Context) (_ interface{}, err error) {
 			//var loginParams login
 			//if err := c.BindJSON(&loginParams); err != nil {
 			//	return nil, err
@@ -93,18 +123,29 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 
 			signature := c.Query("sign")
 			walletAddress := c.Query("address")
+			mfaToken := c.Query(mfaTokenKey)
 			if loginParams.Username == "" {
 				return "", jwt.ErrMissingLoginValues
 			}
-			if loginParams.VerifyCode == "" && loginParams.Password == "" && signature == "" {
+			if loginParams.VerifyCode == "" && loginParams.Password == "" && signature == "" && mfaToken == "" {
 				return "", jwt.ErrMissingLoginValues
 			}
 
+			lockedFor, lockErr := loginLockedFor(c.Request.Context(), loginParams.Username)
+			if lockErr != nil {
+				log.Errorf("get login lock: %v", lockErr)
+			}
+
+			if lockedFor > 0 {
+				setRetryAfter(c, lockedFor)
+				return nil, errors.NewErrorCode(errors.AccountLocked, c)
+			}
+
 			userAgent := c.Request.Header.Get("User-Agent")
 			ua := user_agent.New(userAgent)
 			os := ua.OS()
 			browser, _ := ua.Browser()
-			clientIP := iptool.GetClientIP(c.Request)
+			clientIP := clientIP(c)
 
 			location, err := GetLocation(c.Request.Context(), clientIP)
 			if err != nil {
@@ -117,8 +158,16 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 			}
 
 			defer func() {
+				// the first step of the login with 2FA is neither a failure nor a success
+				if isTOTPRequired(err) {
+					return
+				}
+
 				if err != nil {
 					log.Errorf("user login: %v", err)
+					if e := recordLoginFailure(c.Request.Context(), config.Cfg.RateLimit, loginParams.Username); e != nil {
+						log.Errorf("record login failure: %v", e)
+					}
 					oplog.AddLoginLog(&model.LoginLog{
 						IpAddress:     clientIP,
 						Browser:       browser,
@@ -132,6 +181,10 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 
 				go SetPeakBandwidth(loginParams.Username)
 
+				if e := resetLoginFailures(c.Request.Context(), loginParams.Username); e != nil {
+					log.Errorf("reset login failures: %v", e)
+				}
+
 				oplog.AddLoginLog(&model.LoginLog{
 					LoginUsername: loginParams.Username,
 					LoginLocation: loginLocation,
@@ -144,26 +197,39 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 
 			}()
 
-			if signature != "" {
-				return loginBySignature(c, loginParams.Username, walletAddress, signature)
+			if mfaToken != "" {
+				return loginByMFAToken(c, loginParams.Username, mfaToken, c.Query("totp_code"))
 			}
 
-			if loginParams.VerifyCode != "" {
-				return loginByVerifyCode(c, loginParams.Username, loginParams.VerifyCode)
+			var user interface{}
+			switch {
+			case signature != "":
+				user, err = loginBySignature(c, loginParams.Username, walletAddress, signature)
+			case loginParams.VerifyCode != "":
+				user, err = loginByVerifyCode(c, loginParams.Username, loginParams.VerifyCode)
+			case loginParams.Password != "":
+				user, err = loginByPassword(c, loginParams.Username, loginParams.Password)
 			}
 
-			if loginParams.Password != "" {
-				return loginByPassword(c, loginParams.Username, loginParams.Password)
+			if err != nil || user == nil {
+				return user, err
 			}
 
-			return nil, nil
+			return requireSecondFactor(c, user.(*model.User))
 		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
-			c.JSON(200, gin.H{
+			resp := gin.H{
 				"code":    code,
 				"msg":     message,
 				"success": false,
-			})
+			}
+
+			// the login needs the second step with the mfa token
+			if token, ok := c.Get(mfaTokenKey); ok {
+				resp[mfaTokenKey] = token
+			}
+
+			c.JSON(200, resp)
 		},
 		// TokenLookup is a string in the form of "<source>:<name>" that is used
 		// to extract token from the request.
@@ -187,7 +253,9 @@ func jwtGinMiddleware(secretKey string) (*jwt.GinJWTMiddleware, error) {
 		RefreshResponse: func(c *gin.Context, code int, token string, t time.Time) {
 			c.Next()
 		},
-	})
+	}
+
+	return jwt.New(mw)
 }
 
 func loginByPassword(c *gin.Context, username, password string) (interface{}, error) {
@@ -219,7 +287,13 @@ func loginBySignature(c *gin.Context, username, address, msg string) (interface{
 	if strings.ToUpper(recoverAddress) != strings.ToUpper(address) {
 		return nil, errors.NewErrorCode(errors.PassWordNotAllowed, c)
 	}
-	return &model.User{Username: username, Role: 0}, nil
+
+	// the wallet may sign in without registration
+	role := model.RoleUser
+	if user, err := dao.GetUserByUsername(c.Request.Context(), username); err == nil {
+		role = user.Role
+	}
+	return &model.User{Username: username, Role: role}, nil
 }
 
 func loginByVerifyCode(c *gin.Context, username, inputCode string) (interface{}, error) {
@@ -263,7 +337,7 @@ func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, jwtauthorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, jwtauthorization, x-totp-code")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// leaderboardParams reads the leaderboard and the scope from the query, the devices are ranked in the country and the
+// node type if both are given, in either of them if one is given, or else globally.
+func leaderboardParams(c *gin.Context) (string, string, bool) {
+	board := c.DefaultQuery("board", dao.LeaderboardCumulativeProfit)
+	if !dao.IsLeaderboard(board) {
+		return "", "", false
+	}
+
+	country := c.Query("country")
+	if c.Query("node_type") == "" {
+		if country != "" {
+			return board, dao.LeaderboardCountryScope(country), true
+		}
+		return board, dao.LeaderboardScopeGlobal, true
+	}
+
+	nodeType, err := strconv.ParseInt(c.Query("node_type"), 10, 64)
+	if err != nil {
+		return "", "", false
+	}
+
+	if country != "" {
+		return board, dao.LeaderboardCountryNodeTypeScope(country, nodeType), true
+	}
+	return board, dao.LeaderboardNodeTypeScope(nodeType), true
+}
+
+// removeDeviceLeaderboards takes the devices deactivated or unbound out of the leaderboards, the failures are left to
+// the prune job.
+func removeDeviceLeaderboards(ctx context.Context, deviceIds ...string) {
+	if err := dao.RemoveDeviceLeaderboards(ctx, deviceIds); err != nil {
+		log.Errorf("remove device leaderboards: %v", err)
+	}
+}
+
+func GetLeaderboardHandler(c *gin.Context) {
+	board, scope, ok := leaderboardParams(c)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	total, list, err := dao.GetLeaderboard(c.Request.Context(), board, scope, option)
+	if err != nil {
+		log.Errorf("get leaderboard: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"board": board,
+		"scope": scope,
+		"list":  list,
+		"total": total,
+	}))
+}
+
+// GetMyLeaderboardPositionHandler returns the positions of the devices of the user on the leaderboard from the best
+// one, only the position of the device if the device id is given.
+func GetMyLeaderboardPositionHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	board, scope, ok := leaderboardParams(c)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	deviceIds, err := dao.GetUserDeviceIDs(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user device ids: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if deviceId := c.Query("device_id"); deviceId != "" {
+		var owned bool
+		for _, id := range deviceIds {
+			if id == deviceId {
+				owned = true
+				break
+			}
+		}
+
+		if !owned {
+			c.JSON(http.StatusOK, respErrorCode(errors.DeviceNotExists, c))
+			return
+		}
+		deviceIds = []string{deviceId}
+	}
+
+	list, err := dao.GetLeaderboardPositions(c.Request.Context(), board, scope, deviceIds)
+	if err != nil {
+		log.Errorf("get leaderboard positions: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Rank < list[j].Rank
+	})
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"board": board,
+		"scope": scope,
+		"list":  list,
+		"total": len(list),
+	}))
+}
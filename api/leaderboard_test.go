@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLeaderboardParams(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		board string
+		scope string
+		ok    bool
+	}{
+		{"default", "", "cumulative_profit", "global", true},
+		{"board", "board=uptime", "uptime", "global", true},
+		{"country", "board=bandwidth&country=CN", "bandwidth", "country:CN", true},
+		{"node type", "node_type=2", "cumulative_profit", "node_type:2", true},
+		{"country and node type", "country=CN&node_type=1", "cumulative_profit", "country:CN:node_type:1", true},
+		{"unknown board", "board=device_rank", "", "", false},
+		{"node type not a number", "node_type=edge", "", "", false},
+		{"node type with country not a number", "country=CN&node_type=1.5", "", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := newClaimsContext(nil)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+c.query, nil)
+
+			board, scope, ok := leaderboardParams(ctx)
+			if board != c.board || scope != c.scope || ok != c.ok {
+				t.Errorf("leaderboardParams(%s) = %s %s %v, want %s %s %v", c.query, board, scope, ok, c.board, c.scope, c.ok)
+			}
+		})
+	}
+}
+
+func TestGetLeaderboardHandlerInvalidParams(t *testing.T) {
+	for _, query := range []string{"board=device_rank", "node_type=edge"} {
+		ctx, w := newClaimsContext(nil)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+
+		GetLeaderboardHandler(ctx)
+		if got := responseErrorCode(t, w); got != errors.InvalidParams {
+			t.Errorf("GetLeaderboardHandler(%s) error = %d, want %d", query, got, errors.InvalidParams)
+		}
+	}
+}
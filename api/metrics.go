@@ -0,0 +1,70 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Number of http requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	schedulerRPCCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "scheduler",
+		Name:      "rpc_calls_total",
+		Help:      "Number of rpc calls to the scheduler.",
+	}, []string{"scheduler"})
+
+	schedulerRPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "scheduler",
+		Name:      "rpc_errors_total",
+		Help:      "Number of rpc calls to the scheduler failed by connection errors.",
+	}, []string{"scheduler"})
+)
+
+// metricsMiddleware records the count and latency of the requests by the route template.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// serveMetrics exposes the metrics at /metrics of the address, it's kept off the api listener as the metrics carry
+// the scheduler urls.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Infof("serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("serve metrics: %v", err)
+	}
+}
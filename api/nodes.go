@@ -122,6 +122,7 @@ func GetUserDeviceProfileHandler(c *gin.Context) {
 		StartTime: c.Query("from"),
 		EndTime:   c.Query("to"),
 	}
+	applyDeviceFilter(c, &option)
 
 	if option.StartTime == "" {
 		option.StartTime = time.Now().AddDate(0, 0, -6).Format(formatter.TimeFormatDateOnly)
@@ -130,7 +131,7 @@ func GetUserDeviceProfileHandler(c *gin.Context) {
 		option.EndTime = time.Now().Format(formatter.TimeFormatDateOnly)
 	}
 
-	userDeviceProfile, err := dao.CountUserDeviceInfo(c.Request.Context(), info.UserID)
+	userDeviceProfile, err := dao.CountUserDeviceInfo(c.Request.Context(), info.UserID, option)
 	if err != nil {
 		log.Errorf("database CountUserDeviceInfo: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
@@ -163,6 +164,7 @@ func GetUserDevicesCountHandler(c *gin.Context) {
 		StartTime: c.Query("from"),
 		EndTime:   c.Query("to"),
 	}
+	applyDeviceFilter(c, &option)
 
 	if option.StartTime == "" {
 		option.StartTime = time.Now().AddDate(0, 0, -6).Format(formatter.TimeFormatDateOnly)
@@ -171,7 +173,7 @@ func GetUserDevicesCountHandler(c *gin.Context) {
 		option.EndTime = time.Now().Format(formatter.TimeFormatDateOnly)
 	}
 
-	userDeviceProfile, err := dao.CountUserDeviceInfo(c.Request.Context(), info.UserID)
+	userDeviceProfile, err := dao.CountUserDeviceInfo(c.Request.Context(), info.UserID, option)
 	if err != nil {
 		log.Errorf("GetUserDevicesCountHandler CountUserDeviceInfo: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
@@ -234,10 +236,13 @@ func queryDeviceStatisticsDaily(deviceID, startTime, endTime string) []*dao.Devi
 	return list
 }
 
-func queryDeviceDailyByUserId(userId, startTime, endTime string) []*dao.DeviceStatistics {
+func queryDeviceDailyByUserId(userId, startTime, endTime string, filter dao.QueryOption) []*dao.DeviceStatistics {
 	option := dao.QueryOption{
-		StartTime: startTime,
-		EndTime:   endTime,
+		StartTime:    startTime,
+		EndTime:      endTime,
+		GroupID:      filter.GroupID,
+		Tag:          filter.Tag,
+		FilterUserID: filter.FilterUserID,
 	}
 	if startTime == "" {
 		option.StartTime = carbon.Now().SubDays(14).StartOfDay().String()
@@ -305,6 +310,7 @@ func GetQueryInfoHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	applyDeviceFilter(c, &option)
 
 	deviceInfos, total, err := dao.GetDeviceInfoListByKey(c.Request.Context(), info, option)
 	if err != nil {
@@ -398,6 +404,7 @@ func GetDeviceInfoHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	applyDeviceFilter(c, &option)
 
 	deviceInfos, total, err := dao.GetDeviceInfoList(c.Request.Context(), info, option)
 	if err != nil {
@@ -469,6 +476,7 @@ func GetDeviceActiveInfoHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	applyDeviceFilter(c, &option)
 	list, total, err := dao.GetDeviceActiveInfoList(c.Request.Context(), info, option)
 	if err != nil {
 		log.Errorf("GetDeviceActiveInfoHandler GetDeviceActiveInfoList: %v", err)
@@ -498,6 +506,7 @@ func GetDeviceStatusHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	applyDeviceFilter(c, &option)
 
 	deviceInfos, total, err := dao.GetDeviceInfoList(c.Request.Context(), info, option)
 	if err != nil {
@@ -568,6 +577,7 @@ func GetMapInfoHandler(c *gin.Context) {
 		Order:      order,
 		OrderField: orderField,
 	}
+	applyDeviceFilter(c, &option)
 
 	deviceInfos, total, err := dao.GetDeviceInfoList(c.Request.Context(), info, option)
 	if err != nil {
@@ -596,7 +606,9 @@ func GetDeviceDiagnosisDailyByUserIdHandler(c *gin.Context) {
 	from := c.Query("from")
 	to := c.Query("to")
 	userId := c.Query("user_id")
-	m := queryDeviceDailyByUserId(userId, from, to)
+	var filter dao.QueryOption
+	applyDeviceFilter(c, &filter)
+	m := queryDeviceDailyByUserId(userId, from, to, filter)
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"series_data": m,
 	}))
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rateLimitKeyIP       = "ip"
+	rateLimitKeyUsername = "username"
+	rateLimitKeyAPIKey   = "api_key"
+)
+
+// slidingWindowScript counts the requests in the window with a sorted set scored by the request time in milliseconds,
+// it returns 1 if the request is allowed, otherwise 0 and the milliseconds until the oldest request leaves the window.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return {1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, window - (now - tonumber(oldest[2]))}
+`)
+
+type rateLimiter struct {
+	cfg config.RateLimitConfig
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	return &rateLimiter{cfg: cfg}
+}
+
+// Limit limits the requests by the policy of the group, the requests pass if the group has no policy.
+// The limiter fails open if redis is unavailable.
+func (rl *rateLimiter) Limit(group string) gin.HandlerFunc {
+	policy, ok := rl.cfg.Policies[group]
+	if rl.cfg.Disable || !ok || policy.Limit <= 0 || policy.Window <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		for _, kind := range policy.Keys {
+			id := rateLimitIdentity(c, kind)
+			if id == "" {
+				continue
+			}
+
+			key := fmt.Sprintf("TITAN::RATELIMIT::%s::%s::%s", group, kind, id)
+			allowed, retryAfter, err := allowRequest(c.Request.Context(), key, policy)
+			if err != nil {
+				log.Errorf("rate limit %s: %v", key, err)
+				continue
+			}
+
+			if !allowed {
+				setRetryAfter(c, retryAfter)
+				c.JSON(http.StatusTooManyRequests, respErrorCode(errors.TooManyRequests, c))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func allowRequest(ctx context.Context, key string, policy config.RateLimitPolicy) (bool, time.Duration, error) {
+	now := time.Now().UnixMilli()
+	result, err := slidingWindowScript.Run(ctx, dao.RedisCache, []string{key},
+		now, policy.Window.Milliseconds(), policy.Limit, fmt.Sprintf("%d-%s", now, uuid.NewString())).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected result: %v", result)
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// rateLimitIdentity returns what the request is counted by, the api keys are hashed to keep them out of redis. The ip
+// comes from the proxy headers only for the trusted proxies, or a client could rotate it for a fresh window.
+func rateLimitIdentity(c *gin.Context, kind string) string {
+	switch kind {
+	case rateLimitKeyIP:
+		return clientIP(c)
+	case rateLimitKeyUsername:
+		if username := c.Query("username"); username != "" {
+			return username
+		}
+		username, _ := jwt.ExtractClaims(c)[identityKey].(string)
+		return username
+	case rateLimitKeyAPIKey:
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	default:
+		return ""
+	}
+}
+
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+func getRedisLoginFailuresKey(username string) string {
+	return fmt.Sprintf("TITAN::LOGIN_FAILURES::%s", username)
+}
+
+func getRedisLoginLockKey(username string) string {
+	return fmt.Sprintf("TITAN::LOGIN_LOCK::%s", username)
+}
+
+// loginLockedFor returns how long the account is still locked, 0 if it's not locked.
+func loginLockedFor(ctx context.Context, username string) (time.Duration, error) {
+	ttl, err := dao.RedisCache.PTTL(ctx, getRedisLoginLockKey(username)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// the key doesn't exist or has no expiration
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// recordLoginFailure counts the failed login and locks the account once the failures reach the limit.
+func recordLoginFailure(ctx context.Context, cfg config.RateLimitConfig, username string) error {
+	if cfg.Disable || cfg.LoginMaxFailures <= 0 || cfg.LoginLockDuration <= 0 {
+		return nil
+	}
+
+	key := getRedisLoginFailuresKey(username)
+	failures, err := dao.RedisCache.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	if failures == 1 && cfg.LoginFailureWindow > 0 {
+		if err = dao.RedisCache.Expire(ctx, key, cfg.LoginFailureWindow).Err(); err != nil {
+			return err
+		}
+	}
+
+	if failures < int64(cfg.LoginMaxFailures) {
+		return nil
+	}
+
+	log.Warnf("lock user %s for %s after %d failed logins", username, cfg.LoginLockDuration, failures)
+
+	pipe := dao.RedisCache.TxPipeline()
+	pipe.Set(ctx, getRedisLoginLockKey(username), failures, cfg.LoginLockDuration)
+	pipe.Del(ctx, key)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func resetLoginFailures(ctx context.Context, username string) error {
+	return dao.RedisCache.Del(ctx, getRedisLoginFailuresKey(username)).Err()
+}
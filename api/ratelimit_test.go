@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gnasnik/titan-explorer/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitIdentity(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	hashed := hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name   string
+		kind   string
+		target string
+		header map[string]string
+		claims map[string]interface{}
+		want   string
+	}{
+		{"ip", rateLimitKeyIP, "/", nil, nil, "192.0.2.1"},
+		{"spoofed ip", rateLimitKeyIP, "/", map[string]string{"X-Real-IP": "8.8.8.8", "X-Forwarded-For": "8.8.8.8"}, nil, "192.0.2.1"},
+		{"username of the query", rateLimitKeyUsername, "/?username=bob", nil, map[string]interface{}{identityKey: "alice"}, "bob"},
+		{"username of the token", rateLimitKeyUsername, "/", nil, map[string]interface{}{identityKey: "alice"}, "alice"},
+		{"no username", rateLimitKeyUsername, "/", nil, nil, ""},
+		{"api key hashed", rateLimitKeyAPIKey, "/", map[string]string{"Authorization": "Bearer secret"}, nil, hashed},
+		{"no api key", rateLimitKeyAPIKey, "/", nil, nil, ""},
+		{"unknown kind", "cookie", "/", nil, nil, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := newClaimsContext(c.claims)
+			ctx.Request = httptest.NewRequest(http.MethodGet, c.target, nil)
+			for k, v := range c.header {
+				ctx.Request.Header.Set(k, v)
+			}
+
+			if got := rateLimitIdentity(ctx, c.kind); got != c.want {
+				t.Errorf("rateLimitIdentity(%s) = %q, want %q", c.kind, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitIdentityTrustedProxy(t *testing.T) {
+	trusted := config.Cfg.TrustedProxies
+	config.Cfg.TrustedProxies = []string{"192.0.2.0/24"}
+	defer func() { config.Cfg.TrustedProxies = trusted }()
+
+	// httptest requests come from 192.0.2.1
+	ctx, _ := newClaimsContext(nil)
+	ctx.Request.Header.Set("X-Forwarded-For", "8.8.8.8")
+	if got := rateLimitIdentity(ctx, rateLimitKeyIP); got != "8.8.8.8" {
+		t.Errorf("rateLimitIdentity() = %s, want the forwarded address of the trusted proxy", got)
+	}
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	}
+
+	for _, c := range cases {
+		ctx, w := newClaimsContext(nil)
+		setRetryAfter(ctx, c.d)
+		if got := w.Header().Get("Retry-After"); got != c.want {
+			t.Errorf("setRetryAfter(%s) = %s, want %s", c.d, got, c.want)
+		}
+	}
+}
+
+// TestRateLimiterPasses checks the requests pass when nothing is limited and when redis is unavailable.
+func TestRateLimiterPasses(t *testing.T) {
+	useUnreachableRedis(t)
+
+	policy := config.RateLimitPolicy{Limit: 1, Window: time.Minute, Keys: []string{rateLimitKeyIP}}
+
+	cases := []struct {
+		name  string
+		cfg   config.RateLimitConfig
+		group string
+	}{
+		{"disabled", config.RateLimitConfig{Disable: true, Policies: map[string]config.RateLimitPolicy{"login": policy}}, "login"},
+		{"group without policy", config.RateLimitConfig{Policies: map[string]config.RateLimitPolicy{"login": policy}}, "nonce"},
+		{"policy without limit", config.RateLimitConfig{Policies: map[string]config.RateLimitPolicy{"login": {Window: time.Minute}}}, "login"},
+		{"fails open", config.RateLimitConfig{Policies: map[string]config.RateLimitPolicy{"login": policy}}, "login"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, w := newClaimsContext(jwt.MapClaims{})
+			newRateLimiter(c.cfg).Limit(c.group)(ctx)
+			if ctx.IsAborted() || w.Code != http.StatusOK {
+				t.Errorf("status = %d aborted %v, want the request passed", w.Code, ctx.IsAborted())
+			}
+		})
+	}
+}
+
+func TestRecordLoginFailureDisabled(t *testing.T) {
+	useUnreachableRedis(t)
+
+	cases := []struct {
+		name string
+		cfg  config.RateLimitConfig
+	}{
+		{"disabled", config.RateLimitConfig{Disable: true, LoginMaxFailures: 5, LoginLockDuration: time.Minute}},
+		{"no max failures", config.RateLimitConfig{LoginLockDuration: time.Minute}},
+		{"no lock duration", config.RateLimitConfig{LoginMaxFailures: 5}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// redis is unreachable, so no error tells nothing is counted
+			if err := recordLoginFailure(context.Background(), c.cfg, "alice"); err != nil {
+				t.Errorf("recordLoginFailure() = %v, want nothing counted", err)
+			}
+		})
+	}
+
+	enabled := config.RateLimitConfig{LoginMaxFailures: 5, LoginLockDuration: time.Minute}
+	if err := recordLoginFailure(context.Background(), enabled, "alice"); err == nil {
+		t.Error("recordLoginFailure() should count the failure when the lockout is enabled")
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/oplog"
+	"net/http"
+	"time"
+)
+
+// roleKey is the claim carrying the role of the user.
+const roleKey = "role"
+
+const (
+	operationStatusFailure int32 = iota
+	operationStatusSuccess
+)
+
+type Permission string
+
+const (
+	PermCacheRead      Permission = "cache:read"
+	PermCacheWrite     Permission = "cache:write"
+	PermLogRead        Permission = "log:read"
+	PermStatisticRead  Permission = "statistic:read"
+	PermStatisticWrite Permission = "statistic:write"
+	PermBackupRead     Permission = "backup:read"
+	PermBackupWrite    Permission = "backup:write"
+	PermRoleManage     Permission = "role:manage"
+	PermWithdrawRead   Permission = "withdraw:read"
+	PermWithdrawWrite  Permission = "withdraw:write"
+	PermReferralRead   Permission = "referral:read"
+	PermReferralWrite  Permission = "referral:write"
+)
+
+var readPermissions = []Permission{PermCacheRead, PermLogRead, PermStatisticRead, PermBackupRead, PermWithdrawRead, PermReferralRead}
+
+// rolePermissions are the permissions of the roles, the admin has all permissions.
+var rolePermissions = map[model.Role][]Permission{
+	model.RoleOperator: append([]Permission{PermCacheWrite, PermStatisticWrite, PermBackupWrite, PermWithdrawWrite}, readPermissions...),
+	model.RoleReadOnly: readPermissions,
+}
+
+func hasPermission(role model.Role, perm Permission) bool {
+	if role == model.RoleAdmin {
+		return true
+	}
+
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roleFromClaims returns the role in the claims, the tokens without role belong to the registered users.
+func roleFromClaims(claims jwt.MapClaims) model.Role {
+	role, ok := claims[roleKey].(float64)
+	if !ok {
+		return model.RoleUser
+	}
+	return model.Role(role)
+}
+
+// RequirePermission aborts the request if the role of the user doesn't have the permission,
+// it must be used after the MiddlewareFunc of the jwt middleware.
+func RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := roleFromClaims(jwt.ExtractClaims(c))
+		if !hasPermission(role, perm) {
+			c.JSON(http.StatusOK, respErrorCode(errors.PermissionDenied, c))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func parseRole(name string) (model.Role, bool) {
+	for role, n := range model.RoleNames {
+		if n == name {
+			return role, true
+		}
+	}
+	return 0, false
+}
+
+type roleParams struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func GrantRoleHandler(c *gin.Context) {
+	var params roleParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	role, ok := parseRole(params.Role)
+	if params.Username == "" || !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	setUserRole(c, oplog.BusinessTypeGrantRole, "grant role", params, role)
+}
+
+func RevokeRoleHandler(c *gin.Context) {
+	var params roleParams
+	if err := c.BindJSON(&params); err != nil || params.Username == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	params.Role = model.RoleNames[model.RoleUser]
+	setUserRole(c, oplog.BusinessTypeRevokeRole, "revoke role", params, model.RoleUser)
+}
+
+// setUserRole updates the role and revokes the sessions of the user so the new role takes effect on the next login,
+// the change is recorded to the operation log.
+func setUserRole(c *gin.Context, businessType int32, title string, params roleParams, role model.Role) {
+	claims := jwt.ExtractClaims(c)
+	operator := claims[identityKey].(string)
+
+	err := dao.UpdateUserRole(c.Request.Context(), params.Username, role)
+	addRoleOperationLog(c, businessType, title, operator, params, err)
+
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("update user role: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err = revokeUserSessions(c.Request.Context(), params.Username); err != nil {
+		log.Errorf("revoke sessions: %v", err)
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+func addRoleOperationLog(c *gin.Context, businessType int32, title, operator string, params roleParams, err error) {
+	param, _ := json.Marshal(params)
+
+	operationLog := &model.OperationLog{
+		Title:            title,
+		BusinessType:     businessType,
+		Method:           c.HandlerName(),
+		RequestMethod:    c.Request.Method,
+		OperatorUsername: operator,
+		OperatorUrl:      c.Request.URL.Path,
+		OperatorIp:       clientIP(c),
+		OperatorParam:    string(param),
+		Status:           operationStatusSuccess,
+		CreatedAt:        time.Now(),
+	}
+
+	if err != nil {
+		operationLog.Status = operationStatusFailure
+		operationLog.ErrorMsg = err.Error()
+	}
+
+	oplog.AddOperationLog(operationLog)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"net/http"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	cases := []struct {
+		role model.Role
+		perm Permission
+		want bool
+	}{
+		{model.RoleAdmin, PermRoleManage, true},
+		{model.RoleAdmin, PermReferralWrite, true},
+		{model.RoleOperator, PermCacheWrite, true},
+		{model.RoleOperator, PermWithdrawWrite, true},
+		{model.RoleOperator, PermLogRead, true},
+		{model.RoleOperator, PermRoleManage, false},
+		{model.RoleOperator, PermReferralWrite, false},
+		{model.RoleReadOnly, PermStatisticRead, true},
+		{model.RoleReadOnly, PermWithdrawRead, true},
+		{model.RoleReadOnly, PermStatisticWrite, false},
+		{model.RoleReadOnly, PermWithdrawWrite, false},
+		{model.RoleUser, PermLogRead, false},
+		{model.Role(42), PermLogRead, false},
+	}
+
+	for _, c := range cases {
+		if got := hasPermission(c.role, c.perm); got != c.want {
+			t.Errorf("hasPermission(%s, %s) = %v, want %v", model.RoleNames[c.role], c.perm, got, c.want)
+		}
+	}
+}
+
+func TestRoleFromClaims(t *testing.T) {
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   model.Role
+	}{
+		{"no role", jwt.MapClaims{}, model.RoleUser},
+		{"admin", jwt.MapClaims{roleKey: float64(model.RoleAdmin)}, model.RoleAdmin},
+		{"read-only", jwt.MapClaims{roleKey: float64(model.RoleReadOnly)}, model.RoleReadOnly},
+		{"not a number", jwt.MapClaims{roleKey: "admin"}, model.RoleUser},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := roleFromClaims(c.claims); got != c.want {
+				t.Errorf("roleFromClaims() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for role, name := range model.RoleNames {
+		if got, ok := parseRole(name); !ok || got != role {
+			t.Errorf("parseRole(%s) = %d %v, want %d", name, got, ok, role)
+		}
+	}
+
+	if _, ok := parseRole("root"); ok {
+		t.Error("parseRole() of an unknown role should fail")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		err    int
+	}{
+		{"admin", jwt.MapClaims{identityKey: "alice", roleKey: float64(model.RoleAdmin)}, 0},
+		{"operator", jwt.MapClaims{identityKey: "alice", roleKey: float64(model.RoleOperator)}, 0},
+		{"read-only", jwt.MapClaims{identityKey: "alice", roleKey: float64(model.RoleReadOnly)}, errors.PermissionDenied},
+		{"user", jwt.MapClaims{identityKey: "alice"}, errors.PermissionDenied},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, w := newClaimsContext(c.claims)
+			RequirePermission(PermCacheWrite)(ctx)
+			if ctx.IsAborted() != (c.err != 0) || w.Code != http.StatusOK {
+				t.Fatalf("status = %d aborted %v, want %d aborted %v", w.Code, ctx.IsAborted(), http.StatusOK, c.err != 0)
+			}
+			if c.err != 0 {
+				if got := responseErrorCode(t, w); got != c.err {
+					t.Errorf("error = %d, want %d", got, c.err)
+				}
+			}
+		})
+	}
+}
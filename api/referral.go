@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/referral"
+	"net/http"
+	"time"
+)
+
+// matchReferralPolicy returns the policy paying the direct referrer now, nil if there is none.
+func matchReferralPolicy(ctx context.Context, referrer *model.User) (*model.ReferralPolicy, error) {
+	policies, err := referral.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referees, err := dao.CountReferees(ctx, referrer.ReferralCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return policies.Match(1, referees, time.Now()), nil
+}
+
+// addReferralReward pays the referrer of the user the invite or the bind reward of the policy in effect.
+func addReferralReward(ctx context.Context, referrer *model.User, fromUser string, event model.RewardEvent, deviceId string) error {
+	policy, err := matchReferralPolicy(ctx, referrer)
+	if err != nil {
+		return err
+	}
+
+	var amount int64
+	if policy != nil {
+		switch event {
+		case model.RewardEventInviteFrens:
+			amount = policy.InviteReward
+		case model.RewardEventBindDevice:
+			amount = policy.BindReward
+		}
+	}
+
+	return dao.UpdateUserReward(ctx, &model.RewardStatement{
+		Username:  referrer.Username,
+		FromUser:  fromUser,
+		Amount:    amount,
+		Event:     event,
+		Status:    1,
+		DeviceId:  deviceId,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+}
+
+// addBindDeviceReward pays the bind reward to the referrer of the user, only the first binding of a device is paid.
+func addBindDeviceReward(ctx context.Context, username, deviceId string) error {
+	_, err := dao.GetRewardStatementByDeviceID(ctx, deviceId)
+	if err == nil {
+		return nil
+	}
+
+	if err != dao.ErrNoRow {
+		return err
+	}
+
+	referrer, err := dao.GetUsersReferrer(ctx, username)
+	if err == dao.ErrNoRow {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return addReferralReward(ctx, referrer, username, model.RewardEventBindDevice, deviceId)
+}
+
+func GetReferralPoliciesHandler(c *gin.Context) {
+	policies, err := dao.ListReferralPolicies(c.Request.Context(), false)
+	if err != nil {
+		log.Errorf("list referral policies: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  policies,
+		"total": len(policies),
+	}))
+}
+
+func validReferralPolicy(p *model.ReferralPolicy) bool {
+	if p.Level < 1 || p.Percentage < 0 || p.Percentage > 100 {
+		return false
+	}
+
+	if p.MinReferees < 0 || p.MaxReward < 0 || p.InviteReward < 0 || p.BindReward < 0 {
+		return false
+	}
+
+	return p.StartAt.IsZero() || p.EndAt.IsZero() || p.StartAt.Before(p.EndAt)
+}
+
+func AddReferralPolicyHandler(c *gin.Context) {
+	var policy model.ReferralPolicy
+	if err := c.BindJSON(&policy); err != nil || !validReferralPolicy(&policy) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	policy.ID = 0
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = time.Now()
+
+	if err := dao.AddReferralPolicy(c.Request.Context(), &policy); err != nil {
+		log.Errorf("add referral policy: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"policy": policy,
+	}))
+}
+
+func UpdateReferralPolicyHandler(c *gin.Context) {
+	var policy model.ReferralPolicy
+	if err := c.BindJSON(&policy); err != nil || policy.ID <= 0 || !validReferralPolicy(&policy) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	policy.UpdatedAt = time.Now()
+
+	err := dao.UpdateReferralPolicy(c.Request.Context(), &policy)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("update referral policy: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"policy": policy,
+	}))
+}
+
+func DeleteReferralPolicyHandler(c *gin.Context) {
+	var params struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	err := dao.DeleteReferralPolicy(c.Request.Context(), params.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("delete referral policy: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// PreviewReferralPolicyHandler compares the referral rewards of the earnings today before and after the change,
+// the change adds the policy, replaces the policy of the same id, or deletes it if delete is set.
+func PreviewReferralPolicyHandler(c *gin.Context) {
+	var params struct {
+		Policy model.ReferralPolicy `json:"policy"`
+		Delete bool                 `json:"delete"`
+	}
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	if (params.Delete && params.Policy.ID <= 0) || (!params.Delete && !validReferralPolicy(&params.Policy)) {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	current, err := dao.ListReferralPolicies(c.Request.Context(), false)
+	if err != nil {
+		log.Errorf("list referral policies: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	proposed := referral.Policies(current).With(&params.Policy)
+	if params.Delete {
+		proposed = referral.Policies(current).Without(params.Policy.ID)
+	}
+
+	impact, err := referral.Preview(c.Request.Context(), current, proposed, time.Now())
+	if err != nil {
+		log.Errorf("preview referral policy: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(impact))
+}
+
+// getReferralPolicyInfo returns the policy the user is paid by as a referrer and the next tier to reach.
+func getReferralPolicyInfo(c *gin.Context, username string) (JsonObject, error) {
+	user, err := dao.GetUserByUsername(c.Request.Context(), username)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := referral.Load(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	referees, err := dao.CountReferees(c.Request.Context(), user.ReferralCode)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return JsonObject{
+		"referees":  referees,
+		"depth":     policies.Depth(),
+		"policy":    policies.Match(1, referees, now),
+		"next_tier": policies.NextTier(1, referees, now),
+	}, nil
+}
@@ -9,15 +9,20 @@ import (
 var log = logging.Logger("api")
 
 func RegisterRouters(route *gin.Engine, cfg config.Config) {
-	RegisterRouterWithJWT(route, cfg)
-	RegisterRouterWithAPIKey(route)
+	route.Use(metricsMiddleware())
+
+	limiter := newRateLimiter(cfg.RateLimit)
+	RegisterRouterWithJWT(route, cfg, limiter)
+	RegisterRouterWithAPIKey(route, limiter)
 }
 
-func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
+func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config, limiter *rateLimiter) {
 	apiV1 := router.Group("/api/v1")
 	apiV2 := router.Group("/api/v2")
 	link := router.Group("/link")
 
+	apiV2.Use(limiter.Limit("dashboard"))
+
 	authMiddleware, err := jwtGinMiddleware(cfg.SecretKey)
 	if err != nil {
 		log.Fatalf("jwt auth middleware: %v", err)
@@ -29,7 +34,7 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	}
 
 	// testnet
-	apiV2.POST("/subscribe", SubscribeHandler)
+	apiV2.POST("/subscribe", limiter.Limit("subscribe"), SubscribeHandler)
 
 	// dashboard
 	// Deprecated: use /height instead
@@ -44,10 +49,12 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 
 	// index info all nodes info from device info
 	apiV2.GET("/get_nodes_info", GetNodesInfoHandler)
+	apiV2.GET("/leaderboard", GetLeaderboardHandler)
 	apiV2.GET("/get_device_info", GetDeviceInfoHandler)
 	apiV2.GET("/get_device_status", GetDeviceStatusHandler)
 	apiV2.GET("/get_map_info", GetMapInfoHandler)
 	apiV2.GET("/get_device_info_daily", GetDeviceInfoDailyHandler)
+	apiV2.GET("/device/reliability", GetDeviceReliabilityHandler)
 	apiV2.GET("/get_diagnosis_days", GetDeviceDiagnosisDailyByDeviceIdHandler)
 	// by-user_id or all node count
 	apiV2.GET("/get_diagnosis_days_user", GetDeviceDiagnosisDailyByUserIdHandler)
@@ -65,8 +72,8 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	apiV2.GET("/get_cache_list", GetCacheListHandler)
 	apiV2.GET("/get_retrieval_list", GetRetrievalListHandler)
 	apiV2.GET("/get_validation_list", GetValidationListHandler)
-	apiV2.GET("/login_before", GetNonceStringHandler)
-	apiV2.POST("/login", authMiddleware.LoginHandler)
+	apiV2.GET("/login_before", limiter.Limit("nonce"), GetNonceStringHandler)
+	apiV2.POST("/login", limiter.Limit("login"), authMiddleware.LoginHandler)
 	apiV2.POST("/logout", authMiddleware.LogoutHandler)
 	apiV2.GET("/get_user_device_count", GetUserDevicesCountHandler)
 
@@ -79,9 +86,28 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	apiV2.GET("/device_unbinding", DeviceUnBindingHandlerOld)
 	apiV2.GET("/get_user_device_profile", GetUserDeviceProfileHandler)
 	apiV2.GET("/get_device_active_info", GetDeviceActiveInfoHandler)
-	apiV2.POST("/wallet/bind", BindWalletHandler)
+	apiV2.GET("/device_events", GetDeviceEventsHandler)
+	apiV2.GET("/device_alert_rules", GetDeviceAlertRulesHandler)
+	apiV2.POST("/device_alert_rule/add", AddDeviceAlertRuleHandler)
+	apiV2.POST("/device_alert_rule/update", UpdateDeviceAlertRuleHandler)
+	apiV2.POST("/device_alert_rule/delete", DeleteDeviceAlertRuleHandler)
+	apiV2.GET("/device_groups", GetDeviceGroupsHandler)
+	apiV2.POST("/device_group/add", AddDeviceGroupHandler)
+	apiV2.POST("/device_group/update", UpdateDeviceGroupHandler)
+	apiV2.POST("/device_group/delete", DeleteDeviceGroupHandler)
+	apiV2.POST("/device_group/devices", SetDeviceGroupHandler)
+	apiV2.GET("/device_tags", GetDeviceTagsHandler)
+	apiV2.POST("/device_tag/add", AddDeviceTagsHandler)
+	apiV2.POST("/device_tag/remove", RemoveDeviceTagsHandler)
+	apiV2.POST("/device/batch_binding", BatchDeviceBindingHandler)
+	apiV2.POST("/device/batch_unbinding", BatchDeviceUnBindingHandler)
+	apiV2.POST("/device/batch_unbinding/undo", BatchDeviceUnBindingUndoHandler)
+	apiV2.GET("/device/batch_unbindings", GetDeviceUnbindBatchesHandler)
+	apiV2.GET("/device/batch_unbinding", GetDeviceUnbindBatchHandler)
+	apiV2.GET("/leaderboard/position", GetMyLeaderboardPositionHandler)
+	apiV2.POST("/wallet/bind", RequireTOTP(), BindWalletHandler)
 	apiV2.POST("/wallet/unbind", UnBindWalletHandler)
-	apiV2.POST("/withdraw", WithdrawHandler)
+	apiV2.POST("/withdraw", RequireTOTP(), WithdrawHandler)
 	apiV2.GET("/referral_list", GetReferralListHandler)
 	apiV2.GET("/withdraw_list", GetWithdrawListHandler)
 	apiV2.GET("/generate/code", GenerateCodeHandler)
@@ -90,37 +116,70 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	user := apiV1.Group("/user")
 	user.POST("/register", UserRegister)
 	user.POST("/password_reset", PasswordRest)
-	user.GET("/verify_code", GetNumericVerifyCodeHandler)
-	user.POST("/login", authMiddleware.LoginHandler)
+	user.GET("/verify_code", limiter.Limit("nonce"), GetNumericVerifyCodeHandler)
+	user.POST("/login", limiter.Limit("login"), authMiddleware.LoginHandler)
 	user.POST("/logout", authMiddleware.LogoutHandler)
 	user.Use(authMiddleware.MiddlewareFunc())
 	user.GET("/refresh_token", authMiddleware.RefreshHandler)
 	user.POST("/info", GetUserInfoHandler)
+	user.GET("/sessions", GetSessionsHandler)
+	user.POST("/logout_all", LogoutAllHandler)
+	user.GET("/2fa", GetTOTPStatusHandler)
+	user.POST("/2fa/enroll", EnrollTOTPHandler)
+	user.POST("/2fa/activate", ActivateTOTPHandler)
+	user.POST("/2fa/disable", DisableTOTPHandler)
+	user.POST("/2fa/recovery_codes", RegenerateRecoveryCodesHandler)
+	user.GET("/wallets", GetUserWalletsHandler)
+	user.POST("/wallet/challenge", limiter.Limit("nonce"), WalletChallengeHandler)
+	user.POST("/wallet/bind", RequireTOTP(), BindUserWalletHandler)
+	user.POST("/wallet/unbind", RequireTOTP(), UnbindUserWalletHandler)
+	user.POST("/wallet/primary", RequireTOTP(), SetPrimaryWalletHandler)
 
 	// admin
 	admin := apiV1.Group("/admin")
 	admin.Use(authMiddleware.MiddlewareFunc())
-	admin.GET("/cache_list", GetCacheTaskListHandler)
-	admin.GET("/cache_info", GetCacheTaskInfoHandler)
-	admin.POST("/add_cache", AddCacheTaskHandler)
-	admin.POST("/delete_cache", DeleteCacheTaskHandler)
-	admin.POST("/delete_device_cache", DeleteCacheTaskByDeviceHandler)
-	admin.GET("/get_cache_info", GetCarFileInfoHandler)
-	admin.GET("/get_login_log", GetLoginLogHandler)
-	admin.GET("/get_operation_log", GetOperationLogHandler)
-	admin.GET("/get_node_daily_trend", GetNodeDailyTrendHandler)
+	admin.GET("/cache_list", RequirePermission(PermCacheRead), GetCacheTaskListHandler)
+	admin.GET("/cache_info", RequirePermission(PermCacheRead), GetCacheTaskInfoHandler)
+	admin.POST("/add_cache", RequirePermission(PermCacheWrite), AddCacheTaskHandler)
+	admin.POST("/delete_cache", RequirePermission(PermCacheWrite), DeleteCacheTaskHandler)
+	admin.POST("/delete_device_cache", RequirePermission(PermCacheWrite), DeleteCacheTaskByDeviceHandler)
+	admin.GET("/get_cache_info", RequirePermission(PermCacheRead), GetCarFileInfoHandler)
+	admin.GET("/get_login_log", RequirePermission(PermLogRead), GetLoginLogHandler)
+	admin.GET("/get_operation_log", RequirePermission(PermLogRead), GetOperationLogHandler)
+	admin.GET("/get_node_daily_trend", RequirePermission(PermStatisticRead), GetNodeDailyTrendHandler)
+	admin.GET("/statistic_runs", RequirePermission(PermStatisticRead), GetStatisticRunsHandler)
+	admin.POST("/statistic_trigger", RequirePermission(PermStatisticWrite), TriggerStatisticJobHandler)
+	admin.GET("/reward_reconciliations", RequirePermission(PermStatisticRead), GetRewardReconciliationsHandler)
+	admin.GET("/backup_stats", RequirePermission(PermBackupRead), GetBackupStatsHandler)
+	admin.GET("/backup_overview", RequirePermission(PermBackupRead), GetBackupOverviewHandler)
+	admin.GET("/backup_failed", RequirePermission(PermBackupRead), GetFailedBackupAssetsHandler)
+	admin.POST("/backup_reset_failed", RequirePermission(PermBackupWrite), ResetFailedBackupAssetsHandler)
+	admin.POST("/grant_role", RequirePermission(PermRoleManage), GrantRoleHandler)
+	admin.POST("/revoke_role", RequirePermission(PermRoleManage), RevokeRoleHandler)
+	admin.GET("/withdraw_list", RequirePermission(PermWithdrawRead), GetWithdrawRequestsHandler)
+	admin.GET("/withdraw_audits", RequirePermission(PermWithdrawRead), GetWithdrawAuditsHandler)
+	admin.POST("/withdraw/approve", RequirePermission(PermWithdrawWrite), ApproveWithdrawHandler)
+	admin.POST("/withdraw/broadcast", RequirePermission(PermWithdrawWrite), BroadcastWithdrawHandler)
+	admin.POST("/withdraw/confirm", RequirePermission(PermWithdrawWrite), ConfirmWithdrawHandler)
+	admin.POST("/withdraw/reject", RequirePermission(PermWithdrawWrite), RejectWithdrawHandler)
+	admin.POST("/withdraw/fail", RequirePermission(PermWithdrawWrite), FailWithdrawHandler)
+	admin.GET("/referral_policies", RequirePermission(PermReferralRead), GetReferralPoliciesHandler)
+	admin.POST("/referral_policy/preview", RequirePermission(PermReferralRead), PreviewReferralPolicyHandler)
+	admin.POST("/referral_policy/add", RequirePermission(PermReferralWrite), AddReferralPolicyHandler)
+	admin.POST("/referral_policy/update", RequirePermission(PermReferralWrite), UpdateReferralPolicyHandler)
+	admin.POST("/referral_policy/delete", RequirePermission(PermReferralWrite), DeleteReferralPolicyHandler)
 
 	// storage
 	storage := apiV1.Group("/storage")
 	storage.GET("/get_map_info", GetMapInfoHandler)
 	// Deprecated: use /user/verify_code instead
-	storage.POST("/get_verify_code", GetNumericVerifyCodeHandler)
+	storage.POST("/get_verify_code", limiter.Limit("nonce"), GetNumericVerifyCodeHandler)
 	// Deprecated: use /user/register instead
 	storage.POST("/register", UserRegister)
 	// Deprecated: use /user/password_reset instead
 	storage.POST("/password_reset", PasswordRest)
-	storage.GET("/login_before", GetNonceStringHandler)
-	storage.POST("/login", authMiddleware.LoginHandler)
+	storage.GET("/login_before", limiter.Limit("nonce"), GetNonceStringHandler)
+	storage.POST("/login", limiter.Limit("login"), authMiddleware.LoginHandler)
 	storage.POST("/logout", authMiddleware.LogoutHandler)
 	link.GET("/", GetShareLinkHandler)
 	storage.GET("/get_link", ShareLinkHandler)
@@ -150,7 +209,10 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 	storage.GET("/get_user_info_hour", GetStorageHourHandler)
 	storage.GET("/get_user_info_daily", GetStorageDailyHandler)
 	storage.GET("/refresh_token", authMiddleware.RefreshHandler)
-	storage.GET("/new_secret", CreateNewSecretKeyHandler)
+	storage.GET("/new_secret", RequireTOTP(), CreateNewSecretKeyHandler)
+	storage.GET("/secrets", GetSecretKeysHandler)
+	storage.POST("/rotate_secret", RequireTOTP(), RotateSecretKeyHandler)
+	storage.POST("/revoke_secret", RevokeSecretKeyHandler)
 	storage.GET("/get_key_perms", GetAPIKeyPermsHandler)
 	storage.GET("/create_group", CreateGroupHandler)
 	storage.GET("/get_groups", GetGroupsHandler)
@@ -183,11 +245,12 @@ func RegisterRouterWithJWT(router *gin.Engine, cfg config.Config) {
 
 }
 
-func RegisterRouterWithAPIKey(router *gin.Engine) {
+func RegisterRouterWithAPIKey(router *gin.Engine, limiter *rateLimiter) {
 	authV1 := router.Group("/v1")
 	storage := authV1.Group("/storage")
+	storage.Use(limiter.Limit("api_key"))
 	storage.Use(AuthAPIKeyMiddlewareFunc())
-	storage.POST("/add_fil_storage", CreateFilStorageHandler)
-	storage.GET("/backup_assets", GetBackupAssetsHandler)
-	storage.POST("/backup_result", BackupResultHandler)
+	storage.POST("/add_fil_storage", RequireAPIKeyScope(ScopeFilStorageWrite), CreateFilStorageHandler)
+	storage.GET("/backup_assets", RequireAPIKeyScope(ScopeBackupRead), GetBackupAssetsHandler)
+	storage.POST("/backup_result", RequireAPIKeyScope(ScopeBackupWrite), BackupResultHandler)
 }
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/client"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	schedulerHealthCheckInterval = 30 * time.Second
+	schedulerHealthCheckTimeout  = 5 * time.Second
+)
+
+var schedulerPool = newSchedulerClientPool()
+
+var errNoSchedulerFound = errors.New("no scheduler found")
+
+// pooledScheduler is a reusable rpc connection to a scheduler.
+type pooledScheduler struct {
+	areaId  string
+	url     string
+	token   string
+	api     api.Scheduler
+	closer  func()
+	healthy bool
+	// inflight counts the calls in progress, a retired client is closed when its last call returns
+	inflight int
+	retired  bool
+}
+
+// schedulerClientPool keeps the scheduler rpc clients of each area, the clients are health checked periodically.
+type schedulerClientPool struct {
+	lk sync.RWMutex
+	// key is areaID, value is the clients of the area keyed by scheduler url
+	clients map[string]map[string]*pooledScheduler
+	// key is areaID, value is the round-robin cursor of the area
+	cursor map[string]int
+}
+
+func newSchedulerClientPool() *schedulerClientPool {
+	return &schedulerClientPool{
+		clients: make(map[string]map[string]*pooledScheduler),
+		cursor:  make(map[string]int),
+	}
+}
+
+// candidates returns the clients of the area in round-robin order, the healthy ones come first.
+func (p *schedulerClientPool) candidates(ctx context.Context, areaId string) ([]*pooledScheduler, error) {
+	configs, err := GetSchedulerConfigs(ctx, fmt.Sprintf("%s::%s", SchedulerConfigKeyPrefix, areaId))
+	if err == redis.Nil && areaId != DefaultAreaId {
+		return p.candidates(ctx, DefaultAreaId)
+	}
+
+	if err != nil {
+		log.Errorf("get scheduler configs: %v", err)
+		return nil, errNoSchedulerFound
+	}
+
+	p.lk.Lock()
+	idle := p.syncArea(areaId, configs)
+
+	var all []*pooledScheduler
+	for _, cfg := range configs {
+		if sc, ok := p.clients[areaId][schedulerURLOf(cfg)]; ok {
+			all = append(all, sc)
+		}
+	}
+
+	var healthy, unhealthy []*pooledScheduler
+	if len(all) > 0 {
+		start := p.cursor[areaId] % len(all)
+		p.cursor[areaId] = start + 1
+
+		for i := 0; i < len(all); i++ {
+			sc := all[(start+i)%len(all)]
+			if sc.healthy {
+				healthy = append(healthy, sc)
+			} else {
+				unhealthy = append(unhealthy, sc)
+			}
+		}
+	}
+	p.lk.Unlock()
+
+	closeSchedulers(idle)
+
+	if len(all) == 0 {
+		return nil, errNoSchedulerFound
+	}
+
+	return append(healthy, unhealthy...), nil
+}
+
+// syncArea makes the clients of the area consistent with the configs, must be called with the lock held.
+// It returns the replaced clients that can be closed now, the others are closed when their calls return.
+func (p *schedulerClientPool) syncArea(areaId string, configs []*types.SchedulerCfg) []*pooledScheduler {
+	clients, ok := p.clients[areaId]
+	if !ok {
+		clients = make(map[string]*pooledScheduler)
+		p.clients[areaId] = clients
+	}
+
+	var idle []*pooledScheduler
+	current := make(map[string]struct{})
+	for _, cfg := range configs {
+		url := schedulerURLOf(cfg)
+		current[url] = struct{}{}
+
+		sc, ok := clients[url]
+		if ok && sc.token == cfg.AccessToken {
+			continue
+		}
+
+		if ok {
+			if sc.retire() {
+				idle = append(idle, sc)
+			}
+			delete(clients, url)
+		}
+
+		headers := http.Header{}
+		headers.Add("Authorization", "Bearer "+cfg.AccessToken)
+		schedulerClient, closer, err := client.NewScheduler(context.Background(), url, headers)
+		if err != nil {
+			log.Errorf("create scheduler rpc client: %v", err)
+			continue
+		}
+
+		clients[url] = &pooledScheduler{
+			areaId:  areaId,
+			url:     url,
+			token:   cfg.AccessToken,
+			api:     schedulerClient,
+			closer:  closer,
+			healthy: true,
+		}
+	}
+
+	for url, sc := range clients {
+		if _, ok := current[url]; !ok {
+			if sc.retire() {
+				idle = append(idle, sc)
+			}
+			delete(clients, url)
+		}
+	}
+
+	return idle
+}
+
+// remove removes the client of the scheduler, it's closed once the calls in progress return.
+func (p *schedulerClientPool) remove(cfg *types.SchedulerCfg) {
+	p.lk.Lock()
+	url := schedulerURLOf(cfg)
+	sc, ok := p.clients[cfg.AreaID][url]
+	if ok {
+		delete(p.clients[cfg.AreaID], url)
+		ok = sc.retire()
+	}
+	p.lk.Unlock()
+
+	if ok {
+		sc.closer()
+	}
+}
+
+// retire marks the client removed from the pool, it returns true if no call is in progress and the client
+// can be closed now. Must be called with the lock held.
+func (sc *pooledScheduler) retire() bool {
+	sc.retired = true
+	return sc.inflight == 0
+}
+
+// acquire marks a call in progress on the client, the client isn't closed until the call is released.
+func (p *schedulerClientPool) acquire(sc *pooledScheduler) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	sc.inflight++
+}
+
+// release marks the call returned, and closes the client if it's retired and this was its last call.
+func (p *schedulerClientPool) release(sc *pooledScheduler) {
+	p.lk.Lock()
+	sc.inflight--
+	idle := sc.retired && sc.inflight == 0
+	p.lk.Unlock()
+
+	if idle {
+		sc.closer()
+	}
+}
+
+func closeSchedulers(clients []*pooledScheduler) {
+	for _, sc := range clients {
+		sc.closer()
+	}
+}
+
+func (p *schedulerClientPool) setHealth(sc *pooledScheduler, healthy bool) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	sc.healthy = healthy
+}
+
+// run checks the health of all clients periodically until the context is done.
+func (p *schedulerClientPool) run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.healthCheck(ctx)
+		case <-ctx.Done():
+			p.close()
+			return
+		}
+	}
+}
+
+func (p *schedulerClientPool) healthCheck(ctx context.Context) {
+	p.lk.Lock()
+	var all []*pooledScheduler
+	for _, clients := range p.clients {
+		for _, sc := range clients {
+			sc.inflight++
+			all = append(all, sc)
+		}
+	}
+	p.lk.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(all))
+	for _, sc := range all {
+		go func(sc *pooledScheduler) {
+			defer wg.Done()
+			defer p.release(sc)
+
+			cctx, cancel := context.WithTimeout(ctx, schedulerHealthCheckTimeout)
+			defer cancel()
+
+			schedulerRPCCalls.WithLabelValues(sc.url).Inc()
+			_, err := sc.api.Version(cctx)
+			if err != nil {
+				schedulerRPCErrors.WithLabelValues(sc.url).Inc()
+				log.Warnf("scheduler %s health check: %v", sc.url, err)
+			}
+			p.setHealth(sc, err == nil)
+		}(sc)
+	}
+	wg.Wait()
+}
+
+func (p *schedulerClientPool) close() {
+	p.lk.Lock()
+	var idle []*pooledScheduler
+	for areaId, clients := range p.clients {
+		for _, sc := range clients {
+			if sc.retire() {
+				idle = append(idle, sc)
+			}
+		}
+		delete(p.clients, areaId)
+	}
+	p.lk.Unlock()
+
+	closeSchedulers(idle)
+}
+
+// withSchedulerClient calls fn with the schedulers of the area in turn, it fails over to the next scheduler
+// when the rpc connection errors, and returns the error of fn otherwise.
+func withSchedulerClient(ctx context.Context, areaId string, fn func(api.Scheduler) error) error {
+	candidates, err := schedulerPool.candidates(ctx, areaId)
+	if err != nil {
+		return err
+	}
+
+	for _, sc := range candidates {
+		schedulerRPCCalls.WithLabelValues(sc.url).Inc()
+		schedulerPool.acquire(sc)
+		err = fn(sc.api)
+		schedulerPool.release(sc)
+
+		var connErr *jsonrpc.RPCConnectionError
+		if !errors.As(err, &connErr) {
+			return err
+		}
+
+		schedulerRPCErrors.WithLabelValues(sc.url).Inc()
+		log.Warnf("scheduler %s unavailable, try next: %v", sc.url, err)
+		schedulerPool.setHealth(sc, false)
+	}
+
+	return err
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// newFailoverScheduler returns a client calling the schedulers in turn like withSchedulerClient does, every method
+// of the client fails over to the next scheduler when the rpc connection errors.
+func newFailoverScheduler(candidates []*pooledScheduler) api.Scheduler {
+	var proxies [][]interface{}
+	for _, sc := range candidates {
+		proxy, ok := sc.api.(*api.SchedulerStruct)
+		if !ok {
+			return candidates[0].api
+		}
+		proxies = append(proxies, api.GetInternalStructs(proxy))
+	}
+
+	var out api.SchedulerStruct
+	for i, internal := range api.GetInternalStructs(&out) {
+		rv := reflect.ValueOf(internal).Elem()
+		for j := 0; j < rv.NumField(); j++ {
+			field := rv.Field(j)
+			if field.Kind() != reflect.Func {
+				continue
+			}
+
+			i, j := i, j
+			field.Set(reflect.MakeFunc(field.Type(), func(args []reflect.Value) []reflect.Value {
+				results := notSupportedResults(field.Type())
+				for n, sc := range candidates {
+					fn := reflect.ValueOf(proxies[n][i]).Elem().Field(j)
+					if fn.IsNil() {
+						continue
+					}
+
+					schedulerRPCCalls.WithLabelValues(sc.url).Inc()
+					schedulerPool.acquire(sc)
+					results = fn.Call(args)
+					schedulerPool.release(sc)
+
+					var connErr *jsonrpc.RPCConnectionError
+					if err := resultError(results); err == nil || !errors.As(err, &connErr) {
+						return results
+					}
+
+					schedulerRPCErrors.WithLabelValues(sc.url).Inc()
+					log.Warnf("scheduler %s unavailable, try next: %v", sc.url, resultError(results))
+					schedulerPool.setHealth(sc, false)
+				}
+				return results
+			}))
+		}
+	}
+
+	return &out
+}
+
+// notSupportedResults returns the zero results of the method with api.ErrNotSupported as the error.
+func notSupportedResults(fnType reflect.Type) []reflect.Value {
+	out := make([]reflect.Value, fnType.NumOut())
+	for i := range out {
+		out[i] = reflect.Zero(fnType.Out(i))
+	}
+
+	if last := fnType.NumOut() - 1; last >= 0 && fnType.Out(last) == errorType {
+		out[last] = reflect.ValueOf(&api.ErrNotSupported).Elem()
+	}
+	return out
+}
+
+// resultError returns the error of the results of a method, nil if the method doesn't return one.
+func resultError(results []reflect.Value) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	last := results[len(results)-1]
+	if last.Type() != errorType || last.IsNil() {
+		return nil
+	}
+	return last.Interface().(error)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/Filecoin-Titan/titan/api"
+	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+// fakeScheduler is a pooled scheduler answering CheckNetworkConnectivity with err and Version with version,
+// the calls are appended to calls.
+func fakeScheduler(url string, err error, version api.APIVersion, calls *[]string) *pooledScheduler {
+	var s api.SchedulerStruct
+	s.Internal.CheckNetworkConnectivity = func(ctx context.Context, network, target string) error {
+		*calls = append(*calls, url)
+		return err
+	}
+	s.CommonStruct.Internal.Version = func(ctx context.Context) (api.APIVersion, error) {
+		*calls = append(*calls, url)
+		return version, err
+	}
+	return &pooledScheduler{url: url, api: &s, closer: func() {}, healthy: true}
+}
+
+func TestFailoverScheduler(t *testing.T) {
+	connErr := &jsonrpc.RPCConnectionError{}
+	callErr := errors.New("asset not found")
+
+	cases := []struct {
+		name    string
+		errs    []error
+		calls   []string
+		err     error
+		healthy []bool
+	}{
+		{"first succeeds", []error{nil, nil}, []string{"s0"}, nil, []bool{true, true}},
+		{"fails over on connection error", []error{connErr, nil}, []string{"s0", "s1"}, nil, []bool{false, true}},
+		{"other errors pass through", []error{callErr, nil}, []string{"s0"}, callErr, []bool{true, true}},
+		{"all unavailable", []error{connErr, connErr}, []string{"s0", "s1"}, connErr, []bool{false, false}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls []string
+			var candidates []*pooledScheduler
+			for i, err := range c.errs {
+				candidates = append(candidates, fakeScheduler(fmt.Sprintf("s%d", i), err, api.APIVersion{}, &calls))
+			}
+
+			err := newFailoverScheduler(candidates).CheckNetworkConnectivity(context.Background(), "tcp", "localhost")
+			if err != c.err {
+				t.Errorf("CheckNetworkConnectivity() = %v, want %v", err, c.err)
+			}
+			if len(calls) != len(c.calls) {
+				t.Fatalf("calls = %v, want %v", calls, c.calls)
+			}
+			for i := range calls {
+				if calls[i] != c.calls[i] {
+					t.Errorf("calls = %v, want %v", calls, c.calls)
+				}
+			}
+			for i, sc := range candidates {
+				if sc.healthy != c.healthy[i] || sc.inflight != 0 {
+					t.Errorf("scheduler %s healthy %v inflight %d, want %v and no call in progress", sc.url, sc.healthy, sc.inflight, c.healthy[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFailoverSchedulerResults(t *testing.T) {
+	var calls []string
+	candidates := []*pooledScheduler{
+		fakeScheduler("s0", &jsonrpc.RPCConnectionError{}, api.APIVersion{Version: "v1"}, &calls),
+		fakeScheduler("s1", nil, api.APIVersion{Version: "v2"}, &calls),
+	}
+
+	version, err := newFailoverScheduler(candidates).Version(context.Background())
+	if err != nil || version.Version != "v2" {
+		t.Errorf("Version() = %v %v, want the version of the second scheduler", version, err)
+	}
+}
+
+func TestFailoverSchedulerNotSupported(t *testing.T) {
+	candidates := []*pooledScheduler{{url: "s0", api: &api.SchedulerStruct{}, closer: func() {}}}
+
+	if _, err := newFailoverScheduler(candidates).GetAssetListForBucket(context.Background(), "bucket"); err != api.ErrNotSupported {
+		t.Errorf("GetAssetListForBucket() = %v, want %v", err, api.ErrNotSupported)
+	}
+}
+
+func TestSchedulerPoolRemoveInFlight(t *testing.T) {
+	p := newSchedulerClientPool()
+	cfg := &types.SchedulerCfg{AreaID: "Asia-China", SchedulerURL: "http://s0/rpc/v0"}
+
+	var closed int
+	sc := &pooledScheduler{url: schedulerURLOf(cfg), closer: func() { closed++ }}
+	p.clients[cfg.AreaID] = map[string]*pooledScheduler{sc.url: sc}
+
+	p.acquire(sc)
+	p.remove(cfg)
+	if closed != 0 {
+		t.Fatal("the scheduler was closed with a call in progress")
+	}
+	if _, ok := p.clients[cfg.AreaID][sc.url]; ok {
+		t.Error("the removed scheduler is still pooled")
+	}
+
+	p.release(sc)
+	if closed != 1 {
+		t.Errorf("closed %d times after the last call returned, want 1", closed)
+	}
+
+	idle := &pooledScheduler{url: sc.url, closer: func() { closed++ }}
+	p.clients[cfg.AreaID][idle.url] = idle
+	p.remove(cfg)
+	if closed != 2 {
+		t.Errorf("the idle scheduler was not closed when removed")
+	}
+}
+
+func TestSchedulerPoolCloseInFlight(t *testing.T) {
+	p := newSchedulerClientPool()
+
+	var closed []string
+	busy := &pooledScheduler{url: "busy", closer: func() { closed = append(closed, "busy") }}
+	idle := &pooledScheduler{url: "idle", closer: func() { closed = append(closed, "idle") }}
+	p.clients["Asia-China"] = map[string]*pooledScheduler{busy.url: busy, idle.url: idle}
+
+	p.acquire(busy)
+	p.close()
+	if len(closed) != 1 || closed[0] != "idle" {
+		t.Fatalf("closed %v, want only the idle scheduler", closed)
+	}
+
+	p.release(busy)
+	if len(closed) != 2 {
+		t.Errorf("closed %v, want the busy scheduler closed after its call", closed)
+	}
+}
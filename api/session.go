@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// jtiKey is the claim identifying the session of the token.
+	jtiKey = "jti"
+	// sessionTTL is how long a session lives without any request, same as the MaxRefresh of the token.
+	sessionTTL = 24 * time.Hour
+	// sessionTouchInterval limits how often the last seen time of a session is written back.
+	sessionTouchInterval = time.Minute
+)
+
+// Session is a token issued by login, the token is rejected once its session is revoked or expired.
+type Session struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	IpAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current,omitempty"`
+}
+
+func getRedisSessionKey(jti string) string {
+	return fmt.Sprintf("TITAN::SESSION::%s", jti)
+}
+
+func getRedisUserSessionsKey(username string) string {
+	return fmt.Sprintf("TITAN::SESSIONS::%s", username)
+}
+
+func newJTI() string {
+	return uuid.NewString()
+}
+
+func createSession(c *gin.Context, username, jti string) error {
+	now := time.Now()
+	session := &Session{
+		ID:         jti,
+		Username:   username,
+		IpAddress:  clientIP(c),
+		UserAgent:  c.Request.Header.Get("User-Agent"),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	return saveSession(c.Request.Context(), session)
+}
+
+func saveSession(ctx context.Context, session *Session) error {
+	bytes, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	userKey := getRedisUserSessionsKey(session.Username)
+
+	pipe := dao.RedisCache.TxPipeline()
+	pipe.Set(ctx, getRedisSessionKey(session.ID), bytes, sessionTTL)
+	pipe.SAdd(ctx, userKey, session.ID)
+	pipe.Expire(ctx, userKey, sessionTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// getSession returns nil if the session is revoked or expired.
+func getSession(ctx context.Context, jti string) (*Session, error) {
+	bytes, err := dao.RedisCache.Get(ctx, getRedisSessionKey(jti)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err = json.Unmarshal(bytes, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// touchSession extends the session and records the last seen time.
+func touchSession(ctx context.Context, session *Session) error {
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	session.LastSeenAt = time.Now()
+	return saveSession(ctx, session)
+}
+
+func revokeSession(ctx context.Context, username, jti string) error {
+	pipe := dao.RedisCache.TxPipeline()
+	pipe.Del(ctx, getRedisSessionKey(jti))
+	pipe.SRem(ctx, getRedisUserSessionsKey(username), jti)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// revokeUserSessions revokes all the sessions of the user.
+func revokeUserSessions(ctx context.Context, username string) error {
+	userKey := getRedisUserSessionsKey(username)
+	ids, err := dao.RedisCache.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userKey}
+	for _, id := range ids {
+		keys = append(keys, getRedisSessionKey(id))
+	}
+
+	return dao.RedisCache.Del(ctx, keys...).Err()
+}
+
+// listUserSessions returns the active sessions of the user, the expired ones are cleaned up.
+func listUserSessions(ctx context.Context, username string) ([]*Session, error) {
+	userKey := getRedisUserSessionsKey(username)
+	ids, err := dao.RedisCache.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []*Session
+		expired  []interface{}
+	)
+	for _, id := range ids {
+		session, err := getSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if session == nil {
+			expired = append(expired, id)
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		if err = dao.RedisCache.SRem(ctx, userKey, expired...).Err(); err != nil {
+			log.Errorf("remove expired sessions: %v", err)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// sessionAuthorizator rejects the tokens whose session is revoked or expired, the tokens without jti are issued before
+// the sessions are introduced and are rejected as well.
+func sessionAuthorizator(data interface{}, c *gin.Context) bool {
+	claims := jwt.ExtractClaims(c)
+	jti, _ := claims[jtiKey].(string)
+	username, _ := claims[identityKey].(string)
+	if jti == "" {
+		return false
+	}
+
+	session, err := getSession(c.Request.Context(), jti)
+	if err != nil {
+		log.Errorf("get session: %v", err)
+		return false
+	}
+
+	if session == nil || session.Username != username {
+		return false
+	}
+
+	if err = touchSession(c.Request.Context(), session); err != nil {
+		log.Errorf("touch session: %v", err)
+	}
+
+	return true
+}
+
+func GetSessionsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+	jti, _ := claims[jtiKey].(string)
+
+	sessions, err := listUserSessions(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("list sessions: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == jti
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  sessions,
+		"total": len(sessions),
+	}))
+}
+
+func LogoutAllHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	if err := revokeUserSessions(c.Request.Context(), username); err != nil {
+		log.Errorf("revoke sessions: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// newClaimsContext returns the context of a request authenticated by the jwt middleware with the claims.
+func newClaimsContext(claims jwt.MapClaims) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		c.Set("JWT_PAYLOAD", claims)
+	}
+	return c, w
+}
+
+// useUnreachableRedis points the redis client to an address nothing listens on for the test.
+func useUnreachableRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	prev := dao.RedisCache
+	dao.RedisCache = client
+	t.Cleanup(func() {
+		dao.RedisCache = prev
+		client.Close()
+	})
+}
+
+// loginSession issues a token to the user through the login response of the middleware, which creates the session.
+func loginSession(t *testing.T, mw *jwt.GinJWTMiddleware, username string) string {
+	token, expire, err := mw.TokenGenerator(&model.User{Username: username})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := newClaimsContext(nil)
+	mw.LoginResponse(c, http.StatusOK, token, expire)
+	if got := responseErrorCode(t, w); got != 0 {
+		t.Fatalf("login error = %d", got)
+	}
+	return token
+}
+
+// authorized tells whether the middleware lets the request of the token through, the rejected requests are aborted.
+func authorized(mw *jwt.GinJWTMiddleware, token string) bool {
+	c, _ := newClaimsContext(nil)
+	c.Request.Header.Set("JwtAuthorization", "Bearer "+token)
+
+	mw.MiddlewareFunc()(c)
+	return !c.IsAborted()
+}
+
+func newTestJWTMiddleware(t *testing.T) *jwt.GinJWTMiddleware {
+	mw, err := jwtGinMiddleware("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mw
+}
+
+func TestSessionLogout(t *testing.T) {
+	useMiniRedis(t)
+	mw := newTestJWTMiddleware(t)
+
+	token := loginSession(t, mw, "alice")
+	other := loginSession(t, mw, "alice")
+	if !authorized(mw, token) || !authorized(mw, other) {
+		t.Fatal("the tokens of the sessions are rejected")
+	}
+
+	c, _ := newClaimsContext(nil)
+	c.Request.Header.Set("JwtAuthorization", "Bearer "+token)
+	mw.LogoutHandler(c)
+
+	if authorized(mw, token) {
+		t.Error("the token is accepted after logout")
+	}
+	if !authorized(mw, other) {
+		t.Error("the token of the other session is rejected after logout")
+	}
+}
+
+func TestSessionLogoutAll(t *testing.T) {
+	useMiniRedis(t)
+	mw := newTestJWTMiddleware(t)
+
+	tokens := []string{loginSession(t, mw, "alice"), loginSession(t, mw, "alice")}
+	bob := loginSession(t, mw, "bob")
+
+	c, w := newClaimsContext(jwt.MapClaims{identityKey: "alice"})
+	LogoutAllHandler(c)
+	if got := responseErrorCode(t, w); got != 0 {
+		t.Fatalf("logout all error = %d", got)
+	}
+
+	for _, token := range tokens {
+		if authorized(mw, token) {
+			t.Error("the token is accepted after logout all")
+		}
+	}
+	if !authorized(mw, bob) {
+		t.Error("the token of another user is rejected")
+	}
+}
+
+func TestPasswordRestRevokesSessions(t *testing.T) {
+	useMiniRedis(t)
+	mock := useMockDB(t)
+	mw := newTestJWTMiddleware(t)
+
+	token := loginSession(t, mw, "alice")
+	if !authorized(mw, token) {
+		t.Fatal("the token of the session is rejected")
+	}
+
+	nonce, err := generateNonceString(context.Background(), getRedisNonceResetKey("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM users WHERE username = ?`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("alice"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET pass_hash`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	query := url.Values{"username": {"alice"}, "verify_code": {nonce}, "password": {"new password"}}
+	c, w := newClaimsContext(nil)
+	c.Request = httptest.NewRequest(http.MethodPost, "/?"+query.Encode(), nil)
+	PasswordRest(c)
+	if got := responseErrorCode(t, w); got != 0 {
+		t.Fatalf("password reset error = %d", got)
+	}
+
+	if authorized(mw, token) {
+		t.Error("the token is accepted after the password is reset")
+	}
+}
+
+func TestSessionAuthorizator(t *testing.T) {
+	useMiniRedis(t)
+
+	jti := newJTI()
+	now := time.Now()
+	if err := saveSession(context.Background(), &Session{ID: jti, Username: "alice", CreatedAt: now, LastSeenAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{"session", jwt.MapClaims{identityKey: "alice", jtiKey: jti}, true},
+		{"no claims", nil, false},
+		{"token issued before the sessions", jwt.MapClaims{identityKey: "alice"}, false},
+		{"blank jti", jwt.MapClaims{identityKey: "alice", jtiKey: ""}, false},
+		{"unknown session", jwt.MapClaims{identityKey: "alice", jtiKey: newJTI()}, false},
+		{"session of another user", jwt.MapClaims{identityKey: "bob", jtiKey: jti}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := newClaimsContext(c.claims)
+			if got := sessionAuthorizator(nil, ctx); got != c.want {
+				t.Errorf("sessionAuthorizator() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSessionAuthorizatorUnavailable(t *testing.T) {
+	useUnreachableRedis(t)
+
+	ctx, _ := newClaimsContext(jwt.MapClaims{identityKey: "alice", jtiKey: newJTI()})
+	if sessionAuthorizator(nil, ctx) {
+		t.Error("sessionAuthorizator() = true, want the token rejected when the sessions can't be read")
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	mr := useMiniRedis(t)
+	mw := newTestJWTMiddleware(t)
+
+	token := loginSession(t, mw, "alice")
+	mr.FastForward(sessionTTL - time.Second)
+	if !authorized(mw, token) {
+		t.Fatal("the token is rejected before its session expired")
+	}
+
+	mr.FastForward(time.Second)
+	if authorized(mw, token) {
+		t.Error("the token is accepted after its session expired")
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	mr := useMiniRedis(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		lastSeen time.Duration
+		write    bool
+	}{
+		{"seen just now", 0, false},
+		{"seen within the interval", sessionTouchInterval / 2, false},
+		{"seen before the interval", 2 * sessionTouchInterval, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lastSeen := time.Now().Add(-c.lastSeen).Truncate(time.Second)
+			session := &Session{ID: newJTI(), Username: "alice", LastSeenAt: lastSeen}
+			if err := saveSession(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			mr.FastForward(time.Hour)
+
+			if err := touchSession(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := getSession(ctx, session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written := !saved.LastSeenAt.Equal(lastSeen); written != c.write {
+				t.Errorf("last seen %s, want written %v", saved.LastSeenAt, c.write)
+			}
+
+			wantTTL := sessionTTL - time.Hour
+			if c.write {
+				wantTTL = sessionTTL
+			}
+			if ttl := mr.TTL(getRedisSessionKey(session.ID)); ttl != wantTTL {
+				t.Errorf("session ttl = %s, want %s", ttl, wantTTL)
+			}
+		})
+	}
+}
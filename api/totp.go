@@ -0,0 +1,417 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/totp"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer = "Titan"
+	// totpSkew is the number of steps accepted before and after the current one for the clock drift.
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	// mfaTokenKey is the key of the token returned by the first login step when the 2FA is enabled.
+	mfaTokenKey        = "mfa_token"
+	mfaTokenExpiration = 5 * time.Minute
+	// totpHeader carries the code required by the sensitive operations.
+	totpHeader = "X-TOTP-Code"
+)
+
+func getRedisMFATokenKey(token string) string {
+	return fmt.Sprintf("TITAN::MFA::%s", token)
+}
+
+// verifyTOTP validates the code and marks its step as used, a code is accepted only once.
+func verifyTOTP(ctx context.Context, t *model.UserTOTP, code string) (bool, error) {
+	step, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+	return dao.UseUserTOTPStep(ctx, t.Username, step)
+}
+
+// verifySecondFactor accepts a TOTP code or a recovery code, the recovery code is removed once used.
+func verifySecondFactor(ctx context.Context, t *model.UserTOTP, code string) (bool, error) {
+	if len(code) == totp.Digits {
+		return verifyTOTP(ctx, t, code)
+	}
+	return useRecoveryCode(ctx, t, code)
+}
+
+// generateRecoveryCodes returns the codes shown to the user and their hashes saved in the database.
+func generateRecoveryCodes() ([]string, string, error) {
+	codes, hashes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+func useRecoveryCode(ctx context.Context, t *model.UserTOTP, code string) (bool, error) {
+	remaining, ok := totp.UseRecoveryCode(splitList(t.RecoveryCodes), code)
+	if !ok {
+		return false, nil
+	}
+	return dao.ReplaceUserTOTPRecoveryCodes(ctx, t.Username, t.RecoveryCodes, strings.Join(remaining, ","))
+}
+
+func isTOTPRequired(err error) bool {
+	e, ok := err.(errors.GenericError)
+	return ok && e.Code == errors.TOTPRequired
+}
+
+// requireSecondFactor is the second login step, the user passes with a valid totp_code, otherwise an mfa token
+// is returned for the client to complete the login with the code.
+func requireSecondFactor(c *gin.Context, user *model.User) (interface{}, error) {
+	t, err := dao.GetUserTOTP(c.Request.Context(), user.Username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		return nil, errors.NewErrorCode(errors.InternalServer, c)
+	}
+
+	if t == nil || !t.Enabled {
+		return user, nil
+	}
+
+	if code := c.Query("totp_code"); code != "" {
+		ok, err := verifySecondFactor(c.Request.Context(), t, code)
+		if err != nil {
+			log.Errorf("verify totp: %v", err)
+			return nil, errors.NewErrorCode(errors.InternalServer, c)
+		}
+
+		if !ok {
+			return nil, errors.NewErrorCode(errors.InvalidTOTPCode, c)
+		}
+		return user, nil
+	}
+
+	bytes, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	token := uuid.NewString()
+	if err = dao.RedisCache.Set(c.Request.Context(), getRedisMFATokenKey(token), bytes, mfaTokenExpiration).Err(); err != nil {
+		log.Errorf("save mfa token: %v", err)
+		return nil, errors.NewErrorCode(errors.InternalServer, c)
+	}
+
+	c.Set(mfaTokenKey, token)
+	return nil, errors.NewErrorCode(errors.TOTPRequired, c)
+}
+
+// loginByMFAToken completes the login started by a first factor.
+func loginByMFAToken(c *gin.Context, username, token, code string) (interface{}, error) {
+	key := getRedisMFATokenKey(token)
+	bytes, err := dao.RedisCache.Get(c.Request.Context(), key).Bytes()
+	if err == redis.Nil {
+		return nil, errors.NewErrorCode(errors.VerifyCodeExpired, c)
+	}
+
+	if err != nil {
+		log.Errorf("get mfa token: %v", err)
+		return nil, errors.NewErrorCode(errors.InternalServer, c)
+	}
+
+	var user model.User
+	if err = json.Unmarshal(bytes, &user); err != nil {
+		return nil, err
+	}
+
+	if user.Username != username {
+		return nil, errors.NewErrorCode(errors.InvalidParams, c)
+	}
+
+	t, err := dao.GetUserTOTP(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		return nil, errors.NewErrorCode(errors.InternalServer, c)
+	}
+
+	if t == nil || !t.Enabled {
+		return &user, nil
+	}
+
+	ok, err := verifySecondFactor(c.Request.Context(), t, code)
+	if err != nil {
+		log.Errorf("verify totp: %v", err)
+		return nil, errors.NewErrorCode(errors.InternalServer, c)
+	}
+
+	if !ok {
+		return nil, errors.NewErrorCode(errors.InvalidTOTPCode, c)
+	}
+
+	if err = dao.RedisCache.Del(c.Request.Context(), key).Err(); err != nil {
+		log.Errorf("delete mfa token: %v", err)
+	}
+
+	return &user, nil
+}
+
+// RequireTOTP requires a fresh code in the X-TOTP-Code header if the user has enabled the 2FA,
+// it must be used after the MiddlewareFunc of the jwt middleware.
+func RequireTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		username := claims[identityKey].(string)
+
+		t, err := dao.GetUserTOTP(c.Request.Context(), username)
+		if err != nil {
+			log.Errorf("get user totp: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			c.Abort()
+			return
+		}
+
+		if t == nil || !t.Enabled {
+			c.Next()
+			return
+		}
+
+		code := c.GetHeader(totpHeader)
+		if code == "" {
+			c.JSON(http.StatusOK, respErrorCode(errors.TOTPRequired, c))
+			c.Abort()
+			return
+		}
+
+		ok, err := verifyTOTP(c.Request.Context(), t, code)
+		if err != nil {
+			log.Errorf("verify totp: %v", err)
+			c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+			c.Abort()
+			return
+		}
+
+		if !ok {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidTOTPCode, c))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+type totpParams struct {
+	Code string `json:"code"`
+}
+
+func GetTOTPStatusHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	t, err := dao.GetUserTOTP(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	var enabled bool
+	var recoveryCodes int
+	if t != nil {
+		enabled = t.Enabled
+		recoveryCodes = len(splitList(t.RecoveryCodes))
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"enabled":        enabled,
+		"recovery_codes": recoveryCodes,
+	}))
+}
+
+// EnrollTOTPHandler creates a pending secret, the 2FA is enabled after the first code is activated.
+func EnrollTOTPHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	t, err := dao.GetUserTOTP(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if t != nil && t.Enabled {
+		c.JSON(http.StatusOK, respErrorCode(errors.TOTPAlreadyEnabled, c))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Errorf("generate totp secret: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err = dao.EnrollUserTOTP(c.Request.Context(), username, secret); err != nil {
+		log.Errorf("enroll user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"secret": secret,
+		"uri":    totp.ProvisioningURI(totpIssuer, username, secret),
+	}))
+}
+
+// ActivateTOTPHandler enables the 2FA with the first code and returns the recovery codes, they're shown only once.
+func ActivateTOTPHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params totpParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	t, err := dao.GetUserTOTP(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if t == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.TOTPNotEnrolled, c))
+		return
+	}
+
+	if t.Enabled {
+		c.JSON(http.StatusOK, respErrorCode(errors.TOTPAlreadyEnabled, c))
+		return
+	}
+
+	step, ok := totp.Validate(t.Secret, params.Code, time.Now(), totpSkew)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidTOTPCode, c))
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Errorf("generate recovery codes: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err = dao.EnableUserTOTP(c.Request.Context(), username, hashes, step); err != nil {
+		log.Errorf("enable user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"recovery_codes": codes,
+	}))
+}
+
+// DisableTOTPHandler turns off the 2FA with a TOTP code or a recovery code.
+func DisableTOTPHandler(c *gin.Context) {
+	t, params, ok := getEnabledTOTP(c)
+	if !ok {
+		return
+	}
+
+	valid, err := verifySecondFactor(c.Request.Context(), t, params.Code)
+	if err != nil {
+		log.Errorf("verify totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if !valid {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidTOTPCode, c))
+		return
+	}
+
+	if err = dao.DeleteUserTOTP(c.Request.Context(), t.Username); err != nil {
+		log.Errorf("delete user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"msg": "success",
+	}))
+}
+
+// RegenerateRecoveryCodesHandler replaces all the recovery codes, a TOTP code is required.
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	t, params, ok := getEnabledTOTP(c)
+	if !ok {
+		return
+	}
+
+	valid, err := verifyTOTP(c.Request.Context(), t, params.Code)
+	if err != nil {
+		log.Errorf("verify totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if !valid {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidTOTPCode, c))
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Errorf("generate recovery codes: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if err = dao.UpdateUserTOTPRecoveryCodes(c.Request.Context(), t.Username, hashes); err != nil {
+		log.Errorf("update recovery codes: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"recovery_codes": codes,
+	}))
+}
+
+// getEnabledTOTP binds the params and returns the enabled 2FA of the user, the response is written if it fails.
+func getEnabledTOTP(c *gin.Context) (*model.UserTOTP, totpParams, bool) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params totpParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return nil, params, false
+	}
+
+	t, err := dao.GetUserTOTP(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("get user totp: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return nil, params, false
+	}
+
+	if t == nil || !t.Enabled {
+		c.JSON(http.StatusOK, respErrorCode(errors.TOTPNotEnrolled, c))
+		return nil, params, false
+	}
+
+	return t, params, true
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"github.com/Filecoin-Titan/titan/api"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -13,6 +14,7 @@ import (
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/errors"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/mailer"
 	"github.com/gnasnik/titan-explorer/pkg/random"
 	"github.com/gnasnik/titan-explorer/pkg/rsa"
 	"github.com/go-redis/redis/v9"
@@ -111,16 +113,7 @@ func UserRegister(c *gin.Context) {
 	}
 
 	if referrer != nil {
-		rewardStatement := &model.RewardStatement{
-			Username:  referrer.Username,
-			FromUser:  userInfo.Username,
-			Amount:    0,
-			Event:     model.RewardEventInviteFrens,
-			Status:    1,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		err := dao.UpdateUserReward(c.Request.Context(), rewardStatement)
+		err := addReferralReward(c.Request.Context(), referrer, userInfo.Username, model.RewardEventInviteFrens, "")
 		if err != nil {
 			log.Errorf("Update user reward: %v", err)
 		}
@@ -179,6 +172,10 @@ func PasswordRest(c *gin.Context) {
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
+
+	if err = revokeUserSessions(c.Request.Context(), username); err != nil {
+		log.Errorf("revoke sessions: %v", err)
+	}
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"msg": "success",
 	}))
@@ -276,7 +273,12 @@ func GetNumericVerifyCodeHandler(c *gin.Context) {
 
 	verifyCode := random.GenerateRandomNumber(6)
 
-	if err = sendEmail(userInfo.Username, verifyCode, lang); err != nil {
+	template := mailer.TemplateVerifyCode
+	if NonceStringType(verifyType) == NonceStringTypeReset {
+		template = mailer.TemplatePasswordReset
+	}
+
+	if err = sendEmail(userInfo.Username, verifyCode, lang, template); err != nil {
 		log.Errorf("send email: %v", err)
 		if strings.Contains(err.Error(), "timed out") {
 			c.JSON(http.StatusOK, respErrorCode(errors.TimeoutCode, c))
@@ -347,31 +349,8 @@ func DeviceBindingHandler(c *gin.Context) {
 		return
 	}
 
-	pubKeyString, err := schedulerClient.GetNodePublicKey(c.Request.Context(), params.NodeId)
-	if err != nil {
-		log.Errorf("api get node public key: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
-	}
-
-	pubicKey, err := rsa.Pem2PublicKey([]byte(pubKeyString))
-	if err != nil {
-		log.Errorf("pem 2 publicKey: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
-	}
-
-	signature, err := hex.DecodeString(params.Signature)
-	if err != nil {
-		log.Errorf("hex decode: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InvalidSignature, c))
-		return
-	}
-
-	err = rsa.VerifySHA256Sign(pubicKey, signature, []byte(params.Hash))
-	if err != nil {
-		log.Errorf("pem 2 publicKey: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InvalidSignature, c))
+	if code := verifyNodeSignature(c.Request.Context(), schedulerClient, params.NodeId, params.Signature, params.Hash); code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
@@ -392,10 +371,43 @@ func DeviceBindingHandler(c *gin.Context) {
 		return
 	}
 
+	if err = addBindDeviceReward(c.Request.Context(), sign.Username, params.NodeId); err != nil {
+		log.Errorf("add bind device reward: %v", err)
+	}
+
 	c.JSON(http.StatusOK, respJSON(nil))
 
 }
 
+// verifyNodeSignature checks the hash is signed by the private key of the node, it returns the error code or 0 if it's signed.
+func verifyNodeSignature(ctx context.Context, schedulerClient api.Scheduler, nodeId, hexSignature, hash string) int {
+	pubKeyString, err := schedulerClient.GetNodePublicKey(ctx, nodeId)
+	if err != nil {
+		log.Errorf("api get node public key: %v", err)
+		return errors.InternalServer
+	}
+
+	pubicKey, err := rsa.Pem2PublicKey([]byte(pubKeyString))
+	if err != nil {
+		log.Errorf("pem 2 publicKey: %v", err)
+		return errors.InternalServer
+	}
+
+	signature, err := hex.DecodeString(hexSignature)
+	if err != nil {
+		log.Errorf("hex decode: %v", err)
+		return errors.InvalidSignature
+	}
+
+	err = rsa.VerifySHA256Sign(pubicKey, signature, []byte(hash))
+	if err != nil {
+		log.Errorf("verify node signature: %v", err)
+		return errors.InvalidSignature
+	}
+
+	return 0
+}
+
 // DeviceBindingHandlerOld Deprecate using DeviceBindingHandler instead of
 func DeviceBindingHandlerOld(c *gin.Context) {
 	deviceInfo := &model.DeviceInfo{}
@@ -451,6 +463,10 @@ func DeviceBindingHandlerOld(c *gin.Context) {
 		return
 	}
 
+	if deviceInfo.ActiveStatus == 2 {
+		removeDeviceLeaderboards(c.Request.Context(), deviceInfo.DeviceID)
+	}
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"msg": "success",
 	}))
@@ -487,6 +503,8 @@ func DeviceUnBindingHandlerOld(c *gin.Context) {
 		return
 	}
 
+	removeDeviceLeaderboards(c.Request.Context(), deviceInfo.DeviceID)
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"msg": "success",
 	}))
@@ -622,7 +640,13 @@ func VerifyMessage(message string, signedMessage string) (string, error) {
 	hashedMessage := []byte("\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message)) + message)
 	hash := crypto.Keccak256Hash(hashedMessage)
 	// Get the bytes of the signed message
-	decodedMessage := hexutil.MustDecode(signedMessage)
+	decodedMessage, err := hexutil.Decode(signedMessage)
+	if err != nil {
+		return "", err
+	}
+	if len(decodedMessage) != 65 {
+		return "", fmt.Errorf("invalid signature length %d", len(decodedMessage))
+	}
 	// Handles cases where EIP-115 is not implemented (most wallets don't implement it)
 	if decodedMessage[64] == 27 || decodedMessage[64] == 28 {
 		decodedMessage[64] -= 27
@@ -655,12 +679,14 @@ func GetUserInfo(ctx context.Context, key string) int64 {
 	return peakBandwidth
 }
 
+// BindWalletHandler binds the evm wallet signing the nonce string, the first wallet bound becomes the primary wallet.
 func BindWalletHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
 	type bindParams struct {
-		Username   string `json:"username"`
-		VerifyCode string `json:"verify_code"`
-		Sign       string `json:"sign"`
-		Address    string `json:"address"`
+		Sign    string `json:"sign"`
+		Address string `json:"address"`
 	}
 
 	var param bindParams
@@ -669,7 +695,14 @@ func BindWalletHandler(c *gin.Context) {
 		return
 	}
 
-	nonce, err := getNonceFromCache(c.Request.Context(), param.Username, NonceStringTypeSignature)
+	address, ok := normalizeWalletAddress(model.WalletChainEVM, param.Address)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidAddress, c))
+		return
+	}
+
+	// the nonce is removed before the signature is checked, so a signed nonce can't be replayed
+	nonce, err := takeWalletChallenge(c.Request.Context(), getRedisNonceSignatureKey(username))
 	if err != nil {
 		log.Errorf("query nonce string: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
@@ -681,57 +714,34 @@ func BindWalletHandler(c *gin.Context) {
 		return
 	}
 
-	recoverAddress, err := VerifyMessage(nonce, param.Sign)
-	if strings.ToUpper(recoverAddress) != strings.ToUpper(param.Address) {
-		c.JSON(http.StatusOK, respErrorCode(errors.InvalidSignature, c))
+	if code := verifyWalletSignature(model.WalletChainEVM, address, nonce, param.Sign); code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
 		return
 	}
 
-	user, err := dao.GetUserByUsername(c.Request.Context(), param.Username)
-	if err != nil || user == nil {
-		c.JSON(http.StatusOK, respErrorCode(errors.UserNotFound, c))
-		return
-	}
-
-	if user.WalletAddress != "" {
-		c.JSON(http.StatusOK, respErrorCode(errors.WalletBound, c))
-		return
-	}
-
-	if err := dao.UpdateUserWalletAddress(context.Background(), param.Username, recoverAddress); err != nil {
-		log.Errorf("update user wallet address: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
-	}
-
-	c.JSON(http.StatusOK, respJSON(nil))
+	addUserWallet(c, username, model.WalletChainEVM, address)
 }
 
+// UnBindWalletHandler unbinds the primary wallet of the user.
 func UnBindWalletHandler(c *gin.Context) {
 	claims := jwt.ExtractClaims(c)
 	username := claims[identityKey].(string)
 
-	ctx := context.Background()
-	user, err := dao.GetUserByUsername(ctx, username)
+	wallets, err := dao.ListUserWallets(c.Request.Context(), username)
 	if err != nil {
-		log.Errorf("get user by username: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
-	}
-
-	if user == nil {
-		log.Errorf("user not found: %v", err)
+		log.Errorf("list user wallets: %v", err)
 		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
 		return
 	}
 
-	if err := dao.UpdateUserWalletAddress(context.Background(), user.Username, ""); err != nil {
-		log.Errorf("update user wallet address: %v", err)
-		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
-		return
+	for _, wallet := range wallets {
+		if wallet.IsPrimary {
+			unbindUserWallet(c, wallet)
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, respJSON(nil))
+	c.JSON(http.StatusOK, respErrorCode(errors.WalletNotFound, c))
 }
 
 func GetReferralListHandler(c *gin.Context) {
@@ -764,10 +774,18 @@ func GetReferralListHandler(c *gin.Context) {
 		return
 	}
 
+	policy, err := getReferralPolicyInfo(c, username)
+	if err != nil {
+		log.Errorf("get referral policy: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
 	c.JSON(http.StatusOK, respJSON(JsonObject{
 		"list":         referList,
 		"total":        total,
 		"total_reward": totalReward,
+		"policy":       policy,
 	}))
 }
 
@@ -803,11 +821,37 @@ func WithdrawHandler(c *gin.Context) {
 		return
 	}
 
+	// pays to the primary wallet by default, the other address must be one of the wallets bound by the user.
+	if params.To == "" {
+		params.To = user.WalletAddress
+	}
+
+	wallets, err := dao.ListUserWallets(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("list user wallets: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	var bound bool
+	for _, wallet := range wallets {
+		if params.To != "" && strings.EqualFold(wallet.Address, params.To) {
+			params.To = wallet.Address
+			bound = true
+			break
+		}
+	}
+
+	if !bound {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletNotFound, c))
+		return
+	}
+
 	request := &model.Withdraw{
 		Username:  username,
 		ToAddress: params.To,
 		Amount:    params.Amount,
-		Status:    0,
+		Status:    model.WithdrawStatusPending,
 		CreatedAt: time.Now(),
 	}
 
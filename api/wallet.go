@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/ethereum/go-ethereum/common"
+	filaddr "github.com/filecoin-project/go-address"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultWalletUnbindCooldown = 24 * time.Hour
+
+func getRedisWalletChallengeKey(username, chain, address string) string {
+	return fmt.Sprintf("TITAN::WALLET::%s::%s::%s", username, chain, address)
+}
+
+// normalizeWalletAddress checks the address is valid on the chain and returns it in the canonical form,
+// the filecoin wallets must be f1 (secp256k1) or f3 (bls) addresses.
+func normalizeWalletAddress(chain, address string) (string, bool) {
+	switch chain {
+	case model.WalletChainEVM:
+		if !common.IsHexAddress(address) {
+			return "", false
+		}
+		return common.HexToAddress(address).Hex(), true
+	case model.WalletChainFilecoin:
+		addr, err := filaddr.NewFromString(address)
+		if err != nil {
+			return "", false
+		}
+		if addr.Protocol() != filaddr.SECP256K1 && addr.Protocol() != filaddr.BLS {
+			return "", false
+		}
+		return addr.String(), true
+	default:
+		return "", false
+	}
+}
+
+func buildWalletMessage(username, chain, address, nonce string) string {
+	return fmt.Sprintf("Bind wallet for titan\nUser: %s\nChain: %s\nAddress: %s\nNonce: %s", username, chain, address, nonce)
+}
+
+// verifyWalletSignature checks the message is signed by the address, the evm wallets sign with personal_sign,
+// the filecoin wallets sign with lotus wallet sign and are verified by the filecoin node like the miner signatures.
+func verifyWalletSignature(chain, address, message, sign string) int {
+	switch chain {
+	case model.WalletChainEVM:
+		recoverAddress, err := VerifyMessage(message, sign)
+		if err != nil || !strings.EqualFold(recoverAddress, address) {
+			return errors.InvalidSignature
+		}
+		return 0
+	case model.WalletChainFilecoin:
+		return checkSign(message, sign, address)
+	default:
+		return errors.InvalidParams
+	}
+}
+
+// takeWalletChallenge returns the nonce of the challenge and removes it, so a signature can only be used once.
+func takeWalletChallenge(ctx context.Context, key string) (string, error) {
+	pipe := dao.RedisCache.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	bytes, err := get.Bytes()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var nonce string
+	err = json.Unmarshal(bytes, &nonce)
+	return nonce, err
+}
+
+func walletUnbindCooldown() time.Duration {
+	if config.Cfg.Wallet.UnbindCooldown > 0 {
+		return config.Cfg.Wallet.UnbindCooldown
+	}
+	return defaultWalletUnbindCooldown
+}
+
+type walletParams struct {
+	ID      int64  `json:"id"`
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+	Sign    string `json:"sign"`
+}
+
+func GetUserWalletsHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	wallets, err := dao.ListUserWallets(c.Request.Context(), username)
+	if err != nil {
+		log.Errorf("list user wallets: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  wallets,
+		"total": len(wallets),
+	}))
+}
+
+// WalletChallengeHandler returns the message the wallet has to sign to be bound, the message expires with the nonce.
+func WalletChallengeHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params walletParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	address, ok := normalizeWalletAddress(params.Chain, params.Address)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidAddress, c))
+		return
+	}
+
+	nonce, err := generateNonceString(c.Request.Context(), getRedisWalletChallengeKey(username, params.Chain, address))
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	message := buildWalletMessage(username, params.Chain, address, nonce)
+	out := JsonObject{
+		"chain":   params.Chain,
+		"address": address,
+		"message": message,
+	}
+
+	if params.Chain == model.WalletChainFilecoin {
+		out["command"] = generateCommand(address, message)
+	}
+
+	c.JSON(http.StatusOK, respJSON(out))
+}
+
+func BindUserWalletHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params walletParams
+	if err := c.BindJSON(&params); err != nil || params.Sign == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	address, ok := normalizeWalletAddress(params.Chain, params.Address)
+	if !ok {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidAddress, c))
+		return
+	}
+
+	nonce, err := takeWalletChallenge(c.Request.Context(), getRedisWalletChallengeKey(username, params.Chain, address))
+	if err != nil {
+		log.Errorf("get wallet challenge: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	if nonce == "" {
+		c.JSON(http.StatusOK, respErrorCode(errors.VerifyCodeExpired, c))
+		return
+	}
+
+	message := buildWalletMessage(username, params.Chain, address, nonce)
+	if code := verifyWalletSignature(params.Chain, address, message, params.Sign); code != 0 {
+		c.JSON(http.StatusOK, respErrorCode(code, c))
+		return
+	}
+
+	addUserWallet(c, username, params.Chain, address)
+}
+
+func addUserWallet(c *gin.Context, username, chain, address string) {
+	_, err := dao.GetWalletByAddress(c.Request.Context(), chain, address)
+	if err == nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletBound, c))
+		return
+	}
+
+	if err != dao.ErrNoRow {
+		log.Errorf("get wallet by address: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	wallet := &model.UserWallet{
+		Username: username,
+		Chain:    chain,
+		Address:  address,
+	}
+
+	if err = dao.AddUserWallet(c.Request.Context(), wallet); err != nil {
+		log.Errorf("add user wallet: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"wallet": wallet,
+	}))
+}
+
+func SetPrimaryWalletHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params walletParams
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	err := dao.SetPrimaryWallet(c.Request.Context(), username, params.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletNotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("set primary wallet: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
+
+func UnbindUserWalletHandler(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims[identityKey].(string)
+
+	var params walletParams
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	wallet, err := dao.GetUserWallet(c.Request.Context(), username, params.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletNotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("get user wallet: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	unbindUserWallet(c, wallet)
+}
+
+// unbindUserWallet removes the wallet once it has been bound for the cooldown.
+func unbindUserWallet(c *gin.Context, wallet *model.UserWallet) {
+	if time.Since(wallet.CreatedAt) < walletUnbindCooldown() {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletUnbindCooldown, c))
+		return
+	}
+
+	err := dao.DeleteUserWallet(c.Request.Context(), wallet.Username, wallet.ID)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.WalletNotFound, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("delete user wallet: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(nil))
+}
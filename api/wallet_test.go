@@ -0,0 +1,384 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	filaddr "github.com/filecoin-project/go-address"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useMiniRedis points the redis client to an in-memory redis for the test.
+func useMiniRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	prev := dao.RedisCache
+	dao.RedisCache = client
+	t.Cleanup(func() {
+		dao.RedisCache = prev
+		client.Close()
+	})
+	return mr
+}
+
+// useMockDB replaces the database with a mock for the test, the expectations must all be met.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := dao.DB
+	dao.DB = sqlx.NewDb(db, "mysql")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		dao.DB = prev
+		db.Close()
+	})
+
+	return mock
+}
+
+// serveJSON runs the handler for alice with the json body and returns the error code of the response.
+func serveJSON(t *testing.T, handler gin.HandlerFunc, body interface{}) int {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := newClaimsContext(jwt.MapClaims{identityKey: "alice"})
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	handler(c)
+	return responseErrorCode(t, w)
+}
+
+// responseErrorCode returns the error code of the response, 0 if the request succeeded.
+func responseErrorCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	var resp struct {
+		Err int `json:"err"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %s: %v", w.Body.String(), err)
+	}
+	return resp.Err
+}
+
+// personalSign signs the message like the personal_sign of the evm wallets, v is 27 or 28.
+func personalSign(t *testing.T, key *ecdsa.PrivateKey, message string) string {
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return hexutil.Encode(sig)
+}
+
+func TestNormalizeWalletAddress(t *testing.T) {
+	secp, err := filaddr.NewSecp256k1Address([]byte("public key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bls, err := filaddr.NewBLSAddress(make([]byte, filaddr.BlsPublicKeyBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := filaddr.NewIDAddress(1000)
+	actor, _ := filaddr.NewActorAddress([]byte("actor"))
+
+	const evm = "0x52908400098527886E0F7030069857D2E4169EE7"
+
+	cases := []struct {
+		name    string
+		chain   string
+		address string
+		want    string
+		ok      bool
+	}{
+		{"evm checksummed", model.WalletChainEVM, evm, evm, true},
+		{"evm lower case", model.WalletChainEVM, strings.ToLower(evm), evm, true},
+		{"evm without prefix", model.WalletChainEVM, evm[2:], evm, true},
+		{"evm too short", model.WalletChainEVM, evm[:40], "", false},
+		{"evm not hex", model.WalletChainEVM, "0x" + strings.Repeat("z", 40), "", false},
+		{"f1", model.WalletChainFilecoin, secp.String(), secp.String(), true},
+		{"f3", model.WalletChainFilecoin, bls.String(), bls.String(), true},
+		{"f0 not a wallet", model.WalletChainFilecoin, id.String(), "", false},
+		{"f2 not a wallet", model.WalletChainFilecoin, actor.String(), "", false},
+		{"filecoin invalid", model.WalletChainFilecoin, "f1junk", "", false},
+		{"evm address on filecoin", model.WalletChainFilecoin, evm, "", false},
+		{"unknown chain", "solana", evm, "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := normalizeWalletAddress(c.chain, c.address)
+			if got != c.want || ok != c.ok {
+				t.Errorf("normalizeWalletAddress(%s, %s) = %s %v, want %s %v", c.chain, c.address, got, ok, c.want, c.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyMessage(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	signed := personalSign(t, key, "hello")
+	raw, _ := hexutil.Decode(signed)
+	raw[64] -= 27
+
+	cases := []struct {
+		name    string
+		message string
+		sign    string
+		want    string
+		err     bool
+	}{
+		{"v is 27 or 28", "hello", signed, address, false},
+		{"v is 0 or 1", "hello", hexutil.Encode(raw), address, false},
+		{"other message", "bye", signed, "", false},
+		{"not hex", "hello", "signature", "", true},
+		{"no prefix", "hello", signed[2:], "", true},
+		{"short signature", "hello", hexutil.Encode(raw[:64]), "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := VerifyMessage(c.message, c.sign)
+			if (err != nil) != c.err {
+				t.Fatalf("VerifyMessage() error = %v, want error %v", err, c.err)
+			}
+			if c.err {
+				return
+			}
+			if c.want == "" && got == address {
+				t.Errorf("VerifyMessage() of another message recovered the signer")
+			}
+			if c.want != "" && got != c.want {
+				t.Errorf("VerifyMessage() = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWalletSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	message := buildWalletMessage("alice", model.WalletChainEVM, address, "TitanNetWork(123456)")
+	sign := personalSign(t, key, message)
+
+	cases := []struct {
+		name    string
+		chain   string
+		address string
+		message string
+		want    int
+	}{
+		{"signed", model.WalletChainEVM, address, message, 0},
+		{"address case ignored", model.WalletChainEVM, strings.ToLower(address), message, 0},
+		{"other address", model.WalletChainEVM, "0x52908400098527886E0F7030069857D2E4169EE7", message, errors.InvalidSignature},
+		{"other user", model.WalletChainEVM, address, buildWalletMessage("bob", model.WalletChainEVM, address, "TitanNetWork(123456)"), errors.InvalidSignature},
+		{"unknown chain", "solana", address, message, errors.InvalidParams},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := verifyWalletSignature(c.chain, c.address, c.message, sign); got != c.want {
+				t.Errorf("verifyWalletSignature() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBuildWalletMessage(t *testing.T) {
+	want := "Bind wallet for titan\nUser: alice\nChain: evm\nAddress: 0xabc\nNonce: TitanNetWork(123456)"
+	if got := buildWalletMessage("alice", "evm", "0xabc", "TitanNetWork(123456)"); got != want {
+		t.Errorf("buildWalletMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestTakeWalletChallenge(t *testing.T) {
+	mr := useMiniRedis(t)
+	ctx := context.Background()
+	key := getRedisWalletChallengeKey("alice", model.WalletChainEVM, "0xabc")
+
+	nonce, err := generateNonceString(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := takeWalletChallenge(ctx, key)
+	if err != nil || got != nonce {
+		t.Fatalf("takeWalletChallenge() = %s %v, want %s", got, err, nonce)
+	}
+
+	if got, err = takeWalletChallenge(ctx, key); err != nil || got != "" {
+		t.Errorf("takeWalletChallenge() the second time = %s %v, want the challenge used", got, err)
+	}
+
+	if _, err = generateNonceString(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(defaultNonceExpiration)
+	if got, err = takeWalletChallenge(ctx, key); err != nil || got != "" {
+		t.Errorf("takeWalletChallenge() after expiration = %s %v, want the challenge expired", got, err)
+	}
+}
+
+// expectAddWallet expects the address isn't bound yet and alice binds it as her first wallet.
+func expectAddWallet(mock sqlmock.Sqlmock, address string) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM user_wallet WHERE chain = ? AND address = ?`)).
+		WithArgs(model.WalletChainEVM, address).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE username = ? FOR UPDATE`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_wallet`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET wallet_address`)).
+		WithArgs("alice", "alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestBindWalletSingleUse(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	cases := []struct {
+		name    string
+		handler gin.HandlerFunc
+		// challenge returns the message to sign
+		challenge func(t *testing.T) string
+		body      func(sign string) interface{}
+	}{
+		{
+			name:    "wallet challenge",
+			handler: BindUserWalletHandler,
+			challenge: func(t *testing.T) string {
+				nonce, err := generateNonceString(context.Background(), getRedisWalletChallengeKey("alice", model.WalletChainEVM, address))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return buildWalletMessage("alice", model.WalletChainEVM, address, nonce)
+			},
+			body: func(sign string) interface{} {
+				return walletParams{Chain: model.WalletChainEVM, Address: address, Sign: sign}
+			},
+		},
+		{
+			name:    "legacy nonce",
+			handler: BindWalletHandler,
+			challenge: func(t *testing.T) string {
+				nonce, err := generateNonceString(context.Background(), getRedisNonceSignatureKey("alice"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return nonce
+			},
+			body: func(sign string) interface{} {
+				return JsonObject{"address": address, "sign": sign}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useMiniRedis(t)
+			mock := useMockDB(t)
+
+			body := c.body(personalSign(t, key, c.challenge(t)))
+			expectAddWallet(mock, address)
+			if got := serveJSON(t, c.handler, body); got != 0 {
+				t.Fatalf("bind error = %d, want the wallet bound", got)
+			}
+
+			if got := serveJSON(t, c.handler, body); got != errors.VerifyCodeExpired {
+				t.Errorf("replayed bind error = %d, want %d", got, errors.VerifyCodeExpired)
+			}
+
+			// a wrong signature uses up the challenge too
+			c.challenge(t)
+			if got := serveJSON(t, c.handler, c.body(personalSign(t, key, "other message"))); got != errors.InvalidSignature {
+				t.Errorf("bind error = %d, want %d", got, errors.InvalidSignature)
+			}
+			if got := serveJSON(t, c.handler, body); got != errors.VerifyCodeExpired {
+				t.Errorf("bind after a wrong signature error = %d, want %d", got, errors.VerifyCodeExpired)
+			}
+		})
+	}
+}
+
+func TestUnbindUserWalletCooldown(t *testing.T) {
+	cooldown := config.Cfg.Wallet.UnbindCooldown
+	defer func() { config.Cfg.Wallet.UnbindCooldown = cooldown }()
+
+	cases := []struct {
+		name     string
+		cooldown time.Duration
+		age      time.Duration
+		want     int
+	}{
+		{"default cooldown", 0, time.Hour, errors.WalletUnbindCooldown},
+		{"default cooldown passed", 0, 25 * time.Hour, 0},
+		{"configured cooldown", time.Hour, 30 * time.Minute, errors.WalletUnbindCooldown},
+		{"configured cooldown passed", time.Hour, 2 * time.Hour, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.Cfg.Wallet.UnbindCooldown = c.cooldown
+			mock := useMockDB(t)
+			if c.want == 0 {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_wallet WHERE id = ? AND username = ?`)).
+					WithArgs(7, "alice").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE username = ? AND is_primary = 1`)).
+					WithArgs("alice").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET wallet_address`)).
+					WithArgs("alice", "alice").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			wallet := &model.UserWallet{ID: 7, Username: "alice", CreatedAt: time.Now().Add(-c.age)}
+			got := serveJSON(t, func(ctx *gin.Context) { unbindUserWallet(ctx, wallet) }, nil)
+			if got != c.want {
+				t.Errorf("unbind error = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/mailer"
+	"net/http"
+	"strconv"
+)
+
+type withdrawTransitionParams struct {
+	ID     int64  `json:"id"`
+	Hash   string `json:"hash"`
+	Reason string `json:"reason"`
+}
+
+func ApproveWithdrawHandler(c *gin.Context) {
+	transitionWithdraw(c, model.WithdrawStatusApproved)
+}
+
+func BroadcastWithdrawHandler(c *gin.Context) {
+	transitionWithdraw(c, model.WithdrawStatusBroadcast)
+}
+
+func ConfirmWithdrawHandler(c *gin.Context) {
+	transitionWithdraw(c, model.WithdrawStatusConfirmed)
+}
+
+func RejectWithdrawHandler(c *gin.Context) {
+	transitionWithdraw(c, model.WithdrawStatusRejected)
+}
+
+func FailWithdrawHandler(c *gin.Context) {
+	transitionWithdraw(c, model.WithdrawStatusFailed)
+}
+
+// transitionWithdraw moves the withdraw request to the status, the broadcast requests must carry the transaction hash
+// and the rejected or failed requests must give the reason, which is sent to the user.
+func transitionWithdraw(c *gin.Context, to model.WithdrawStatus) {
+	claims := jwt.ExtractClaims(c)
+	operator := claims[identityKey].(string)
+
+	var params withdrawTransitionParams
+	if err := c.BindJSON(&params); err != nil || params.ID <= 0 {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	switch to {
+	case model.WithdrawStatusBroadcast:
+		if params.Hash == "" {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	case model.WithdrawStatusRejected, model.WithdrawStatusFailed:
+		if params.Reason == "" {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+
+	withdraw, err := dao.TransitionWithdraw(c.Request.Context(), params.ID, to, operator, params.Hash, params.Reason)
+	if err == dao.ErrNoRow {
+		c.JSON(http.StatusOK, respErrorCode(errors.NotFound, c))
+		return
+	}
+
+	if err == dao.ErrWithdrawTransitionNotAllowed {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidWithdrawStatus, c))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("transition withdraw %d to %s: %v", params.ID, model.WithdrawStatusNames[to], err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	notifyWithdrawStatus(c, withdraw)
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"withdraw": withdraw,
+	}))
+}
+
+// notifyWithdrawStatus queues the status change email, the failure doesn't roll back the transition.
+func notifyWithdrawStatus(c *gin.Context, withdraw *model.Withdraw) {
+	user, err := dao.GetUserByUsername(c.Request.Context(), withdraw.Username)
+	if err != nil {
+		log.Errorf("get user %s: %v", withdraw.Username, err)
+		return
+	}
+
+	if user.UserEmail == "" {
+		return
+	}
+
+	data := mailer.WithdrawStatusData{
+		Amount:    strconv.FormatInt(withdraw.Amount, 10),
+		ToAddress: withdraw.ToAddress,
+		Status:    model.WithdrawStatusNames[withdraw.Status],
+		Reason:    withdraw.Reason,
+		Hash:      withdraw.Hash,
+	}
+
+	if err = mailer.Enqueue(user.UserEmail, model.LanguageEN, mailer.TemplateWithdrawStatus, data); err != nil {
+		log.Errorf("notify withdraw %d: %v", withdraw.ID, err)
+	}
+}
+
+func GetWithdrawRequestsHandler(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	option := dao.QueryOption{
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	status := int64(-1)
+	if s := c.Query("status"); s != "" {
+		var err error
+		status, err = strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+			return
+		}
+	}
+
+	total, list, err := dao.GetWithdrawRequests(c.Request.Context(), c.Query("username"), int32(status), option)
+	if err != nil {
+		log.Errorf("get withdraw requests: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list":  list,
+		"total": total,
+	}))
+}
+
+func GetWithdrawAuditsHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, respErrorCode(errors.InvalidParams, c))
+		return
+	}
+
+	list, err := dao.GetWithdrawAudits(c.Request.Context(), id)
+	if err != nil {
+		log.Errorf("get withdraw audits: %v", err)
+		c.JSON(http.StatusOK, respErrorCode(errors.InternalServer, c))
+		return
+	}
+
+	c.JSON(http.StatusOK, respJSON(JsonObject{
+		"list": list,
+	}))
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/Filecoin-Titan/titan/api/types"
+	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
 	"github.com/gnasnik/titan-explorer/core/statistics"
+	gocid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-car"
 	"github.com/pkg/errors"
 	"github.com/quic-go/quic-go/http3"
-	"go.etcd.io/etcd/client/pkg/v3/fileutil"
 	"io"
 	"net/http"
 	"os"
@@ -30,58 +33,158 @@ const (
 	StorageAPI        = "https://api-storage.container1.titannet.io"
 	BackupResult      = "/v1/storage/backup_result"
 	BackupAssets      = "/v1/storage/backup_assets"
+	partialDir        = ".partial"
+	maxRetries        = 5
 )
 
 var log = logging.Logger("backup")
 
 var backupInterval = time.Minute * 10
 
+var reportInterval = time.Minute
+
+// the delay before retrying a failed download, doubled on each retry up to retryMaxDelay
+var (
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
 type Downloader struct {
-	lk         sync.Mutex
 	schedulers []*statistics.Scheduler
 
-	JobQueue chan []*model.Asset
-	dirSize  map[string]int64
-	token    string
+	JobQueue chan *model.Asset
+	cfg      config.StorageBackupConfig
+	journal  *Journal
+	target   BackupTarget
+	// apiClient requests the storage api, nodeClient downloads the CARFiles from the nodes.
+	apiClient  *http.Client
+	nodeClient *http.Client
+	// finished notifies the reporter to push the results
+	finished chan struct{}
 }
 
-func newDownloader(token string, scheduler []*statistics.Scheduler) *Downloader {
+func newDownloader(cfg config.StorageBackupConfig, journal *Journal, target BackupTarget, scheduler []*statistics.Scheduler) *Downloader {
 	return &Downloader{
-		JobQueue:   make(chan []*model.Asset, 1),
-		dirSize:    make(map[string]int64),
+		JobQueue:   make(chan *model.Asset, cfg.Workers),
 		schedulers: scheduler,
-		token:      token,
+		cfg:        cfg,
+		journal:    journal,
+		target:     target,
+		apiClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: cfg.APISkipVerify,
+				},
+			},
+		},
+		nodeClient: &http.Client{
+			Transport: &http3.RoundTripper{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: cfg.NodeSkipVerify,
+				},
+			},
+		},
+		finished: make(chan struct{}, 1),
 	}
 }
 
+// Push adds the assets not in the journal to the job queue.
 func (d *Downloader) Push(jobs []*model.Asset) {
-	d.lk.Lock()
-	defer d.lk.Unlock()
+	assets, err := d.journal.Enqueue(jobs)
+	if err != nil {
+		log.Errorf("journal enqueue: %v", err)
+	}
 
-	d.JobQueue <- jobs
+	log.Infof("queued %d new jobs", len(assets))
+
+	for _, asset := range assets {
+		d.JobQueue <- asset
+	}
 }
 
-func (d *Downloader) create(ctx context.Context, job *model.Asset) (*model.Asset, error) {
-	dir := job.EndTime.Format(dirDateTimeFormat)
+// resume adds the unfinished jobs of the last run to the job queue.
+func (d *Downloader) resume() {
+	pending := d.journal.Pending()
+	if len(pending) == 0 {
+		return
+	}
 
-	outPath, err := d.getOutPath(dir)
-	if err != nil {
-		return nil, err
+	log.Infof("resume %d jobs from journal", len(pending))
+
+	for _, asset := range pending {
+		d.JobQueue <- asset
 	}
+}
 
-	err = d.download(ctx, outPath, job.Cid, job.TotalSize)
+func (d *Downloader) create(ctx context.Context, job *model.Asset) (*model.Asset, error) {
+	tmpPath, err := d.download(ctx, job)
 	if err != nil {
 		log.Errorf("download CARFile %s: %v", job.Cid, err)
 		job.Event = ErrorEventID
 		return job, err
 	}
 
+	start := time.Now()
+	outPath, err := d.target.Store(ctx, job, tmpPath)
+	storeLatency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Errorf("store CARFile %s: %v", job.Cid, err)
+		return nil, err
+	}
+
+	if err = os.Remove(partialSourcePath(tmpPath)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("remove partial source: %v", err)
+	}
+
 	job.Path = outPath
 	return job, nil
 }
 
-func (d *Downloader) download(ctx context.Context, outPath, cid string, size int64) error {
-	var outErr error
+// download downloads the CARFile to the temp directory and returns the path of the verified file,
+// the partial file is kept to resume from, it is verified against the asset before it's handed to the target.
+func (d *Downloader) download(ctx context.Context, job *model.Asset) (string, error) {
+	cid := job.Cid
+
+	var (
+		tmpPath string
+		err     error
+	)
+
+	backoff := retryBaseDelay
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			log.Infof("retry download CARFile %s in %v, attempt %d", cid, backoff, attempt)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+
+			backoff *= 2
+			if backoff > retryMaxDelay {
+				backoff = retryMaxDelay
+			}
+		}
+
+		tmpPath, err = d.tryDownload(ctx, job)
+		if err == nil {
+			return tmpPath, nil
+		}
+
+		log.Errorf("download CARFile %s: %v", cid, err)
+	}
+
+	return "", err
+}
+
+func (d *Downloader) tryDownload(ctx context.Context, job *model.Asset) (string, error) {
+	outErr := errors.New("no scheduler available")
+
+	cid := job.Cid
+	tmpPath, err := d.partialPath(cid)
+	if err != nil {
+		return "", err
+	}
 
 	for _, scheduler := range d.schedulers {
 		downloadInfos, err := scheduler.Api.GetCandidateDownloadInfos(ctx, cid)
@@ -97,47 +200,208 @@ func (d *Downloader) download(ctx context.Context, outPath, cid string, size int
 		}
 
 		for _, downloadInfo := range downloadInfos {
-			reader, err := request(downloadInfo.Address, cid, downloadInfo.Tk)
+			err = d.fetchPartial(ctx, tmpPath, downloadInfo.Address, cid, downloadInfo.Tk)
 			if err != nil {
 				log.Errorf("download requeset: %v", err)
 				outErr = err
 				continue
 			}
 
-			file, err := os.Create(filepath.Join(outPath, cid+".car"))
-			if err != nil {
+			if err = verifyCARFile(tmpPath, job); err != nil {
+				// the partial file is corrupted, start over next time
+				removePartial(tmpPath)
 				outErr = err
-				return err
+				continue
 			}
 
-			_, err = io.Copy(file, reader)
-			if err != nil {
-				outErr = err
-				return err
-			}
+			log.Infof("Successfully download CARFile %s.\n", cid)
+			return tmpPath, nil
+		}
+	}
 
-			d.lk.Lock()
-			d.dirSize[outPath] += size
-			d.lk.Unlock()
+	return "", outErr
+}
+
+// partialPath returns the path of the partial file of the cid.
+func (d *Downloader) partialPath(cid string) (string, error) {
+	if err := os.MkdirAll(d.cfg.TmpDir, 0775); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.cfg.TmpDir, cid+".car.part"), nil
+}
 
-			outErr = nil
+// partialSourcePath returns the path of the file keeping the candidate the partial file is downloaded from.
+func partialSourcePath(tmpPath string) string {
+	return tmpPath + ".src"
+}
 
-			log.Infof("Successfully download CARFile %s.\n", outPath)
-			return nil
+// removePartial removes the partial file with its source.
+func removePartial(tmpPath string) {
+	for _, path := range []string{tmpPath, partialSourcePath(tmpPath)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Errorf("remove partial file: %v", err)
 		}
 	}
+}
+
+// resetPartial empties the partial file and records the candidate it's downloaded from, the partial file of another
+// candidate can't be resumed from as the candidates may encode the CARFile in a different block order.
+func resetPartial(file *os.File, tmpPath, url string) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return os.WriteFile(partialSourcePath(tmpPath), []byte(url), 0664)
+}
+
+// fetchPartial appends the rest of the CARFile to the partial file, it starts over if the partial file is from another
+// candidate, the range request is not supported or the range is not satisfiable.
+func (d *Downloader) fetchPartial(ctx context.Context, tmpPath, url, cid string, token *types.Token) error {
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	source, err := os.ReadFile(partialSourcePath(tmpPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if string(source) != url {
+		if err = resetPartial(file, tmpPath, url); err != nil {
+			return err
+		}
+	}
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.request(ctx, url, cid, token, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the partial file doesn't match the CARFile of the candidate, start over
+		resp.Body.Close()
+		if err = resetPartial(file, tmpPath, url); err != nil {
+			return err
+		}
+
+		resp, err = d.request(ctx, url, cid, token, 0)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if err = file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("http request: %d %v", resp.StatusCode, resp.Status)
+	}
+
+	n, err := io.Copy(file, resp.Body)
+	downloadedBytes.Add(float64(n))
+	if err != nil {
+		return err
+	}
 
-	return outErr
+	return file.Sync()
+}
+
+// verifyCARFile checks the root of the CARFile is the cid of the asset, every block matches its cid and the size of
+// the blocks is the size of the asset if it's known.
+func verifyCARFile(path string, asset *model.Asset) error {
+	expect, err := gocid.Decode(asset.Cid)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := car.NewCarReader(bufio.NewReader(file))
+	if err != nil {
+		return errors.Wrap(err, "read car header")
+	}
+
+	var hasRoot bool
+	for _, root := range reader.Header.Roots {
+		if root.Equals(expect) {
+			hasRoot = true
+			break
+		}
+	}
+
+	if !hasRoot {
+		return errors.Errorf("CARFile roots %v mismatch %s", reader.Header.Roots, asset.Cid)
+	}
+
+	var (
+		size      int64
+		rootFound bool
+	)
+
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "read car block")
+		}
+
+		sum, err := block.Cid().Prefix().Sum(block.RawData())
+		if err != nil {
+			return errors.Wrapf(err, "hash block %s", block.Cid())
+		}
+
+		if !sum.Equals(block.Cid()) {
+			return errors.Errorf("block %s mismatch its data %s", block.Cid(), sum)
+		}
+
+		if block.Cid().Equals(expect) {
+			rootFound = true
+		}
+		size += int64(len(block.RawData()))
+	}
+
+	if !rootFound {
+		return errors.Errorf("CARFile root block %s not found", asset.Cid)
+	}
+
+	if asset.TotalSize > 0 && size != asset.TotalSize {
+		return errors.Errorf("CARFile size %d mismatch the asset size %d", size, asset.TotalSize)
+	}
+
+	return nil
 }
 
 func (d *Downloader) async() {
-	ticker := time.NewTicker(backupInterval)
+	ticker := time.NewTicker(d.cfg.PollInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			assets, err := getJobs()
+			assets, err := d.getJobs()
 			if err != nil {
 				log.Errorf("get jobs: %v", err)
 				continue
@@ -150,93 +414,126 @@ func (d *Downloader) async() {
 			log.Infof("fetch %d jobs", len(assets))
 
 			d.Push(assets)
-			ticker.Reset(backupInterval)
+			ticker.Reset(d.cfg.PollInterval)
 		}
 	}
 
 }
 
 func (d *Downloader) run() {
-	for {
-		select {
-		case jobs := <-d.JobQueue:
-			var todo []*model.Asset
+	go d.report()
+	go d.resume()
 
-			for _, job := range jobs {
-				j, err := d.create(context.Background(), job)
-				if err != nil {
-					log.Errorf("download: %v", err)
-				}
+	d.startWorkers().Wait()
+}
 
-				log.Infof("process job: %s event: %d, path: %s", j.Cid, j.Event, j.Path)
-				todo = append(todo, j)
-			}
+// runOnce downloads the unfinished jobs in the journal and one batch of new jobs, then reports the results.
+func (d *Downloader) runOnce() error {
+	assets, err := d.getJobs()
+	if err != nil {
+		return err
+	}
 
-			if len(jobs) == 0 {
-				continue
-			}
+	jobs := d.journal.Pending()
+	queued, err := d.journal.Enqueue(assets)
+	if err != nil {
+		return err
+	}
+	jobs = append(jobs, queued...)
 
-			err := pushResult(d.token, todo)
-			if err != nil {
-				log.Errorf("push result: %v", err)
-			}
-		}
+	log.Infof("fetch %d jobs, %d to download", len(assets), len(jobs))
 
+	wg := d.startWorkers()
+	for _, job := range jobs {
+		d.JobQueue <- job
 	}
+	close(d.JobQueue)
+	wg.Wait()
+
+	return d.reportFinished()
 }
 
-func (d *Downloader) createOrGetSize(dir string) (int64, error) {
-	if !fileutil.Exist(dir) {
-		return 0, os.Mkdir(dir, 0775)
+// startWorkers starts the download workers, the workers exit when the job queue is closed.
+func (d *Downloader) startWorkers() *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(d.cfg.Workers)
+	for i := 0; i < d.cfg.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range d.JobQueue {
+				d.process(job)
+			}
+		}()
 	}
+	return &wg
+}
 
-	d.lk.Lock()
-	defer d.lk.Unlock()
-
-	if size, ok := d.dirSize[dir]; ok {
-		return size, nil
+func (d *Downloader) process(job *model.Asset) {
+	if err := d.journal.SetState(job, stateDownloading); err != nil {
+		log.Errorf("journal set state: %v", err)
 	}
 
-	size, err := getDirSize(dir)
+	state := stateDone
+	j, err := d.create(context.Background(), job)
 	if err != nil {
-		return 0, err
+		log.Errorf("download: %v", err)
+		state = stateFailed
 	}
-	d.dirSize[dir] = size
-
-	return size, nil
-}
 
-func getDirSize(path string) (int64, error) {
-	var size int64
-	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
-		if !info.IsDir() {
-			size += info.Size()
+	if j == nil {
+		// the output path is not available, keep the job queued for the next run
+		if err = d.journal.SetState(job, stateQueued); err != nil {
+			log.Errorf("journal set state: %v", err)
 		}
-		return err
-	})
-	return size, err
+		processedAssets.WithLabelValues("requeued").Inc()
+		return
+	}
+
+	processedAssets.WithLabelValues(state).Inc()
+
+	log.Infof("process job: %s event: %d, path: %s", j.Cid, j.Event, j.Path)
+
+	if err = d.journal.SetState(j, state); err != nil {
+		log.Errorf("journal set state: %v", err)
+	}
+
+	select {
+	case d.finished <- struct{}{}:
+	default:
+	}
 }
 
-func (d *Downloader) getOutPath(dir string) (string, error) {
-	var outPath string
+// report pushes the results of the finished jobs, the reported jobs are removed from the journal.
+func (d *Downloader) report() {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
 
-	for c := 'a'; c < 'z'; c++ {
-		outPath = filepath.Join(BackupOutPath, fmt.Sprintf("%s%c", dir, c))
-		size, err := d.createOrGetSize(outPath)
-		if err != nil {
-			log.Errorf("createOrGetSize %s: %v", dir, err)
-			return "", err
+	for {
+		select {
+		case <-d.finished:
+		case <-ticker.C:
 		}
 
-		if size < maxSingleDirSize {
-			break
+		if err := d.reportFinished(); err != nil {
+			log.Errorf("report finished jobs: %v", err)
 		}
 	}
+}
+
+func (d *Downloader) reportFinished() error {
+	todo := d.journal.Finished()
+	if len(todo) == 0 {
+		return nil
+	}
+
+	if err := d.pushResult(todo); err != nil {
+		return errors.Wrap(err, "push result")
+	}
 
-	return outPath, nil
+	return d.journal.Remove(todo)
 }
 
-func request(url, cid string, token *types.Token) (io.ReadCloser, error) {
+func (d *Downloader) request(ctx context.Context, url, cid string, token *types.Token, offset int64) (*http.Response, error) {
 	var scheme string
 	if !strings.HasPrefix(url, "http") {
 		scheme = "https://"
@@ -246,47 +543,32 @@ func request(url, cid string, token *types.Token) (io.ReadCloser, error) {
 
 	log.Debugf("endpoint: %s", endpoint)
 
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	//req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", start, end))
-
-	client := http.Client{
-		Transport: &http3.RoundTripper{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("http request: %d %v", resp.StatusCode, resp.Status)
+	if offset > 0 {
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	return resp.Body, err
+	return d.nodeClient.Do(req)
 }
 
-func pushResult(token string, jobs []*model.Asset) error {
+func (d *Downloader) pushResult(jobs []*model.Asset) error {
 	data, err := json.Marshal(jobs)
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s%s", StorageAPI, BackupResult)
+	url := fmt.Sprintf("%s%s", d.cfg.StorageAPI, BackupResult)
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	req.Header.Add("Authorization", "Bearer "+d.cfg.Token)
+	resp, err := d.apiClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -305,15 +587,15 @@ type getJobResp struct {
 	Data interface{}
 }
 
-func getJobs() ([]*model.Asset, error) {
-	url := fmt.Sprintf("%s%s", StorageAPI, BackupAssets)
+func (d *Downloader) getJobs() ([]*model.Asset, error) {
+	url := fmt.Sprintf("%s%s", d.cfg.StorageAPI, BackupAssets)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	req.Header.Add("Authorization", "Bearer "+d.cfg.Token)
+	resp, err := d.apiClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
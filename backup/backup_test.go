@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	mh "github.com/multiformats/go-multihash"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockStorageAPI serves the backup jobs and records the results pushed back.
+type mockStorageAPI struct {
+	t     *testing.T
+	token string
+	jobs  []*model.Asset
+
+	lk      sync.Mutex
+	results []*model.Asset
+}
+
+func (m *mockStorageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+m.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == BackupAssets:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": 0,
+			"data": map[string]interface{}{"list": m.jobs, "total": len(m.jobs)},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == BackupResult:
+		var results []*model.Asset
+		if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+			m.t.Errorf("decode backup result: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.lk.Lock()
+		m.results = append(m.results, results...)
+		m.lk.Unlock()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunOnceMockStorageAPI(t *testing.T) {
+	retryBaseDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+
+	api := &mockStorageAPI{
+		t:     t,
+		token: "backup-token",
+		jobs: []*model.Asset{
+			{Cid: "bafkreie7selb6q2dhze2nxtnw2anph3acwps4swjc4tcdijiizbicwcebm", TotalSize: 4},
+		},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := config.StorageBackupConfig{
+		StorageAPI: server.URL,
+		Token:      api.token,
+		Workers:    1,
+		TmpDir:     filepath.Join(dir, partialDir),
+	}
+
+	jl, err := openJournal(filepath.Join(dir, "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no scheduler serves the CARFile, the job is reported as failed
+	d := newDownloader(cfg, jl, newLocalTarget(dir, 0), nil)
+	if err = d.runOnce(); err != nil {
+		t.Fatalf("run once: %v", err)
+	}
+
+	if len(api.results) != 1 {
+		t.Fatalf("got %d results, want 1", len(api.results))
+	}
+
+	result := api.results[0]
+	if result.Cid != api.jobs[0].Cid || result.Event != ErrorEventID {
+		t.Errorf("got result %s event %d, want %s event %d", result.Cid, result.Event, api.jobs[0].Cid, ErrorEventID)
+	}
+
+	if pending, finished := jl.Pending(), jl.Finished(); len(pending) != 0 || len(finished) != 0 {
+		t.Errorf("journal not cleared, pending: %d finished: %d", len(pending), len(finished))
+	}
+}
+
+func rawCid(t *testing.T, data []byte) gocid.Cid {
+	hash, err := mh.Sum(data, mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gocid.NewCidV1(gocid.Raw, hash)
+}
+
+// carBlock is a block of a CARFile, the data doesn't match the cid if the block is corrupted.
+type carBlock struct {
+	cid  gocid.Cid
+	data []byte
+}
+
+func newCARFile(t *testing.T, root gocid.Cid, blocks ...carBlock) []byte {
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []gocid.Cid{root}, Version: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if err := util.LdWrite(&buf, block.cid.Bytes(), block.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyCARFile(t *testing.T) {
+	data, other := []byte("titan"), []byte("storage")
+	root, otherCid := rawCid(t, data), rawCid(t, other)
+	valid := newCARFile(t, root, carBlock{root, data}, carBlock{otherCid, other})
+
+	cases := []struct {
+		name  string
+		file  []byte
+		asset model.Asset
+		err   string
+	}{
+		{"valid", valid, model.Asset{Cid: root.String(), TotalSize: int64(len(data) + len(other))}, ""},
+		{"size unknown", valid, model.Asset{Cid: root.String()}, ""},
+		{"wrong root", valid, model.Asset{Cid: otherCid.String()}, "roots"},
+		{"corrupted block", newCARFile(t, root, carBlock{root, data}, carBlock{otherCid, []byte("storagf")}), model.Asset{Cid: root.String()}, "mismatch"},
+		{"root block missing", newCARFile(t, root, carBlock{otherCid, other}), model.Asset{Cid: root.String()}, "not found"},
+		{"size mismatch", valid, model.Asset{Cid: root.String(), TotalSize: int64(len(data))}, "size"},
+		{"truncated", valid[:len(valid)-3], model.Asset{Cid: root.String()}, "read car block"},
+		{"not a CARFile", []byte("<html>not found</html>"), model.Asset{Cid: root.String()}, "read car header"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "asset.car")
+			if err := os.WriteFile(path, c.file, 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			err := verifyCARFile(path, &c.asset)
+			if c.err == "" && err != nil {
+				t.Errorf("verifyCARFile() = %v, want nil", err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("verifyCARFile() = %v, want an error of %q", err, c.err)
+			}
+		})
+	}
+}
+
+// rangeServer serves the content with range requests unless ignoreRange, and records the ranges requested.
+type rangeServer struct {
+	content     []byte
+	ignoreRange bool
+
+	lk     sync.Mutex
+	ranges []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.lk.Unlock()
+
+	if s.ignoreRange {
+		w.Write(s.content)
+		return
+	}
+	http.ServeContent(w, r, "asset.car", time.Time{}, bytes.NewReader(s.content))
+}
+
+func TestFetchPartial(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	cases := []struct {
+		name        string
+		partial     []byte
+		source      string
+		ignoreRange bool
+		ranges      []string
+	}{
+		{"no partial file", nil, "", false, []string{""}},
+		{"resumed", content[:8], "server", false, []string{"bytes=8-"}},
+		{"range ignored", content[:8], "server", true, []string{"bytes=8-"}},
+		{"range not satisfiable", append(append([]byte{}, content...), "garbage"...), "server", false, []string{"bytes=27-", ""}},
+		{"candidate changed", []byte("0123xxxx"), "http://other", false, []string{""}},
+		{"source unknown", []byte("0123xxxx"), "", false, []string{""}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &rangeServer{content: content, ignoreRange: c.ignoreRange}
+			server := httptest.NewServer(srv)
+			defer server.Close()
+
+			tmpPath := filepath.Join(t.TempDir(), "asset.car.part")
+			if c.partial != nil {
+				if err := os.WriteFile(tmpPath, c.partial, 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.source != "" {
+				source := strings.Replace(c.source, "server", server.URL, 1)
+				if err := os.WriteFile(partialSourcePath(tmpPath), []byte(source), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d := &Downloader{nodeClient: server.Client()}
+			if err := d.fetchPartial(context.Background(), tmpPath, server.URL, "cid", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(tmpPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("partial file = %q, want %q", got, content)
+			}
+
+			source, err := os.ReadFile(partialSourcePath(tmpPath))
+			if err != nil || string(source) != server.URL {
+				t.Errorf("partial source = %q %v, want %s", source, err, server.URL)
+			}
+
+			if strings.Join(srv.ranges, ",") != strings.Join(c.ranges, ",") {
+				t.Errorf("ranges requested = %q, want %q", srv.ranges, c.ranges)
+			}
+		})
+	}
+}
+
+func TestFetchPartialStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tmpPath := filepath.Join(t.TempDir(), "asset.car.part")
+	d := &Downloader{nodeClient: server.Client()}
+	if err := d.fetchPartial(context.Background(), tmpPath, server.URL, "cid", nil); err == nil {
+		t.Error("fetchPartial() = nil, want the status error")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	stateQueued      = "queued"
+	stateDownloading = "downloading"
+	stateDone        = "done"
+	stateFailed      = "failed"
+)
+
+type journalEntry struct {
+	Asset     *model.Asset `json:"asset"`
+	State     string       `json:"state"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Journal keeps the state of the backup jobs in a local file, the unfinished jobs are resumed on restart,
+// the finished jobs are removed after their results are reported.
+type Journal struct {
+	lk      sync.Mutex
+	path    string
+	entries map[string]*journalEntry
+}
+
+func openJournal(path string) (*Journal, error) {
+	j := &Journal{
+		path:    path,
+		entries: make(map[string]*journalEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &j.entries); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Enqueue adds the assets to the journal, returns the assets not in the journal yet.
+func (j *Journal) Enqueue(assets []*model.Asset) ([]*model.Asset, error) {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	var out []*model.Asset
+	for _, asset := range assets {
+		if _, ok := j.entries[asset.Cid]; ok {
+			continue
+		}
+
+		// keep a copy, the asset is modified by the workers
+		copied := *asset
+		j.entries[asset.Cid] = &journalEntry{Asset: &copied, State: stateQueued, UpdatedAt: time.Now()}
+		out = append(out, asset)
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	return out, j.save()
+}
+
+// SetState updates the state of the asset.
+func (j *Journal) SetState(asset *model.Asset, state string) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	copied := *asset
+	j.entries[asset.Cid] = &journalEntry{Asset: &copied, State: state, UpdatedAt: time.Now()}
+	return j.save()
+}
+
+// Pending returns the assets queued or downloading, downloading assets are interrupted by the last exit.
+func (j *Journal) Pending() []*model.Asset {
+	return j.list(stateQueued, stateDownloading)
+}
+
+// Finished returns the assets done or failed whose results are not reported.
+func (j *Journal) Finished() []*model.Asset {
+	return j.list(stateDone, stateFailed)
+}
+
+func (j *Journal) list(states ...string) []*model.Asset {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	var out []*model.Asset
+	for _, entry := range j.entries {
+		for _, state := range states {
+			if entry.State == state {
+				copied := *entry.Asset
+				out = append(out, &copied)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// Remove removes the reported assets from the journal.
+func (j *Journal) Remove(assets []*model.Asset) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	for _, asset := range assets {
+		delete(j.entries, asset.Cid)
+	}
+
+	return j.save()
+}
+
+// save writes the journal to a temp file and renames it, must be called with the lock held.
+func (j *Journal) save() error {
+	data, err := json.Marshal(j.entries)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(j.path), 0775); err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0664); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.path)
+}
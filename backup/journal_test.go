@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func assetCids(assets []*model.Asset) []string {
+	var out []string
+	for _, asset := range assets {
+		out = append(out, asset.Cid)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestJournalEnqueue(t *testing.T) {
+	jl, err := openJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued, err := jl.Enqueue([]*model.Asset{{Cid: "a"}, {Cid: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := assetCids(queued); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("queued %v, want [a b]", got)
+	}
+
+	// a is downloading and b is done, neither is queued again
+	if err = jl.SetState(&model.Asset{Cid: "a"}, stateDownloading); err != nil {
+		t.Fatal(err)
+	}
+	if err = jl.SetState(&model.Asset{Cid: "b"}, stateDone); err != nil {
+		t.Fatal(err)
+	}
+
+	queued, err = jl.Enqueue([]*model.Asset{{Cid: "a"}, {Cid: "b"}, {Cid: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := assetCids(queued); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("queued %v, want [c]", got)
+	}
+
+	if queued, err = jl.Enqueue([]*model.Asset{{Cid: "c"}}); err != nil || len(queued) != 0 {
+		t.Errorf("Enqueue() = %v %v, want nothing queued", assetCids(queued), err)
+	}
+}
+
+func TestJournalReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	jl, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = jl.Enqueue([]*model.Asset{{Cid: "queued"}, {Cid: "downloading"}, {Cid: "done"}, {Cid: "failed"}}); err != nil {
+		t.Fatal(err)
+	}
+	for cid, state := range map[string]string{"downloading": stateDownloading, "done": stateDone, "failed": stateFailed} {
+		if err = jl.SetState(&model.Asset{Cid: cid, Path: "/carfile/" + cid}, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the process restarts
+	jl, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := assetCids(jl.Pending()); !reflect.DeepEqual(got, []string{"downloading", "queued"}) {
+		t.Errorf("pending %v, want [downloading queued]", got)
+	}
+	if got := assetCids(jl.Finished()); !reflect.DeepEqual(got, []string{"done", "failed"}) {
+		t.Errorf("finished %v, want [done failed]", got)
+	}
+	for _, asset := range jl.Finished() {
+		if asset.Path != "/carfile/"+asset.Cid {
+			t.Errorf("asset %s path %s, want the path saved", asset.Cid, asset.Path)
+		}
+	}
+}
+
+func TestJournalRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	jl, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = jl.Enqueue([]*model.Asset{{Cid: "queued"}, {Cid: "done"}, {Cid: "failed"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = jl.SetState(&model.Asset{Cid: "done"}, stateDone); err != nil {
+		t.Fatal(err)
+	}
+	if err = jl.SetState(&model.Asset{Cid: "failed"}, stateFailed); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the result of done is reported
+	if err = jl.Remove([]*model.Asset{{Cid: "done"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	jl, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := assetCids(jl.Pending()); !reflect.DeepEqual(got, []string{"queued"}) {
+		t.Errorf("pending %v, want [queued]", got)
+	}
+	if got := assetCids(jl.Finished()); !reflect.DeepEqual(got, []string{"failed"}) {
+		t.Errorf("finished %v, want [failed]", got)
+	}
+
+	// a removed asset can be queued again
+	if queued, err := jl.Enqueue([]*model.Asset{{Cid: "done"}}); err != nil || len(queued) != 1 {
+		t.Errorf("Enqueue() = %v %v, want the removed asset queued", assetCids(queued), err)
+	}
+}
+
+func TestOpenJournalCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	if err := os.WriteFile(path, []byte("{"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openJournal(path); err == nil {
+		t.Error("openJournal() of a corrupted file should fail")
+	}
+}
@@ -3,25 +3,119 @@ package main
 import (
 	"flag"
 	"github.com/gnasnik/titan-explorer/api"
+	"github.com/gnasnik/titan-explorer/config"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/spf13/viper"
+	"path/filepath"
 )
 
 var (
-	etcd     string
-	user     string
-	password string
-	token    string
+	configPath string
+	etcd       string
+	user       string
+	password   string
+	once       bool
+
+	backupCfg config.StorageBackupConfig
 )
 
 func init() {
+	flag.StringVar(&configPath, "config", "", "path of the config file, the flags set explicitly override it")
 	flag.StringVar(&etcd, "etcd", "", "etcd address")
 	flag.StringVar(&user, "user", "", "etcd user")
 	flag.StringVar(&password, "password", "", "etcd password")
-	flag.StringVar(&token, "token", "", "storage api authenticate token")
+	flag.BoolVar(&once, "once", false, "fetch one batch of jobs, download and report them, then exit")
+
+	flag.StringVar(&backupCfg.StorageAPI, "api", StorageAPI, "storage api endpoint")
+	flag.StringVar(&backupCfg.Token, "token", "", "storage api authenticate token")
+	flag.DurationVar(&backupCfg.PollInterval, "interval", backupInterval, "interval of fetching the backup jobs")
+	flag.BoolVar(&backupCfg.APISkipVerify, "api-skip-verify", false, "skip the tls verification of the storage api")
+	flag.BoolVar(&backupCfg.NodeSkipVerify, "node-skip-verify", true, "skip the tls verification of the nodes")
+	flag.IntVar(&backupCfg.Workers, "workers", 4, "number of concurrent downloads")
+	flag.StringVar(&backupCfg.JournalPath, "journal", filepath.Join(BackupOutPath, "journal.json"), "path of the backup journal")
+	flag.StringVar(&backupCfg.TmpDir, "tmp", "", "directory of the partial downloads, the .partial directory of the output root by default")
+	flag.StringVar(&backupCfg.MetricsListen, "metrics-listen", "", "address serving the prometheus metrics, e.g. :9100")
+
+	flag.StringVar(&backupCfg.Target, "target", "local", "backup target: local, s3 or tar")
+	flag.StringVar(&backupCfg.BackupPath, "out", BackupOutPath, "output root of the local and tar target")
+	flag.Int64Var(&backupCfg.MaxDirSize, "max-dir-size", maxSingleDirSize, "max size of a backup directory of the local target")
+	flag.Int64Var(&backupCfg.MaxBundleSize, "max-bundle-size", defaultMaxBundleSize, "max size of a tar bundle of the tar target")
+	flag.StringVar(&backupCfg.S3.Endpoint, "s3-endpoint", "", "s3 endpoint, e.g. http://127.0.0.1:9000")
+	flag.StringVar(&backupCfg.S3.Region, "s3-region", "", "s3 region")
+	flag.StringVar(&backupCfg.S3.Bucket, "s3-bucket", "", "s3 bucket")
+	flag.StringVar(&backupCfg.S3.AccessKey, "s3-access-key", "", "s3 access key")
+	flag.StringVar(&backupCfg.S3.SecretKey, "s3-secret-key", "", "s3 secret key")
+	flag.Int64Var(&backupCfg.S3.MaxBucketSize, "s3-max-bucket-size", 0, "max size of the objects in the s3 bucket, 0 means no limit")
+}
+
+// loadConfig reads the StorageBackup section of the config file, the flags set explicitly take precedence.
+func loadConfig() {
+	if configPath == "" {
+		return
+	}
+
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("reading config file: %v", err)
+	}
+
+	// the flag defaults are unmarshalled over, so the values missing in the config file keep them
+	cfg := config.Config{StorageBackup: backupCfg}
+	if err := viper.Unmarshal(&cfg); err != nil {
+		log.Fatalf("unmarshaling config file: %v", err)
+	}
+
+	explicit := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	// keep the defaults of the flags for the values left empty in the config file
+	applyDefaults(&cfg.StorageBackup, backupCfg)
+	backupCfg = cfg.StorageBackup
+	if etcd == "" {
+		etcd = cfg.EtcdAddress
+	}
+
+	for name, value := range explicit {
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("set flag %s: %v", name, err)
+		}
+	}
+}
+
+func applyDefaults(cfg *config.StorageBackupConfig, defaults config.StorageBackupConfig) {
+	if cfg.StorageAPI == "" {
+		cfg.StorageAPI = defaults.StorageAPI
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.JournalPath == "" {
+		cfg.JournalPath = defaults.JournalPath
+	}
+	if cfg.TmpDir == "" {
+		cfg.TmpDir = defaults.TmpDir
+	}
+	if cfg.Target == "" {
+		cfg.Target = defaults.Target
+	}
+	if cfg.BackupPath == "" {
+		cfg.BackupPath = defaults.BackupPath
+	}
 }
 
 func main() {
 	flag.Parse()
+	loadConfig()
+
+	// the partial downloads are renamed into the output root, they must be on the same device
+	if backupCfg.TmpDir == "" {
+		backupCfg.TmpDir = filepath.Join(backupCfg.BackupPath, partialDir)
+	}
 
 	logging.SetDebugLogging()
 
@@ -29,19 +123,41 @@ func main() {
 	address = append(address, etcd)
 	eClient, err := api.NewEtcdClient(address)
 	if err != nil {
-		log.Fatal("New etcdClient Failed: %v", err)
+		log.Fatalf("New etcdClient Failed: %v", err)
 	}
 
 	schedulers, err := api.FetchSchedulers(eClient)
 	if err != nil {
-		log.Fatal("fetch scheduler from etcd Failed: %v", err)
+		log.Fatalf("fetch scheduler from etcd Failed: %v", err)
 	}
 
 	if len(schedulers) == 0 {
 		log.Fatal("no scheduler found")
 	}
 
-	downloader := newDownloader(token, schedulers)
+	jl, err := openJournal(backupCfg.JournalPath)
+	if err != nil {
+		log.Fatalf("open journal: %v", err)
+	}
+
+	target, err := newBackupTarget(backupCfg)
+	if err != nil {
+		log.Fatalf("create backup target: %v", err)
+	}
+
+	downloader := newDownloader(backupCfg, jl, target, schedulers)
+
+	if backupCfg.MetricsListen != "" {
+		go serveMetrics(backupCfg.MetricsListen)
+	}
+
+	if once {
+		if err := downloader.runOnce(); err != nil {
+			log.Fatalf("run once: %v", err)
+		}
+		return
+	}
+
 	go downloader.async()
 
 	log.Infof("Started")
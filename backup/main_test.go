@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigKeepsFlagDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(`
+[StorageBackup]
+    StorageAPI = "http://127.0.0.1:8080"
+    Workers = 8
+    PollInterval = "1m"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := backupCfg
+	defer func() {
+		backupCfg, configPath = saved, ""
+	}()
+
+	configPath = path
+	loadConfig()
+
+	if backupCfg.StorageAPI != "http://127.0.0.1:8080" || backupCfg.Workers != 8 || backupCfg.PollInterval != time.Minute {
+		t.Errorf("config file values not applied: %+v", backupCfg)
+	}
+
+	// the values missing in the config file keep the flag defaults
+	if !backupCfg.NodeSkipVerify {
+		t.Error("NodeSkipVerify lost its flag default")
+	}
+	if backupCfg.Target != "local" || backupCfg.BackupPath != BackupOutPath {
+		t.Errorf("got target %s out %s, want the flag defaults", backupCfg.Target, backupCfg.BackupPath)
+	}
+}
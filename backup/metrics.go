@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+var (
+	downloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "backup",
+		Name:      "downloaded_bytes_total",
+		Help:      "Number of bytes of the CARFiles downloaded from the nodes.",
+	})
+
+	processedAssets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "backup",
+		Name:      "assets_total",
+		Help:      "Number of the processed backup jobs by result: done, failed or requeued.",
+	}, []string{"result"})
+
+	storeLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "backup",
+		Name:      "store_duration_seconds",
+		Help:      "Time spent storing a verified CARFile into the backup target.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+)
+
+// serveMetrics exposes the metrics at /metrics of the address.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Infof("serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("serve metrics: %v", err)
+	}
+}
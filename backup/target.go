@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/client/pkg/v3/fileutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	targetLocal = "local"
+	targetS3    = "s3"
+	targetTar   = "tar"
+)
+
+// BackupTarget stores the verified CARFiles, each target owns its size limits.
+type BackupTarget interface {
+	// Store moves the CARFile at src into the target and returns the path recorded for the asset.
+	Store(ctx context.Context, job *model.Asset, src string) (string, error)
+}
+
+func newBackupTarget(cfg config.StorageBackupConfig) (BackupTarget, error) {
+	switch cfg.Target {
+	case "", targetLocal:
+		return newLocalTarget(cfg.BackupPath, cfg.MaxDirSize), nil
+	case targetS3:
+		return newS3Target(cfg.S3)
+	case targetTar:
+		return newTarTarget(cfg.BackupPath, cfg.MaxBundleSize), nil
+	default:
+		return nil, errors.Errorf("unknown backup target: %s", cfg.Target)
+	}
+}
+
+// localTarget stores the CARFiles in dated directories, a directory rolls to the next suffix when it's full.
+type localTarget struct {
+	lk         sync.Mutex
+	root       string
+	maxDirSize int64
+	dirSize    map[string]int64
+}
+
+func newLocalTarget(root string, maxDirSize int64) *localTarget {
+	if root == "" {
+		root = BackupOutPath
+	}
+
+	if maxDirSize <= 0 {
+		maxDirSize = maxSingleDirSize
+	}
+
+	return &localTarget{
+		root:       root,
+		maxDirSize: maxDirSize,
+		dirSize:    make(map[string]int64),
+	}
+}
+
+func (t *localTarget) Store(ctx context.Context, job *model.Asset, src string) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	outPath, err := t.getOutPath(job.EndTime.Format(dirDateTimeFormat))
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.Rename(src, filepath.Join(outPath, job.Cid+".car")); err != nil {
+		return "", err
+	}
+
+	t.dirSize[outPath] += info.Size()
+	return outPath, nil
+}
+
+// getOutPath must be called with the lock held.
+func (t *localTarget) getOutPath(dir string) (string, error) {
+	var outPath string
+
+	for c := 'a'; c < 'z'; c++ {
+		outPath = filepath.Join(t.root, fmt.Sprintf("%s%c", dir, c))
+		size, err := t.createOrGetSize(outPath)
+		if err != nil {
+			log.Errorf("createOrGetSize %s: %v", dir, err)
+			return "", err
+		}
+
+		if size < t.maxDirSize {
+			break
+		}
+	}
+
+	return outPath, nil
+}
+
+func (t *localTarget) createOrGetSize(dir string) (int64, error) {
+	if !fileutil.Exist(dir) {
+		return 0, os.MkdirAll(dir, 0775)
+	}
+
+	if size, ok := t.dirSize[dir]; ok {
+		return size, nil
+	}
+
+	size, err := getDirSize(dir)
+	if err != nil {
+		return 0, err
+	}
+	t.dirSize[dir] = size
+
+	return size, nil
+}
+
+func getDirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
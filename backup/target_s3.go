@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3Service         = "s3"
+	s3DefaultRegion   = "us-east-1"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	amzDateFormat     = "20060102T150405Z"
+)
+
+// s3Target uploads the CARFiles to an S3 compatible object store with path-style urls.
+type s3Target struct {
+	lk     sync.Mutex
+	cfg    config.S3Config
+	client *http.Client
+	// used is the size of the objects in the bucket, loaded on the first upload
+	used int64
+	// loaded is true after used is loaded
+	loaded bool
+}
+
+func newS3Target(cfg config.S3Config) (*s3Target, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = s3DefaultRegion
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	return &s3Target{cfg: cfg, client: http.DefaultClient}, nil
+}
+
+func (t *s3Target) Store(ctx context.Context, job *model.Asset, src string) (string, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if err = t.reserve(ctx, info.Size()); err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%s/%s.car", job.EndTime.Format(dirDateTimeFormat), job.Cid)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.objectURL(key, nil), file)
+	if err != nil {
+		t.release(info.Size())
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/vnd.ipld.car")
+	t.sign(req, s3UnsignedPayload)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		t.release(info.Size())
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.release(info.Size())
+		body, _ := io.ReadAll(resp.Body)
+		return "", errors.Errorf("put object %s: %d %s", key, resp.StatusCode, string(body))
+	}
+
+	if err = os.Remove(src); err != nil {
+		log.Errorf("remove %s: %v", src, err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", t.cfg.Bucket, key), nil
+}
+
+// reserve adds size to the bucket usage, returns error if the bucket is full.
+func (t *s3Target) reserve(ctx context.Context, size int64) error {
+	if t.cfg.MaxBucketSize <= 0 {
+		return nil
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if !t.loaded {
+		used, err := t.bucketSize(ctx)
+		if err != nil {
+			return errors.Wrap(err, "get bucket size")
+		}
+		t.used, t.loaded = used, true
+	}
+
+	if t.used+size > t.cfg.MaxBucketSize {
+		return errors.Errorf("bucket %s is full, used: %d max: %d", t.cfg.Bucket, t.used, t.cfg.MaxBucketSize)
+	}
+
+	t.used += size
+	return nil
+}
+
+func (t *s3Target) release(size int64) {
+	if t.cfg.MaxBucketSize <= 0 {
+		return
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.used -= size
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Size int64 `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// bucketSize sums the size of all objects in the bucket.
+func (t *s3Target) bucketSize(ctx context.Context) (int64, error) {
+	var (
+		size  int64
+		token string
+	)
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.objectURL("", query), nil)
+		if err != nil {
+			return 0, err
+		}
+		t.sign(req, s3EmptyPayload)
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return 0, errors.Errorf("list objects: %d %s", resp.StatusCode, string(data))
+		}
+
+		var result listBucketResult
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return 0, err
+		}
+
+		for _, content := range result.Contents {
+			size += content.Size
+		}
+
+		if !result.IsTruncated {
+			return size, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (t *s3Target) objectURL(key string, query url.Values) string {
+	u := fmt.Sprintf("%s/%s", t.cfg.Endpoint, t.cfg.Bucket)
+	if key != "" {
+		u += "/" + s3EscapePath(key)
+	}
+
+	if len(query) > 0 {
+		u += "?" + s3EscapeQuery(query)
+	}
+
+	return u
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (t *s3Target) sign(req *http.Request, payloadHash string) {
+	t.signAt(req, payloadHash, time.Now())
+}
+
+// signAt signs the request with AWS Signature Version 4 at the time, all the headers of the request are signed.
+func (t *s3Target) signAt(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var signedHeaders []string
+	for name := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(name))
+	}
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3EscapeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, t.cfg.Region, s3Service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.cfg.SecretKey), date)
+	key = hmacSHA256(key, t.cfg.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.cfg.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3EscapePath escapes each segment of the object key as required by the canonical request.
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3EscapeQuery encodes the query sorted by key as required by the canonical request.
+func s3EscapeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
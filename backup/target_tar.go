@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultMaxBundleSize = 4 << 30
+	// tarTrailerSize is the size of the two zero blocks at the end of a tar archive.
+	tarTrailerSize = 2 * 512
+)
+
+// tarTarget appends the CARFiles to dated tar bundles, a bundle rolls to the next number when it's full.
+type tarTarget struct {
+	lk            sync.Mutex
+	root          string
+	maxBundleSize int64
+}
+
+func newTarTarget(root string, maxBundleSize int64) *tarTarget {
+	if root == "" {
+		root = BackupOutPath
+	}
+
+	if maxBundleSize <= 0 {
+		maxBundleSize = defaultMaxBundleSize
+	}
+
+	return &tarTarget{
+		root:          root,
+		maxBundleSize: maxBundleSize,
+	}
+}
+
+func (t *tarTarget) Store(ctx context.Context, job *model.Asset, src string) (string, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if err := os.MkdirAll(t.root, 0775); err != nil {
+		return "", err
+	}
+
+	bundle, err := t.getBundle(job.EndTime.Format(dirDateTimeFormat))
+	if err != nil {
+		return "", err
+	}
+
+	if err = appendToBundle(bundle, src, job.Cid+".car"); err != nil {
+		return "", err
+	}
+
+	if err = os.Remove(src); err != nil {
+		log.Errorf("remove %s: %v", src, err)
+	}
+
+	return bundle, nil
+}
+
+// getBundle returns the first bundle of the date which is not full.
+func (t *tarTarget) getBundle(date string) (string, error) {
+	for i := 0; ; i++ {
+		bundle := filepath.Join(t.root, fmt.Sprintf("%s-%03d.tar", date, i))
+		info, err := os.Stat(bundle)
+		if os.IsNotExist(err) {
+			return bundle, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Size() < t.maxBundleSize {
+			return bundle, nil
+		}
+	}
+}
+
+// appendToBundle appends the file to a copy of the bundle and replaces the bundle with the copy, so the bundle is left
+// untouched if the append fails.
+func appendToBundle(bundle, src, name string) error {
+	tmp := bundle + ".tmp"
+	if err := copyBundle(bundle, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := appendToFile(tmp, src, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, bundle)
+}
+
+// copyBundle copies the bundle to dst, dst is created empty if the bundle doesn't exist yet.
+func copyBundle(bundle, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	in, err := os.Open(bundle)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// appendToFile writes the file to the end of the tar archive, the trailer of the archive is overwritten and rewritten.
+func appendToFile(archive, src, name string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(archive, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	end, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if end >= tarTrailerSize {
+		if _, err = out.Seek(-tarTrailerSize, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	tw := tar.NewWriter(out)
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(tw, in); err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendToBundle(t *testing.T) {
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "20240101-000.tar")
+
+	files := map[string]string{"a.car": "first CARFile", "b.car": "second CARFile"}
+	for _, name := range []string{"a.car", "b.car"} {
+		src := filepath.Join(dir, name)
+		if err := os.WriteFile(src, []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := appendToBundle(bundle, src, name); err != nil {
+			t.Fatalf("append %s: %v", name, err)
+		}
+	}
+
+	before, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the source is missing, the bundle must be left untouched
+	if err = appendToBundle(bundle, filepath.Join(dir, "missing.car"), "missing.car"); err == nil {
+		t.Fatal("append a missing file should fail")
+	}
+
+	after, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("bundle changed by a failed append")
+	}
+	if _, err = os.Stat(bundle + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp bundle left behind: %v", err)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(after))
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != files[header.Name] {
+			t.Errorf("%s: got %q, want %q", header.Name, data, files[header.Name])
+		}
+		names = append(names, header.Name)
+	}
+
+	if len(names) != 2 || names[0] != "a.car" || names[1] != "b.car" {
+		t.Errorf("entries: got %v", names)
+	}
+}
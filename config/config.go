@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 var Cfg Config
 
 var GNodesInfo NodesInfo
@@ -9,9 +11,14 @@ type NodesInfo struct {
 }
 
 type Config struct {
-	EtcdAddress              string
-	Mode                     string
-	ApiListen                string
+	EtcdAddress string
+	Mode        string
+	ApiListen   string
+	// MetricsListen is the internal address serving the prometheus metrics, empty disables it.
+	MetricsListen string
+	// TrustedProxies are the addresses or the CIDRs of the reverse proxies, the client ip is taken from the
+	// X-Forwarded-For and the X-Real-IP headers only for the requests coming from them.
+	TrustedProxies           []string
 	DatabaseURL              string
 	SecretKey                string
 	RedisAddr                string
@@ -24,6 +31,13 @@ type Config struct {
 	StorageBackup            StorageBackupConfig
 	IpDataCloud              IpDataCloudConfig
 	ContainerManager         ContainerManagerEndpointConfig
+	RateLimit                RateLimitConfig
+	Wallet                   WalletConfig
+}
+
+type WalletConfig struct {
+	// UnbindCooldown is how long a wallet must stay bound before it can be unbound, default is 24h.
+	UnbindCooldown time.Duration
 }
 
 type EmailConfig struct {
@@ -33,6 +47,33 @@ type EmailConfig struct {
 	SMTPPort string
 	Username string
 	Password string
+	// Transport delivers the mails: smtp, file or memory, default is smtp.
+	Transport string
+	// FileDir is where the file transport writes the mails.
+	FileDir string
+	// QueueSize is the max number of mails waiting for delivery.
+	QueueSize int
+	Workers   int
+	// MaxRetries is the max number of retries of a failed delivery.
+	MaxRetries int
+}
+
+type RateLimitConfig struct {
+	Disable bool
+	// Policies limits the requests of the route groups, key is the group name: dashboard, login, nonce, subscribe and api_key.
+	Policies map[string]RateLimitPolicy
+	// LoginMaxFailures locks the account after the failed logins within LoginFailureWindow, 0 disables the lockout.
+	LoginMaxFailures   int
+	LoginFailureWindow time.Duration
+	LoginLockDuration  time.Duration
+}
+
+type RateLimitPolicy struct {
+	// Limit is the max number of requests in the sliding Window.
+	Limit  int
+	Window time.Duration
+	// Keys are what the requests are counted by: ip, username or api_key, each key is limited separately.
+	Keys []string
 }
 
 type LocatorConfig struct {
@@ -44,6 +85,19 @@ type LocatorConfig struct {
 type StatisticsConfig struct {
 	Disable bool
 	Crontab string
+	// Jobs overrides the schedule of the statistic jobs, key is the job name.
+	// The jobs without Crontab run on the Crontab above, so do claim_user_earning and reconcile_user_reward which run
+	// after sum_device_info_profit.
+	Jobs map[string]StatisticJobConfig
+}
+
+type StatisticJobConfig struct {
+	Disable bool
+	Crontab string
+	// Concurrency is the number of workers handling the jobs pushed by the fetcher.
+	Concurrency int
+	// QueueSize is the max number of pending jobs of the fetcher, Push blocks when the queue is full.
+	QueueSize int
 }
 
 type AdminSchedulerConfig struct {
@@ -56,6 +110,38 @@ type StorageBackupConfig struct {
 	BackupPath string
 	Crontab    string
 	Disable    bool
+	// StorageAPI is the endpoint of the storage api providing the backup jobs.
+	StorageAPI string
+	// Token authenticates the backup tool to the storage api.
+	Token string
+	// PollInterval is the interval of fetching the backup jobs, e.g. 10m.
+	PollInterval time.Duration
+	// APISkipVerify disables the tls verification of the storage api.
+	APISkipVerify bool
+	// NodeSkipVerify disables the tls verification of the nodes serving the CARFiles.
+	NodeSkipVerify bool
+	Workers        int
+	JournalPath    string
+	TmpDir         string
+	// Target is where the CARFiles are stored: local, s3 or tar, default is local.
+	Target string
+	// MaxDirSize is the max size of a backup directory of the local target.
+	MaxDirSize int64
+	// MaxBundleSize is the max size of a tar bundle of the tar target.
+	MaxBundleSize int64
+	S3            S3Config
+	// MetricsListen is the address serving the prometheus metrics of the backup tool, empty disables it.
+	MetricsListen string
+}
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// MaxBucketSize is the max size of the objects in the bucket, 0 means no limit.
+	MaxBucketSize int64
 }
 
 type IpDataCloudConfig struct {
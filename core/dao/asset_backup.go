@@ -0,0 +1,156 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// AssetEventAdded is the event of the assets to backup.
+	AssetEventAdded = 1
+	// AssetEventBackupFailed is the event reported by the backup tool when the download failed.
+	AssetEventBackupFailed = 99
+)
+
+const (
+	BackupStatsByDay     = "day"
+	BackupStatsByProject = "project"
+	BackupStatsByUser    = "user"
+)
+
+var backupStatsKeys = map[string]string{
+	BackupStatsByDay:     "DATE_FORMAT(end_time, '%Y-%m-%d')",
+	BackupStatsByProject: "CAST(project_id AS CHAR)",
+	BackupStatsByUser:    "user_id",
+}
+
+// GetAssetBackupStats counts the backed-up, pending and failed assets grouped by day, project or user.
+func GetAssetBackupStats(ctx context.Context, groupBy string, option QueryOption) ([]*model.AssetBackupStats, int64, error) {
+	key, ok := backupStatsKeys[groupBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported group by: %s", groupBy)
+	}
+
+	var args []interface{}
+	where := `WHERE 1=1`
+	if option.StartTime != "" {
+		where += ` AND end_time >= ?`
+		args = append(args, option.StartTime)
+	}
+	if option.EndTime != "" {
+		where += ` AND end_time <= ?`
+		args = append(args, option.EndTime)
+	}
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(
+		`SELECT count(DISTINCT %s) FROM %s %s`, key, tableNameAsset, where,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var out []*model.AssetBackupStats
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT %s AS stat_key,
+			COUNT(IF(event = %d AND path <> '', 1, NULL)) AS backed,
+			COUNT(IF(event = %d AND path = '', 1, NULL)) AS pending,
+			COUNT(IF(event = %d, 1, NULL)) AS failed,
+			IFNULL(SUM(IF(event = %d AND path <> '', total_size, 0)), 0) AS backed_size,
+			IFNULL(SUM(IF(event = %d AND path = '', total_size, 0)), 0) AS pending_size,
+			IFNULL(SUM(IF(event = %d, total_size, 0)), 0) AS failed_size
+		FROM %s %s GROUP BY stat_key ORDER BY stat_key DESC LIMIT %d OFFSET %d`,
+		key, AssetEventAdded, AssetEventAdded, AssetEventBackupFailed, AssetEventAdded, AssetEventAdded, AssetEventBackupFailed,
+		tableNameAsset, where, limit, offset,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// GetBackupDirStats sums the size of the assets in each backup directory.
+func GetBackupDirStats(ctx context.Context) ([]*model.BackupDirStats, error) {
+	var out []*model.BackupDirStats
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT path, count(*) AS asset_count, IFNULL(SUM(total_size), 0) AS total_size FROM %s WHERE path <> '' GROUP BY path ORDER BY path`,
+		tableNameAsset,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetOldestUnbackedAsset returns the oldest asset waiting for backup.
+func GetOldestUnbackedAsset(ctx context.Context) (*model.Asset, error) {
+	var asset model.Asset
+	err := DB.GetContext(ctx, &asset, fmt.Sprintf(
+		`SELECT * FROM %s WHERE event = ? AND path = '' ORDER BY end_time ASC LIMIT 1`, tableNameAsset), AssetEventAdded)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func GetFailedBackupAssets(ctx context.Context, option QueryOption) ([]*model.Asset, int64, error) {
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(
+		`SELECT count(*) FROM %s WHERE event = ?`, tableNameAsset), AssetEventBackupFailed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var out []*model.Asset
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE event = ? ORDER BY end_time ASC LIMIT %d OFFSET %d`, tableNameAsset, limit, offset,
+	), AssetEventBackupFailed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// ResetFailedBackupAssets makes the failed assets available to the backup tool again, all failed assets are reset if cids is empty.
+func ResetFailedBackupAssets(ctx context.Context, cids []string) (int64, error) {
+	query := fmt.Sprintf(`UPDATE %s SET event = ?, path = '', updated_at = now() WHERE event = ?`, tableNameAsset)
+	args := []interface{}{AssetEventAdded, AssetEventBackupFailed}
+
+	if len(cids) > 0 {
+		var err error
+		query, args, err = sqlx.In(query+` AND cid IN (?)`, AssetEventAdded, AssetEventBackupFailed, cids)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGetAssetBackupStats(t *testing.T) {
+	cases := []struct {
+		groupBy string
+		key     string
+		option  QueryOption
+		args    []driver.Value
+		limit   string
+	}{
+		{BackupStatsByDay, "DATE_FORMAT(end_time, '%Y-%m-%d')", QueryOption{}, nil, "LIMIT 50 OFFSET 0"},
+		{BackupStatsByProject, "CAST(project_id AS CHAR)", QueryOption{Page: 3, PageSize: 10}, nil, "LIMIT 10 OFFSET 20"},
+		{BackupStatsByUser, "user_id", QueryOption{StartTime: "2024-01-01", EndTime: "2024-01-31"},
+			[]driver.Value{"2024-01-01", "2024-01-31"}, "LIMIT 50 OFFSET 0"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.groupBy, func(t *testing.T) {
+			mock := useMockDB(t)
+
+			where := `WHERE 1=1`
+			if len(c.args) > 0 {
+				where += ` AND end_time >= ? AND end_time <= ?`
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(DISTINCT ` + c.key + `) FROM assets ` + where)).
+				WithArgs(c.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery(`SELECT ` + regexp.QuoteMeta(c.key) + ` AS stat_key,` +
+				`\s+COUNT\(IF\(event = 1 AND path <> '', 1, NULL\)\) AS backed,` +
+				`\s+COUNT\(IF\(event = 1 AND path = '', 1, NULL\)\) AS pending,` +
+				`\s+COUNT\(IF\(event = 99, 1, NULL\)\) AS failed,` +
+				`.+FROM assets ` + regexp.QuoteMeta(where) + ` GROUP BY stat_key ORDER BY stat_key DESC ` + c.limit).
+				WithArgs(c.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"stat_key", "backed", "pending", "failed", "backed_size", "pending_size", "failed_size"}).
+					AddRow("b", 3, 2, 1, 300, 200, 100).
+					AddRow("a", 1, 0, 0, 100, 0, 0))
+
+			stats, total, err := GetAssetBackupStats(context.Background(), c.groupBy, c.option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []*model.AssetBackupStats{
+				{Key: "b", Backed: 3, Pending: 2, Failed: 1, BackedSize: 300, PendingSize: 200, FailedSize: 100},
+				{Key: "a", Backed: 1, BackedSize: 100},
+			}
+			if total != 2 || !reflect.DeepEqual(stats, want) {
+				t.Errorf("GetAssetBackupStats() = %v %d, want %v 2", stats, total, want)
+			}
+		})
+	}
+}
+
+func TestGetAssetBackupStatsUnsupported(t *testing.T) {
+	useMockDB(t)
+
+	if _, _, err := GetAssetBackupStats(context.Background(), "area", QueryOption{}); err == nil {
+		t.Error("GetAssetBackupStats() grouped by area, want an error")
+	}
+}
+
+func TestResetFailedBackupAssets(t *testing.T) {
+	cases := []struct {
+		name  string
+		cids  []string
+		query string
+		args  []driver.Value
+	}{
+		{"all failed", nil, `UPDATE assets SET event = ?, path = '', updated_at = now() WHERE event = ?`,
+			[]driver.Value{AssetEventAdded, AssetEventBackupFailed}},
+		{"by cid", []string{"cid1", "cid2"}, `UPDATE assets SET event = ?, path = '', updated_at = now() WHERE event = ? AND cid IN (?, ?)`,
+			[]driver.Value{AssetEventAdded, AssetEventBackupFailed, "cid1", "cid2"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectExec(regexp.QuoteMeta(c.query)).
+				WithArgs(c.args...).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+
+			affected, err := ResetFailedBackupAssets(context.Background(), c.cids)
+			if err != nil || affected != 2 {
+				t.Errorf("ResetFailedBackupAssets() = %d %v, want 2", affected, err)
+			}
+		})
+	}
+}
@@ -61,14 +61,18 @@ func Init(cfg *config.Config) error {
 }
 
 type QueryOption struct {
-	Page       int            `json:"page"`
-	PageSize   int            `json:"page_size"`
-	Order      string         `json:"order"`
-	OrderField string         `json:"order_field"`
-	StartTime  string         `json:"start_time"`
-	EndTime    string         `json:"end_time" `
-	UserID     string         `json:"user_id"`
-	Lang       model.Language `json:"-"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	Order      string `json:"order"`
+	OrderField string `json:"order_field"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time" `
+	UserID     string `json:"user_id"`
+	GroupID    int64  `json:"group_id"`
+	Tag        string `json:"tag"`
+	// FilterUserID is the user the group and the tag belong to, they are ignored without it.
+	FilterUserID string         `json:"-"`
+	Lang         model.Language `json:"-"`
 }
 
 func GetQueryDataList(sqlClause string, args ...interface{}) ([]map[string]string, error) {
@@ -0,0 +1,202 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"time"
+)
+
+const (
+	tableNameDeviceUnbindBatch = "device_unbind_batch"
+	tableNameDeviceUnbindItem  = "device_unbind_item"
+)
+
+var ErrDeviceBatchUndone = errors.New("device batch already undone")
+
+// UnbindUserDevices unbinds the devices of the user like DeviceUnBindingHandlerOld does and records the state of the
+// devices before, so the batch can be undone. The devices not bound to the user any more are skipped.
+func UnbindUserDevices(ctx context.Context, username string, deviceIds []string) (*model.DeviceUnbindBatch, []string, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	batch := &model.DeviceUnbindBatch{
+		Username:  username,
+		CreatedAt: now,
+	}
+
+	result, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (username, total, undone, undone_at, created_at) VALUES (:username, :total, :undone, :undone_at, :created_at)`,
+		tableNameDeviceUnbindBatch), batch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batch.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unbound []string
+	for _, deviceId := range deviceIds {
+		var device model.DeviceInfo
+		err = tx.GetContext(ctx, &device, fmt.Sprintf(`SELECT * FROM %s WHERE device_id = ? FOR UPDATE`, tableNameDeviceInfo), deviceId)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if device.UserID != username {
+			continue
+		}
+
+		_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (batch_id, device_id, prev_user_id, prev_bind_status, prev_bound_at, restored, created_at)
+				VALUES (:batch_id, :device_id, :prev_user_id, :prev_bind_status, :prev_bound_at, :restored, :created_at)`, tableNameDeviceUnbindItem),
+			&model.DeviceUnbindItem{
+				BatchID:        batch.ID,
+				DeviceID:       deviceId,
+				PrevUserID:     device.UserID,
+				PrevBindStatus: device.BindStatus,
+				PrevBoundAt:    device.BoundAt,
+				CreatedAt:      now,
+			})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET user_id = '', updated_at = now(), bound_at = now(), bind_status = 'unbinding' WHERE device_id = ?`, tableNameDeviceInfo),
+			deviceId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		unbound = append(unbound, deviceId)
+	}
+
+	batch.Total = int64(len(unbound))
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET total = ? WHERE id = ?`, tableNameDeviceUnbindBatch), batch.Total, batch.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return batch, unbound, tx.Commit()
+}
+
+func GetDeviceUnbindBatch(ctx context.Context, username string, id int64) (*model.DeviceUnbindBatch, error) {
+	var out model.DeviceUnbindBatch
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND username = ?`, tableNameDeviceUnbindBatch), id, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func ListDeviceUnbindBatches(ctx context.Context, username string, option QueryOption) (int64, []*model.DeviceUnbindBatch, error) {
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s WHERE username = ?`, tableNameDeviceUnbindBatch), username)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var out []*model.DeviceUnbindBatch
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE username = ? ORDER BY id DESC LIMIT ? OFFSET ?`, tableNameDeviceUnbindBatch), username, limit, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func GetDeviceUnbindItems(ctx context.Context, batchID int64) ([]*model.DeviceUnbindItem, error) {
+	var out []*model.DeviceUnbindItem
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE batch_id = ? ORDER BY id`, tableNameDeviceUnbindItem), batchID)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UndoUnbindDevices binds the devices of the batch back to the user with the state before, the devices bound again
+// since the batch are left as they are. It returns the devices restored.
+func UndoUnbindDevices(ctx context.Context, username string, batchID int64) ([]string, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var batch model.DeviceUnbindBatch
+	err = tx.GetContext(ctx, &batch, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND username = ? FOR UPDATE`, tableNameDeviceUnbindBatch), batchID, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if batch.Undone {
+		return nil, ErrDeviceBatchUndone
+	}
+
+	var items []*model.DeviceUnbindItem
+	err = tx.SelectContext(ctx, &items, fmt.Sprintf(`SELECT * FROM %s WHERE batch_id = ?`, tableNameDeviceUnbindItem), batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []string
+	for _, item := range items {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET user_id = ?, bind_status = ?, bound_at = ?, updated_at = now() WHERE device_id = ? AND user_id = '' AND bind_status = 'unbinding'`,
+			tableNameDeviceInfo), item.PrevUserID, item.PrevBindStatus, item.PrevBoundAt, item.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rows == 0 {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET restored = 1 WHERE id = ?`, tableNameDeviceUnbindItem), item.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		restored = append(restored, item.DeviceID)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET undone = 1, undone_at = ? WHERE id = ?`, tableNameDeviceUnbindBatch), time.Now(), batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, tx.Commit()
+}
@@ -0,0 +1,205 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const (
+	tableNameDeviceEvents    = "device_events"
+	tableNameDeviceAlertRule = "device_alert_rule"
+)
+
+// GetDeviceInfoByIDs returns the device info of the devices, keyed by the device id.
+func GetDeviceInfoByIDs(ctx context.Context, deviceIds []string) (map[string]*model.DeviceInfo, error) {
+	out := make(map[string]*model.DeviceInfo)
+	if len(deviceIds) == 0 {
+		return out, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT * FROM %s WHERE device_id IN (?)`, tableNameDeviceInfo), deviceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*model.DeviceInfo
+	if err = DB.SelectContext(ctx, &devices, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		out[device.DeviceID] = device
+	}
+
+	return out, nil
+}
+
+func AddDeviceEvents(ctx context.Context, events []*model.DeviceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (device_id, user_id, event, old_value, new_value, created_at)
+			VALUES (:device_id, :user_id, :event, :old_value, :new_value, :created_at);`, tableNameDeviceEvents),
+		events)
+	return err
+}
+
+// GetDeviceEvents returns the events of the devices of the user, filtered by the device and the event if they are not empty.
+func GetDeviceEvents(ctx context.Context, userID, deviceID, event string, option QueryOption) (int64, []*model.DeviceEvent, error) {
+	var out []*model.DeviceEvent
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	where := "WHERE user_id = ?"
+	args := []interface{}{userID}
+	if deviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	if event != "" {
+		where += " AND event = ?"
+		args = append(args, event)
+	}
+
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s %s`, tableNameDeviceEvents, where), args...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM %s %s ORDER BY id DESC LIMIT ? OFFSET ?`, tableNameDeviceEvents, where)
+	err = DB.SelectContext(ctx, &out, query, append(args, limit, offset)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func ListDeviceAlertRules(ctx context.Context, userID, deviceID string) ([]*model.DeviceAlertRule, error) {
+	where := "WHERE user_id = ?"
+	args := []interface{}{userID}
+	if deviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+
+	var out []*model.DeviceAlertRule
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s %s ORDER BY id`, tableNameDeviceAlertRule, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListEnabledDeviceAlertRules returns the enabled rules of the devices, only the rules of the users the devices are
+// bound to, the rules of the previous owners are kept but no longer fire.
+func ListEnabledDeviceAlertRules(ctx context.Context, deviceIds []string) ([]*model.DeviceAlertRule, error) {
+	if len(deviceIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT r.* FROM %s r JOIN %s d ON d.device_id = r.device_id AND d.user_id = r.user_id
+		WHERE r.enabled = 1 AND r.device_id IN (?)`, tableNameDeviceAlertRule, tableNameDeviceInfo), deviceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*model.DeviceAlertRule
+	if err = DB.SelectContext(ctx, &out, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetDeviceAlertRule(ctx context.Context, userID string, id int64) (*model.DeviceAlertRule, error) {
+	var out model.DeviceAlertRule
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND user_id = ?`, tableNameDeviceAlertRule), id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func AddDeviceAlertRule(ctx context.Context, rule *model.DeviceAlertRule) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, device_id, type, threshold, channel, webhook, enabled, triggered, triggered_at, created_at, updated_at)
+			VALUES (:user_id, :device_id, :type, :threshold, :channel, :webhook, :enabled, :triggered, :triggered_at, :created_at, :updated_at);`, tableNameDeviceAlertRule),
+		rule)
+	if err != nil {
+		return err
+	}
+
+	rule.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateDeviceAlertRule updates the rule of the user, the rule is armed again so the changed condition is checked from scratch.
+func UpdateDeviceAlertRule(ctx context.Context, rule *model.DeviceAlertRule) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET type = :type, threshold = :threshold, channel = :channel, webhook = :webhook, enabled = :enabled, triggered = 0,
+			updated_at = :updated_at WHERE id = :id AND user_id = :user_id`, tableNameDeviceAlertRule),
+		rule)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	return nil
+}
+
+func DeleteDeviceAlertRule(ctx context.Context, userID string, id int64) error {
+	result, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND user_id = ?`, tableNameDeviceAlertRule), id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	return nil
+}
+
+// SetDeviceAlertRuleTriggered marks the rule as fired, a triggered rule is not delivered again until its condition clears.
+func SetDeviceAlertRuleTriggered(ctx context.Context, id int64, triggered bool, at time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET triggered = ?, updated_at = ? WHERE id = ?`, tableNameDeviceAlertRule)
+	args := []interface{}{triggered, time.Now(), id}
+	if triggered {
+		query = fmt.Sprintf(`UPDATE %s SET triggered = ?, triggered_at = ?, updated_at = ? WHERE id = ?`, tableNameDeviceAlertRule)
+		args = []interface{}{triggered, at, time.Now(), id}
+	}
+
+	_, err := DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,274 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const (
+	tableNameDeviceGroup       = "device_group"
+	tableNameDeviceGroupMember = "device_group_member"
+	tableNameDeviceTag         = "device_tag"
+)
+
+// deviceFilterClause returns the conditions narrowing the devices to the group and the tag of the option, the column
+// is the device id column of the query. The group and the tags are those of option.FilterUserID, nothing is filtered
+// without it.
+func deviceFilterClause(column string, option QueryOption) (string, []interface{}) {
+	var where string
+	var args []interface{}
+
+	if option.FilterUserID == "" {
+		return where, args
+	}
+
+	if option.GroupID > 0 {
+		where += fmt.Sprintf(` AND %s IN (SELECT m.device_id FROM %s m JOIN %s g ON g.id = m.group_id WHERE m.group_id = ? AND g.user_id = ?)`,
+			column, tableNameDeviceGroupMember, tableNameDeviceGroup)
+		args = append(args, option.GroupID, option.FilterUserID)
+	}
+
+	if option.Tag != "" {
+		where += fmt.Sprintf(` AND %s IN (SELECT device_id FROM %s WHERE user_id = ? AND tag = ?)`, column, tableNameDeviceTag)
+		args = append(args, option.FilterUserID, option.Tag)
+	}
+
+	return where, args
+}
+
+// DeviceGroupStat is a group of the user with the aggregates of its devices bound to the user.
+type DeviceGroupStat struct {
+	ID               int64     `db:"id" json:"id"`
+	Name             string    `db:"name" json:"name"`
+	TotalNum         int64     `db:"total_num" json:"total_num"`
+	OnlineNum        int64     `db:"online_num" json:"online_num"`
+	OfflineNum       int64     `db:"offline_num" json:"offline_num"`
+	AbnormalNum      int64     `db:"abnormal_num" json:"abnormal_num"`
+	TodayProfit      float64   `db:"today_profit" json:"today_profit"`
+	YesterdayProfit  float64   `db:"yesterday_profit" json:"yesterday_profit"`
+	SevenDaysProfit  float64   `db:"seven_days_profit" json:"seven_days_profit"`
+	MonthProfit      float64   `db:"month_profit" json:"month_profit"`
+	CumulativeProfit float64   `db:"cumulative_profit" json:"cumulative_profit"`
+	TotalBandwidth   float64   `db:"total_bandwidth" json:"total_bandwidth"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+func ListDeviceGroupStats(ctx context.Context, userID string) ([]*DeviceGroupStat, error) {
+	query := fmt.Sprintf(`SELECT g.id, g.name, g.created_at, count(d.device_id) as total_num,
+		count(IF(d.device_status = 'online', 1, NULL)) as online_num, count(IF(d.device_status = 'offline', 1, NULL)) as offline_num,
+		count(IF(d.device_status = 'abnormal', 1, NULL)) as abnormal_num, COALESCE(sum(d.today_profit),0) as today_profit,
+		COALESCE(sum(d.yesterday_profit),0) as yesterday_profit, COALESCE(sum(d.seven_days_profit),0) as seven_days_profit,
+		COALESCE(sum(d.month_profit),0) as month_profit, COALESCE(sum(d.cumulative_profit),0) as cumulative_profit,
+		COALESCE(sum(d.bandwidth_up),0) as total_bandwidth
+		FROM %s g LEFT JOIN %s m ON m.group_id = g.id
+		LEFT JOIN %s d ON d.device_id = m.device_id AND d.user_id = g.user_id AND d.active_status = 1
+		WHERE g.user_id = ? GROUP BY g.id, g.name, g.created_at ORDER BY g.id`,
+		tableNameDeviceGroup, tableNameDeviceGroupMember, tableNameDeviceInfo)
+
+	var out []*DeviceGroupStat
+	if err := DB.SelectContext(ctx, &out, query, userID); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetDeviceGroup(ctx context.Context, userID string, id int64) (*model.DeviceGroup, error) {
+	var out model.DeviceGroup
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND user_id = ?`, tableNameDeviceGroup), id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func GetDeviceGroupByName(ctx context.Context, userID, name string) (*model.DeviceGroup, error) {
+	var out model.DeviceGroup
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE user_id = ? AND name = ?`, tableNameDeviceGroup), userID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func AddDeviceGroup(ctx context.Context, group *model.DeviceGroup) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, name, created_at, updated_at) VALUES (:user_id, :name, :created_at, :updated_at);`, tableNameDeviceGroup),
+		group)
+	if err != nil {
+		return err
+	}
+
+	group.ID, err = result.LastInsertId()
+	return err
+}
+
+func UpdateDeviceGroup(ctx context.Context, group *model.DeviceGroup) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET name = :name, updated_at = :updated_at WHERE id = :id AND user_id = :user_id`, tableNameDeviceGroup),
+		group)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	return nil
+}
+
+// DeleteDeviceGroup deletes the group of the user, the devices of the group are left without a group.
+func DeleteDeviceGroup(ctx context.Context, userID string, id int64) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND user_id = ?`, tableNameDeviceGroup), id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE group_id = ?`, tableNameDeviceGroupMember), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetDeviceGroup moves the devices of the user to the group, a device is in one group at most and the zero group
+// takes the devices out of their group.
+func SetDeviceGroup(ctx context.Context, userID string, groupID int64, deviceIds []string) error {
+	if len(deviceIds) == 0 {
+		return nil
+	}
+
+	if groupID == 0 {
+		query, args, err := sqlx.In(fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND device_id IN (?)`, tableNameDeviceGroupMember), userID, deviceIds)
+		if err != nil {
+			return err
+		}
+		_, err = DB.ExecContext(ctx, DB.Rebind(query), args...)
+		return err
+	}
+
+	var members []*model.DeviceGroupMember
+	for _, deviceId := range deviceIds {
+		members = append(members, &model.DeviceGroupMember{
+			UserID:    userID,
+			GroupID:   groupID,
+			DeviceID:  deviceId,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, group_id, device_id, created_at) VALUES (:user_id, :group_id, :device_id, :created_at)
+			ON DUPLICATE KEY UPDATE group_id = VALUES(group_id), created_at = VALUES(created_at)`, tableNameDeviceGroupMember),
+		members)
+	return err
+}
+
+// CountUserDevices returns how many of the devices are bound to the user.
+func CountUserDevices(ctx context.Context, userID string, deviceIds []string) (int64, error) {
+	if len(deviceIds) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT count(*) FROM %s WHERE user_id = ? AND device_id IN (?)`, tableNameDeviceInfo), userID, deviceIds)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = DB.GetContext(ctx, &count, DB.Rebind(query), args...)
+	return count, err
+}
+
+func AddDeviceTags(ctx context.Context, userID string, deviceIds, tags []string) error {
+	var records []*model.DeviceTag
+	for _, deviceId := range deviceIds {
+		for _, tag := range tags {
+			records = append(records, &model.DeviceTag{
+				UserID:    userID,
+				DeviceID:  deviceId,
+				Tag:       tag,
+				CreatedAt: time.Now(),
+			})
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT IGNORE INTO %s (user_id, device_id, tag, created_at) VALUES (:user_id, :device_id, :tag, :created_at)`, tableNameDeviceTag),
+		records)
+	return err
+}
+
+func RemoveDeviceTags(ctx context.Context, userID string, deviceIds, tags []string) error {
+	if len(deviceIds) == 0 || len(tags) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`DELETE FROM %s WHERE user_id = ? AND device_id IN (?) AND tag IN (?)`, tableNameDeviceTag),
+		userID, deviceIds, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.ExecContext(ctx, DB.Rebind(query), args...)
+	return err
+}
+
+type DeviceTagCount struct {
+	Tag         string `db:"tag" json:"tag"`
+	DeviceCount int64  `db:"device_count" json:"device_count"`
+}
+
+// ListDeviceTags returns the tags of the user with the number of devices tagged, only the tags of the device if it's not empty.
+func ListDeviceTags(ctx context.Context, userID, deviceID string) ([]*DeviceTagCount, error) {
+	where := `WHERE user_id = ?`
+	args := []interface{}{userID}
+	if deviceID != "" {
+		where += ` AND device_id = ?`
+		args = append(args, deviceID)
+	}
+
+	var out []*DeviceTagCount
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT tag, count(*) as device_count FROM %s %s GROUP BY tag ORDER BY tag`, tableNameDeviceTag, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package dao
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const groupFilter = ` AND device_id IN (SELECT m.device_id FROM device_group_member m JOIN device_group g ON g.id = m.group_id WHERE m.group_id = ? AND g.user_id = ?)`
+
+func TestDeviceFilterClause(t *testing.T) {
+	tagFilter := ` AND device_id IN (SELECT device_id FROM device_tag WHERE user_id = ? AND tag = ?)`
+
+	cases := []struct {
+		name   string
+		option QueryOption
+		where  string
+		args   []interface{}
+	}{
+		{"no filter", QueryOption{FilterUserID: "alice"}, "", nil},
+		{"without user", QueryOption{GroupID: 7, Tag: "home"}, "", nil},
+		{"group", QueryOption{FilterUserID: "alice", GroupID: 7}, groupFilter, []interface{}{int64(7), "alice"}},
+		{"tag", QueryOption{FilterUserID: "alice", Tag: "home"}, tagFilter, []interface{}{"alice", "home"}},
+		{"group and tag", QueryOption{FilterUserID: "alice", GroupID: 7, Tag: "home"}, groupFilter + tagFilter,
+			[]interface{}{int64(7), "alice", "alice", "home"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			where, args := deviceFilterClause("device_id", c.option)
+			if where != c.where || !reflect.DeepEqual(args, c.args) {
+				t.Errorf("deviceFilterClause() = %q %v, want %q %v", where, args, c.where, c.args)
+			}
+		})
+	}
+}
+
+func TestGetDeviceInfoListOtherUserGroup(t *testing.T) {
+	cases := []struct {
+		name    string
+		user    string
+		devices []string
+	}{
+		// the database keeps group 7 of alice with the device d1, the group of another user matches nothing
+		{"owner", "alice", []string{"d1"}},
+		{"another user", "bob", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := useMockDB(t)
+
+			rows := sqlmock.NewRows([]string{"device_id"})
+			for _, device := range c.devices {
+				rows.AddRow(device)
+			}
+
+			where := `WHERE device_id <> '' AND active_status = ?` + groupFilter
+			args := []driver.Value{int64(1), int64(7), c.user}
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM device_info ` + where)).
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(len(c.devices)))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM device_info ` + where)).
+				WithArgs(args...).
+				WillReturnRows(rows)
+
+			list, total, err := GetDeviceInfoList(context.Background(), &model.DeviceInfo{ActiveStatus: 1},
+				QueryOption{FilterUserID: c.user, GroupID: 7})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var devices []string
+			for _, device := range list {
+				devices = append(devices, device.DeviceID)
+			}
+			if total != int64(len(c.devices)) || !reflect.DeepEqual(devices, c.devices) {
+				t.Errorf("GetDeviceInfoList() = %v %d, want %v", devices, total, c.devices)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"time"
+)
+
+const (
+	tableNameDeviceReliability = "device_reliability_daily"
+
+	reliabilityBatchSize = 1000
+)
+
+// DeviceUptime is the online time of a device sampled over a window, the online time and the span are in minutes.
+type DeviceUptime struct {
+	DeviceID     string  `db:"device_id"`
+	UserID       string  `db:"user_id"`
+	OnlineTime   float64 `db:"online_time"`
+	Span         float64 `db:"span"`
+	PkgLossRatio float64 `db:"pkg_loss_ratio"`
+	Latency      float64 `db:"latency"`
+}
+
+// SumDeviceUptime returns the online time of the devices sampled in device_info_hour since the time, keyed by the
+// device id. The span runs from the first sample of the device, or since if it's later, until now, so the time a device
+// stopped being sampled because it's offline counts as down.
+func SumDeviceUptime(ctx context.Context, since, now time.Time) (map[string]*DeviceUptime, error) {
+	query := fmt.Sprintf(`SELECT device_id, max(user_id) as user_id, max(online_time) - min(online_time) as online_time,
+		TIMESTAMPDIFF(MINUTE, GREATEST(min(time), ?), ?) as span, COALESCE(avg(pkg_loss_ratio),0) as pkg_loss_ratio,
+		COALESCE(avg(latency),0) as latency FROM %s WHERE time >= ? GROUP BY device_id`, tableNameDeviceInfoHour)
+
+	var list []*DeviceUptime
+	if err := DB.SelectContext(ctx, &list, query, since, now, since); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]*DeviceUptime)
+	for _, uptime := range list {
+		out[uptime.DeviceID] = uptime
+	}
+	return out, nil
+}
+
+// GetDeviceStatusEvents returns the status changes of the devices since the time, ordered by device and time.
+func GetDeviceStatusEvents(ctx context.Context, since time.Time) ([]*model.DeviceEvent, error) {
+	var out []*model.DeviceEvent
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE event = ? AND created_at >= ? ORDER BY device_id, created_at, id`, tableNameDeviceEvents),
+		model.DeviceEventStatus, since)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetDeviceStatusAt returns the status of the devices at the time by their last status change before it, keyed by the
+// device id. The devices without a status change before the time are not returned.
+func GetDeviceStatusAt(ctx context.Context, at time.Time) (map[string]string, error) {
+	var list []*model.DeviceEvent
+	err := DB.SelectContext(ctx, &list, fmt.Sprintf(
+		`SELECT e.* FROM %s e JOIN (SELECT max(id) as id FROM %s WHERE event = ? AND created_at < ? GROUP BY device_id) l ON l.id = e.id`,
+		tableNameDeviceEvents, tableNameDeviceEvents), model.DeviceEventStatus, at)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(list))
+	for _, event := range list {
+		out[event.DeviceID] = event.NewValue
+	}
+	return out, nil
+}
+
+func BulkUpsertDeviceReliability(ctx context.Context, records []*model.DeviceReliability) error {
+	statement := fmt.Sprintf(`INSERT INTO %s (user_id, device_id, time, uptime_24h, uptime_7d, uptime_30d, outages, outage_duration,
+			longest_outage, mtbo, pkg_loss_ratio, latency, quality_score, created_at, updated_at)
+		VALUES (:user_id, :device_id, :time, :uptime_24h, :uptime_7d, :uptime_30d, :outages, :outage_duration,
+			:longest_outage, :mtbo, :pkg_loss_ratio, :latency, :quality_score, :created_at, :updated_at)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), uptime_24h = VALUES(uptime_24h), uptime_7d = VALUES(uptime_7d),
+			uptime_30d = VALUES(uptime_30d), outages = VALUES(outages), outage_duration = VALUES(outage_duration),
+			longest_outage = VALUES(longest_outage), mtbo = VALUES(mtbo), pkg_loss_ratio = VALUES(pkg_loss_ratio),
+			latency = VALUES(latency), quality_score = VALUES(quality_score), updated_at = VALUES(updated_at)`, tableNameDeviceReliability)
+
+	for i := 0; i < len(records); i += reliabilityBatchSize {
+		end := i + reliabilityBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		if _, err := DB.NamedExecContext(ctx, statement, records[i:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateDeviceInfoReliability copies the reliability of the day to the device info, so the device lists can be
+// ordered by it.
+func UpdateDeviceInfoReliability(ctx context.Context, day time.Time) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`UPDATE %s d JOIN %s r ON r.device_id = d.device_id AND r.time = ?
+		SET d.uptime_24h = r.uptime_24h, d.uptime_7d = r.uptime_7d, d.uptime_30d = r.uptime_30d, d.quality_score = r.quality_score`,
+		tableNameDeviceInfo, tableNameDeviceReliability), day)
+	return err
+}
+
+func GetDeviceReliabilityList(ctx context.Context, deviceID string, option QueryOption) ([]*model.DeviceReliability, error) {
+	var out []*model.DeviceReliability
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE device_id = ? AND time >= ? AND time <= ? ORDER BY time`, tableNameDeviceReliability),
+		deviceID, option.StartTime, option.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
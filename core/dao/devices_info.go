@@ -54,6 +54,10 @@ func GetDeviceInfoList(ctx context.Context, cond *model.DeviceInfo, option Query
 		args = append(args, cond.NodeType)
 	}
 
+	filter, filterArgs := deviceFilterClause("device_id", option)
+	where += filter
+	args = append(args, filterArgs...)
+
 	if option.Order != "" && option.OrderField != "" {
 		where += fmt.Sprintf(` ORDER BY %s %s`, option.OrderField, option.Order)
 	}
@@ -77,7 +81,7 @@ func GetDeviceInfoList(ctx context.Context, cond *model.DeviceInfo, option Query
 		return nil, 0, err
 	}
 	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
-		`SELECT * FROM %s %s ORDER BY device_rank LIMIT %d OFFSET %d`, tableNameDeviceInfo, where, limit, offset,
+		`SELECT * FROM %s %s ORDER BY device_status DESC, node_type DESC, device_id LIMIT %d OFFSET %d`, tableNameDeviceInfo, where, limit, offset,
 	), args...)
 	if err != nil {
 		return nil, 0, err
@@ -106,6 +110,10 @@ func GetDeviceActiveInfoList(ctx context.Context, cond *model.DeviceInfo, option
 		args = append(args, cond.UserID)
 	}
 
+	filter, filterArgs := deviceFilterClause("a.device_id", option)
+	where += filter
+	args = append(args, filterArgs...)
+
 	if option.Order != "" && option.OrderField != "" {
 		where += fmt.Sprintf(` ORDER BY %s %s`, option.OrderField, option.Order)
 	}
@@ -129,7 +137,7 @@ func GetDeviceActiveInfoList(ctx context.Context, cond *model.DeviceInfo, option
 	}
 	var out []*ActiveInfoOut
 	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
-		`SELECT a.device_id,IFNULL(0,b.active_status) active_status,a.secret FROM %s a LEFT JOIN %s b on a.device_id = b.device_id %s ORDER BY device_rank LIMIT %d OFFSET %d`, tableNameApplicationResult, tableNameDeviceInfo, where, limit, offset,
+		`SELECT a.device_id,IFNULL(0,b.active_status) active_status,a.secret FROM %s a LEFT JOIN %s b on a.device_id = b.device_id %s ORDER BY b.device_status DESC, b.node_type DESC, a.device_id LIMIT %d OFFSET %d`, tableNameApplicationResult, tableNameDeviceInfo, where, limit, offset,
 	), args...)
 
 	if err != nil {
@@ -165,6 +173,10 @@ func GetDeviceInfoListByKey(ctx context.Context, cond *model.DeviceInfo, option
 		args = append(args, cond.NodeType)
 	}
 
+	filter, filterArgs := deviceFilterClause("device_id", option)
+	where += filter
+	args = append(args, filterArgs...)
+
 	if option.Order != "" && option.OrderField != "" {
 		where += fmt.Sprintf(` ORDER BY %s %s`, option.OrderField, option.Order)
 	}
@@ -188,7 +200,7 @@ func GetDeviceInfoListByKey(ctx context.Context, cond *model.DeviceInfo, option
 		return nil, 0, err
 	}
 	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
-		`SELECT * FROM %s %s ORDER BY device_rank LIMIT %d OFFSET %d`, tableNameDeviceInfo, where, limit, offset,
+		`SELECT * FROM %s %s ORDER BY device_status DESC, node_type DESC, device_id LIMIT %d OFFSET %d`, tableNameDeviceInfo, where, limit, offset,
 	), args...)
 	if err != nil {
 		return nil, 0, err
@@ -357,8 +369,15 @@ func BulkAddDeviceInfo(ctx context.Context, deviceInfos []*model.DeviceInfo) err
 }
 
 func BulkUpsertDeviceInfo(ctx context.Context, deviceInfos []*model.DeviceInfo) error {
+	start := time.Now()
 	statement := upsertDeviceInfoStatement()
 	_, err := DB.NamedExecContext(ctx, statement, deviceInfos)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	bulkUpsertLatency.WithLabelValues(tableNameDeviceInfo, status).Observe(time.Since(start).Seconds())
 	return err
 }
 
@@ -440,32 +459,23 @@ type UserDeviceProfile struct {
 	TotalBandwidth   float64 `json:"total_bandwidth" db:"total_bandwidth"`
 }
 
-func CountUserDeviceInfo(ctx context.Context, userID string) (*UserDeviceProfile, error) {
+// CountUserDeviceInfo returns the aggregates of the devices of the user, narrowed to the group and the tag of the option.
+func CountUserDeviceInfo(ctx context.Context, userID string, option QueryOption) (*UserDeviceProfile, error) {
+	filter, filterArgs := deviceFilterClause("device_id", option)
+
 	queryStatement := fmt.Sprintf(`SELECT COALESCE(sum(cumulative_profit),0) as cumulative_profit, COALESCE(sum(yesterday_profit),0) as yesterday_profit, 
 COALESCE(sum(today_profit),0) as today_profit,node_type, COALESCE(sum(seven_days_profit),0) as seven_days_profit, COALESCE(sum(month_profit),0) as month_profit, count(*) as total_num, 
 count(IF(device_status = 'online', 1, NULL)) as online_num ,count(IF(device_status = 'offline', 1, NULL)) as offline_num, 
-count(IF(device_status = 'abnormal', 1, NULL)) as abnormal_num, COALESCE(sum(bandwidth_up),0) as total_bandwidth from %s where user_id = ? and active_status = 1;`, tableNameDeviceInfo)
+count(IF(device_status = 'abnormal', 1, NULL)) as abnormal_num, COALESCE(sum(bandwidth_up),0) as total_bandwidth from %s where user_id = ? and active_status = 1%s;`, tableNameDeviceInfo, filter)
 
 	var out UserDeviceProfile
-	if err := DB.QueryRowxContext(ctx, queryStatement, userID).StructScan(&out); err != nil {
+	if err := DB.QueryRowxContext(ctx, queryStatement, append([]interface{}{userID}, filterArgs...)...).StructScan(&out); err != nil {
 		return nil, err
 	}
 
 	return &out, nil
 }
 
-func RankDeviceInfo(ctx context.Context) error {
-	tx := DB.MustBegin()
-	defer tx.Rollback()
-	tx.MustExec("SET @r=0;")
-	queryStatement := fmt.Sprintf(`UPDATE %s SET device_rank= @r:= (@r+1) ORDER BY device_status DESC, node_type DESC;`, tableNameDeviceInfo)
-	_, err := tx.ExecContext(ctx, queryStatement)
-	if err != nil {
-		return err
-	}
-	return tx.Commit()
-}
-
 func GenerateInactiveNodeRecords(ctx context.Context, t time.Time) error {
 	var inactiveNodeIds []model.DeviceInfo
 	query := fmt.Sprintf("SELECT * FROM %s where active_status = 1 and updated_at < ?", tableNameDeviceInfo)
@@ -555,7 +565,7 @@ func GetNodesInfo(ctx context.Context, option QueryOption) (int64, []model.Nodes
 		return 0, nil, err
 	}
 	var nodeInfo []model.NodesInfo
-	query := fmt.Sprintf("SELECT node_type,user_id,COUNT(device_id) AS node_count,ROUND(sum(disk_space) ,2) as disk_space,ROUND(SUM(bandwidth_up),2) as bandwidth_up FROM %s %s GROUP BY user_id ORDER BY node_count DESC LIMIT %d OFFSET %d",
+	query := fmt.Sprintf("SELECT node_type,user_id,COUNT(device_id) AS node_count,ROUND(sum(disk_space) ,2) as disk_space,ROUND(SUM(bandwidth_up),2) as bandwidth_up,ROUND(AVG(quality_score),2) as quality_score FROM %s %s GROUP BY user_id ORDER BY node_count DESC LIMIT %d OFFSET %d",
 		tableNameDeviceInfo, where, limit, offset)
 	err = DB.SelectContext(ctx, &nodeInfo, query)
 	if err != nil {
@@ -579,6 +589,7 @@ func GetIdIfExist(ctx context.Context, nodeId string) bool {
 	return true
 }
 
+// SumUserDeviceReward returns the profits of the devices of the users today.
 func SumUserDeviceReward(ctx context.Context) (map[string]int64, error) {
 	query := fmt.Sprintf(`select user_id, sum(today_profit) as income from %s where  user_id <> '' and today_profit > 0 GROUP BY user_id;`, tableNameDeviceInfo)
 
@@ -604,6 +615,56 @@ func SumUserDeviceReward(ctx context.Context) (map[string]int64, error) {
 	return out, nil
 }
 
+// SumUserDeviceDailyReward returns the profits of the devices of the users on the day from device_info_daily,
+// the rows of a day are no longer summed once the day is over.
+func SumUserDeviceDailyReward(ctx context.Context, day time.Time) (map[string]int64, error) {
+	query := fmt.Sprintf(`select user_id, sum(income) as income from %s where user_id <> '' and time = ? and income > 0 GROUP BY user_id;`, tableNameDeviceInfoDaily)
+
+	out := make(map[string]int64)
+	rows, err := DB.QueryxContext(ctx, query, day.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var reward float64
+
+		err := rows.Scan(&userID, &reward)
+		if err != nil {
+			return nil, err
+		}
+
+		out[userID] = int64(reward)
+	}
+
+	return out, rows.Err()
+}
+
+// SumUserDeviceCumulativeProfit returns the cumulative profits of the devices of the users.
+func SumUserDeviceCumulativeProfit(ctx context.Context) (map[string]float64, error) {
+	query := fmt.Sprintf(`select user_id, sum(cumulative_profit) from %s where user_id <> '' GROUP BY user_id;`, tableNameDeviceInfo)
+
+	rows, err := DB.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]float64)
+	for rows.Next() {
+		var userID string
+		var profit float64
+		if err := rows.Scan(&userID, &profit); err != nil {
+			return nil, err
+		}
+		out[userID] = profit
+	}
+
+	return out, rows.Err()
+}
+
 func DeleteDeviceInfoHourHistory(ctx context.Context, before time.Time) error {
 	statement := fmt.Sprintf(`DELETE FROM %s where created_at < ?`, tableNameDeviceInfoHour)
 	_, err := DB.ExecContext(ctx, statement, before)
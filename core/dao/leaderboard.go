@@ -0,0 +1,338 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"strconv"
+	"strings"
+)
+
+const (
+	LeaderboardCumulativeProfit = "cumulative_profit"
+	LeaderboardSevenDaysProfit  = "seven_days_profit"
+	LeaderboardUptime           = "uptime"
+	LeaderboardBandwidth        = "bandwidth"
+	LeaderboardRetrievalCount   = "retrieval_count"
+
+	LeaderboardScopeGlobal = "global"
+
+	leaderboardKeyPrefix = "TITAN::LEADERBOARD"
+	// leaderboardScopesKey keeps the scopes each device is ranked in, so the device can be taken out of the scopes it
+	// has left when its country or its node type changes.
+	leaderboardScopesKey = "TITAN::LEADERBOARD::SCOPES"
+
+	leaderboardPruneBatchSize = 500
+)
+
+// leaderboardScores are the scores of the devices on each leaderboard.
+var leaderboardScores = map[string]func(device *model.DeviceInfo) float64{
+	LeaderboardCumulativeProfit: func(device *model.DeviceInfo) float64 { return device.CumulativeProfit },
+	LeaderboardSevenDaysProfit:  func(device *model.DeviceInfo) float64 { return device.SevenDaysProfit },
+	LeaderboardUptime:           func(device *model.DeviceInfo) float64 { return device.Uptime30d },
+	LeaderboardBandwidth:        func(device *model.DeviceInfo) float64 { return device.BandwidthUp },
+	LeaderboardRetrievalCount:   func(device *model.DeviceInfo) float64 { return float64(device.RetrievalCount) },
+}
+
+func IsLeaderboard(board string) bool {
+	_, ok := leaderboardScores[board]
+	return ok
+}
+
+// LeaderboardCountryScope returns the scope of the devices in the country.
+func LeaderboardCountryScope(country string) string {
+	return "country:" + country
+}
+
+// LeaderboardNodeTypeScope returns the scope of the devices of the node type.
+func LeaderboardNodeTypeScope(nodeType int64) string {
+	return "node_type:" + strconv.FormatInt(nodeType, 10)
+}
+
+// LeaderboardCountryNodeTypeScope returns the scope of the devices of the node type in the country.
+func LeaderboardCountryNodeTypeScope(country string, nodeType int64) string {
+	return LeaderboardCountryScope(country) + ":" + LeaderboardNodeTypeScope(nodeType)
+}
+
+func leaderboardKey(board, scope string) string {
+	return fmt.Sprintf("%s::%s::%s", leaderboardKeyPrefix, board, scope)
+}
+
+// deviceLeaderboardScopes returns the scopes the device is ranked in, the inactive and the unbound devices are not
+// ranked.
+func deviceLeaderboardScopes(device *model.DeviceInfo) []string {
+	if device.ActiveStatus != 1 || device.UserID == "" {
+		return nil
+	}
+
+	scopes := []string{LeaderboardScopeGlobal, LeaderboardNodeTypeScope(device.NodeType)}
+	if device.IpCountry != "" {
+		scopes = append(scopes, LeaderboardCountryScope(device.IpCountry), LeaderboardCountryNodeTypeScope(device.IpCountry, device.NodeType))
+	}
+	return scopes
+}
+
+// UpdateDeviceLeaderboards sets the scores of the devices on all the leaderboards of their scopes, it's called with
+// the devices changed so the leaderboards are kept up to date without ranking all the devices.
+func UpdateDeviceLeaderboards(ctx context.Context, devices []*model.DeviceInfo) error {
+	if len(devices) == 0 {
+		return nil
+	}
+
+	var deviceIds []string
+	for _, device := range devices {
+		deviceIds = append(deviceIds, device.DeviceID)
+	}
+
+	previous, err := RedisCache.HMGet(ctx, leaderboardScopesKey, deviceIds...).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := RedisCache.Pipeline()
+	for i, device := range devices {
+		scopes := deviceLeaderboardScopes(device)
+
+		current := make(map[string]struct{})
+		for _, scope := range scopes {
+			current[scope] = struct{}{}
+		}
+
+		if prev, ok := previous[i].(string); ok && prev != "" {
+			for _, scope := range strings.Split(prev, "|") {
+				if _, ok := current[scope]; ok {
+					continue
+				}
+				for board := range leaderboardScores {
+					pipe.ZRem(ctx, leaderboardKey(board, scope), device.DeviceID)
+				}
+			}
+		}
+
+		for _, scope := range scopes {
+			for board, score := range leaderboardScores {
+				pipe.ZAdd(ctx, leaderboardKey(board, scope), redis.Z{Score: score(device), Member: device.DeviceID})
+			}
+		}
+
+		if len(scopes) == 0 {
+			pipe.HDel(ctx, leaderboardScopesKey, device.DeviceID)
+			continue
+		}
+		pipe.HSet(ctx, leaderboardScopesKey, device.DeviceID, strings.Join(scopes, "|"))
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RemoveDeviceLeaderboards takes the devices out of all the leaderboards they are ranked in, it's called when the
+// devices are deactivated or unbound.
+func RemoveDeviceLeaderboards(ctx context.Context, deviceIds []string) error {
+	if len(deviceIds) == 0 {
+		return nil
+	}
+
+	previous, err := RedisCache.HMGet(ctx, leaderboardScopesKey, deviceIds...).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := RedisCache.Pipeline()
+	for i, deviceId := range deviceIds {
+		prev, ok := previous[i].(string)
+		if !ok || prev == "" {
+			continue
+		}
+
+		for _, scope := range strings.Split(prev, "|") {
+			for board := range leaderboardScores {
+				pipe.ZRem(ctx, leaderboardKey(board, scope), deviceId)
+			}
+		}
+	}
+	pipe.HDel(ctx, leaderboardScopesKey, deviceIds...)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// PruneDeviceLeaderboards takes the devices no longer active, no longer bound or no longer existing out of the
+// leaderboards, the devices deactivated without RemoveDeviceLeaderboards would stay ranked otherwise. It returns the
+// number of the devices removed.
+func PruneDeviceLeaderboards(ctx context.Context) (int64, error) {
+	var removed int64
+	var cursor uint64
+	for {
+		fields, next, err := RedisCache.HScan(ctx, leaderboardScopesKey, cursor, "", leaderboardPruneBatchSize).Result()
+		if err != nil {
+			return removed, err
+		}
+
+		// the fields are device ids followed by their scopes
+		var deviceIds []string
+		for i := 0; i < len(fields); i += 2 {
+			deviceIds = append(deviceIds, fields[i])
+		}
+
+		devices, err := GetDeviceInfoByIDs(ctx, deviceIds)
+		if err != nil {
+			return removed, err
+		}
+
+		var stale []string
+		for _, deviceId := range deviceIds {
+			device, ok := devices[deviceId]
+			if !ok || len(deviceLeaderboardScopes(device)) == 0 {
+				stale = append(stale, deviceId)
+			}
+		}
+
+		if err = RemoveDeviceLeaderboards(ctx, stale); err != nil {
+			return removed, err
+		}
+		removed += int64(len(stale))
+
+		cursor = next
+		if cursor == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// LeaderboardEntry is a device on a leaderboard, the rank starts from 1.
+type LeaderboardEntry struct {
+	Rank         int64   `json:"rank"`
+	DeviceID     string  `json:"device_id"`
+	Score        float64 `json:"score"`
+	UserID       string  `json:"user_id"`
+	DeviceName   string  `json:"device_name"`
+	NodeType     int64   `json:"node_type"`
+	IpCountry    string  `json:"ip_country"`
+	DeviceStatus string  `json:"device_status"`
+}
+
+// GetLeaderboard returns the page of the leaderboard of the scope from the highest score and the number of devices
+// ranked in the scope.
+func GetLeaderboard(ctx context.Context, board, scope string, option QueryOption) (int64, []*LeaderboardEntry, error) {
+	limit := int64(option.PageSize)
+	offset := int64(option.Page)
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * int64(option.Page-1)
+	}
+
+	key := leaderboardKey(board, scope)
+	total, err := RedisCache.ZCard(ctx, key).Result()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	members, err := RedisCache.ZRevRangeWithScores(ctx, key, offset, offset+limit-1).Result()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var out []*LeaderboardEntry
+	var deviceIds []string
+	for i, member := range members {
+		deviceId, _ := member.Member.(string)
+		deviceIds = append(deviceIds, deviceId)
+		out = append(out, &LeaderboardEntry{
+			Rank:     offset + int64(i) + 1,
+			DeviceID: deviceId,
+			Score:    member.Score,
+		})
+	}
+
+	if err = fillLeaderboardEntries(ctx, deviceIds, out); err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+// GetLeaderboardPositions returns the positions of the devices on the leaderboard of the scope, the devices not
+// ranked in the scope are left out.
+func GetLeaderboardPositions(ctx context.Context, board, scope string, deviceIds []string) ([]*LeaderboardEntry, error) {
+	if len(deviceIds) == 0 {
+		return nil, nil
+	}
+
+	key := leaderboardKey(board, scope)
+	pipe := RedisCache.Pipeline()
+	ranks := make([]*redis.IntCmd, len(deviceIds))
+	scores := make([]*redis.FloatCmd, len(deviceIds))
+	for i, deviceId := range deviceIds {
+		ranks[i] = pipe.ZRevRank(ctx, key, deviceId)
+		scores[i] = pipe.ZScore(ctx, key, deviceId)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var out []*LeaderboardEntry
+	var ranked []string
+	for i, deviceId := range deviceIds {
+		rank, err := ranks[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, &LeaderboardEntry{
+			Rank:     rank + 1,
+			DeviceID: deviceId,
+			Score:    scores[i].Val(),
+		})
+		ranked = append(ranked, deviceId)
+	}
+
+	if err := fillLeaderboardEntries(ctx, ranked, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func fillLeaderboardEntries(ctx context.Context, deviceIds []string, entries []*LeaderboardEntry) error {
+	if len(deviceIds) == 0 {
+		return nil
+	}
+
+	devices, err := GetDeviceInfoByIDs(ctx, deviceIds)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		device, ok := devices[entry.DeviceID]
+		if !ok {
+			continue
+		}
+		entry.UserID = device.UserID
+		entry.DeviceName = device.DeviceName
+		entry.NodeType = device.NodeType
+		entry.IpCountry = device.IpCountry
+		entry.DeviceStatus = device.DeviceStatus
+	}
+
+	return nil
+}
+
+// GetUserDeviceIDs returns the active devices bound to the user.
+func GetUserDeviceIDs(ctx context.Context, userID string) ([]string, error) {
+	var out []string
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT device_id FROM %s WHERE user_id = ? AND active_status = 1`, tableNameDeviceInfo), userID)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,189 @@
+package dao
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/go-redis/redis/v9"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// useMiniRedis points the redis client to an in-memory redis for the test.
+func useMiniRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	prev := RedisCache
+	RedisCache = client
+	t.Cleanup(func() {
+		RedisCache = prev
+		client.Close()
+	})
+	return mr
+}
+
+// rankedScopes returns the scopes the device is ranked in on every leaderboard, it fails if the boards of a scope
+// disagree.
+func rankedScopes(t *testing.T, mr *miniredis.Miniredis, deviceId string) []string {
+	scopes := make(map[string]int)
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, leaderboardKeyPrefix+"::") || key == leaderboardScopesKey {
+			continue
+		}
+		members, err := mr.ZMembers(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !contains(members, deviceId) {
+			continue
+		}
+		// the key is the prefix, the board and the scope
+		parts := strings.SplitN(key, "::", 4)
+		scopes[parts[3]]++
+	}
+
+	var out []string
+	for scope, boards := range scopes {
+		if boards != len(leaderboardScores) {
+			t.Errorf("device %s ranked on %d boards of %s, want all %d", deviceId, boards, scope, len(leaderboardScores))
+		}
+		out = append(out, scope)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeviceLeaderboardScopes(t *testing.T) {
+	cases := []struct {
+		name   string
+		device model.DeviceInfo
+		want   []string
+	}{
+		{"country and node type", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 1, IpCountry: "CN"},
+			[]string{"global", "node_type:1", "country:CN", "country:CN:node_type:1"}},
+		{"no country", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 2}, []string{"global", "node_type:2"}},
+		{"deactivated", model.DeviceInfo{ActiveStatus: 0, UserID: "alice", NodeType: 1, IpCountry: "CN"}, nil},
+		{"unbound", model.DeviceInfo{ActiveStatus: 1, NodeType: 1, IpCountry: "CN"}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := deviceLeaderboardScopes(&c.device); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("deviceLeaderboardScopes() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestUpdateDeviceLeaderboards(t *testing.T) {
+	mr := useMiniRedis(t)
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		device model.DeviceInfo
+		want   []string
+	}{
+		{"ranked", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 1, IpCountry: "CN"},
+			[]string{"country:CN", "country:CN:node_type:1", "global", "node_type:1"}},
+		{"country changed", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 1, IpCountry: "US"},
+			[]string{"country:US", "country:US:node_type:1", "global", "node_type:1"}},
+		{"node type changed", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 2, IpCountry: "US"},
+			[]string{"country:US", "country:US:node_type:2", "global", "node_type:2"}},
+		{"country lost", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 2},
+			[]string{"global", "node_type:2"}},
+		{"deactivated", model.DeviceInfo{ActiveStatus: 0, UserID: "alice", NodeType: 2}, nil},
+		{"reactivated", model.DeviceInfo{ActiveStatus: 1, UserID: "alice", NodeType: 2, IpCountry: "CN"},
+			[]string{"country:CN", "country:CN:node_type:2", "global", "node_type:2"}},
+		{"unbound", model.DeviceInfo{ActiveStatus: 1, NodeType: 2, IpCountry: "CN"}, nil},
+	}
+
+	for _, step := range steps {
+		device := step.device
+		device.DeviceID = "d1"
+		device.CumulativeProfit = 10
+		if err := UpdateDeviceLeaderboards(ctx, []*model.DeviceInfo{&device}); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if got := rankedScopes(t, mr, "d1"); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: ranked in %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if mr.Exists(leaderboardScopesKey) && mr.HGet(leaderboardScopesKey, "d1") != "" {
+		t.Error("the scopes of the unranked device are still kept")
+	}
+}
+
+func TestRemoveDeviceLeaderboards(t *testing.T) {
+	mr := useMiniRedis(t)
+	ctx := context.Background()
+
+	devices := []*model.DeviceInfo{
+		{DeviceID: "d1", ActiveStatus: 1, UserID: "alice", NodeType: 1, IpCountry: "CN"},
+		{DeviceID: "d2", ActiveStatus: 1, UserID: "bob", NodeType: 1, IpCountry: "CN"},
+	}
+	if err := UpdateDeviceLeaderboards(ctx, devices); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveDeviceLeaderboards(ctx, []string{"d1", "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rankedScopes(t, mr, "d1"); len(got) != 0 {
+		t.Errorf("removed device ranked in %v", got)
+	}
+	if got := rankedScopes(t, mr, "d2"); len(got) != 4 {
+		t.Errorf("other device ranked in %v, want it kept", got)
+	}
+}
+
+func TestPruneDeviceLeaderboards(t *testing.T) {
+	mr := useMiniRedis(t)
+	mock := useMockDB(t)
+	ctx := context.Background()
+
+	var devices []*model.DeviceInfo
+	for _, id := range []string{"active", "deactivated", "unbound", "deleted"} {
+		devices = append(devices, &model.DeviceInfo{DeviceID: id, ActiveStatus: 1, UserID: "alice", NodeType: 1, IpCountry: "CN"})
+	}
+	if err := UpdateDeviceLeaderboards(ctx, devices); err != nil {
+		t.Fatal(err)
+	}
+
+	// the devices as they are in the database now
+	mock.ExpectQuery(`SELECT \* FROM device_info WHERE device_id IN`).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "active_status", "user_id", "node_type", "ip_country"}).
+			AddRow("active", 1, "alice", 1, "CN").
+			AddRow("deactivated", 0, "alice", 1, "CN").
+			AddRow("unbound", 1, "", 1, "CN"))
+
+	removed, err := PruneDeviceLeaderboards(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("PruneDeviceLeaderboards() = %d, want 3", removed)
+	}
+
+	for _, device := range devices {
+		ranked := len(rankedScopes(t, mr, device.DeviceID)) > 0
+		if ranked != (device.DeviceID == "active") {
+			t.Errorf("device %s ranked %v after the prune", device.DeviceID, ranked)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const (
+	tableNameRewardLedger         = "reward_ledger"
+	tableNameRewardSettlement     = "reward_settlement"
+	tableNameRewardReconciliation = "reward_reconciliation"
+	tableNameReconciliationBase   = "reward_reconciliation_baseline"
+)
+
+var ErrUnbalancedLedgerEntry = errors.New("ledger entry is not balanced")
+
+func ledgerPosting(username, account string, amount int64) *model.RewardLedger {
+	return &model.RewardLedger{Username: username, Account: account, Amount: amount}
+}
+
+// checkLedgerPostings returns ErrUnbalancedLedgerEntry if there's no posting or the amounts don't sum to zero.
+func checkLedgerPostings(postings []*model.RewardLedger) error {
+	var sum int64
+	for _, p := range postings {
+		sum += p.Amount
+	}
+
+	if len(postings) == 0 || sum != 0 {
+		return ErrUnbalancedLedgerEntry
+	}
+	return nil
+}
+
+// postLedger inserts the postings of a ledger transaction, the amounts of the postings must sum to zero.
+// The reward, frozen_reward and payout of the users touched are derived from the ledger again in the same transaction.
+func postLedger(ctx context.Context, tx *sqlx.Tx, txID string, event model.RewardEvent, postings ...*model.RewardLedger) error {
+	if err := checkLedgerPostings(postings); err != nil {
+		return err
+	}
+
+	users := make(map[string]struct{})
+	now := time.Now()
+	for _, p := range postings {
+		p.TxID = txID
+		p.Event = event
+		p.CreatedAt = now
+		if p.Username != "" {
+			users[p.Username] = struct{}{}
+		}
+	}
+
+	_, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (tx_id, username, account, event, amount, created_at)
+			VALUES (:tx_id, :username, :account, :event, :amount, :created_at);`, tableNameRewardLedger),
+		postings)
+	if err != nil {
+		return err
+	}
+
+	for username := range users {
+		if err = syncUserBalance(ctx, tx, username); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func syncUserBalance(ctx context.Context, tx *sqlx.Tx, username string) error {
+	balance := fmt.Sprintf(`(SELECT IFNULL(SUM(amount), 0) FROM %s WHERE username = ? AND account = ?)`, tableNameRewardLedger)
+	query := fmt.Sprintf(`UPDATE %s SET reward = %s, frozen_reward = %s, payout = %s WHERE username = ?`,
+		tableNameUser, balance, balance, balance)
+
+	_, err := tx.ExecContext(ctx, query,
+		username, model.LedgerAccountReward,
+		username, model.LedgerAccountFrozen,
+		username, model.LedgerAccountPayout,
+		username)
+	return err
+}
+
+// SettleUserReward settles the reward of the statement for the period starting at the day, the amount of the statement
+// is the total of the period. The settlement of a user, period, event and source is unique, settling it again only posts
+// the difference to the amount already settled, so a retry or a double run never pays twice. The closed settlements
+// are final and are skipped.
+func SettleUserReward(ctx context.Context, day time.Time, final bool, statement *model.RewardStatement) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	period := day.Format(time.DateOnly)
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT IGNORE INTO %s (username, from_user, event, period, amount, closed, created_at, updated_at) VALUES (?, ?, ?, ?, 0, 0, ?, ?)`,
+		tableNameRewardSettlement), statement.Username, statement.FromUser, statement.Event, period, now, now)
+	if err != nil {
+		return err
+	}
+
+	var settlement model.RewardSettlement
+	err = tx.GetContext(ctx, &settlement, fmt.Sprintf(
+		`SELECT * FROM %s WHERE username = ? AND period = ? AND event = ? AND from_user = ? FOR UPDATE`, tableNameRewardSettlement),
+		statement.Username, period, statement.Event, statement.FromUser)
+	if err != nil {
+		return err
+	}
+
+	if settlement.Closed {
+		return nil
+	}
+
+	if postings := settlementPostings(statement, settlement.Amount); len(postings) > 0 {
+		txID := fmt.Sprintf("settlement:%d:%d", settlement.ID, now.UnixNano())
+		err = postLedger(ctx, tx, txID, statement.Event, postings...)
+		if err != nil {
+			return err
+		}
+
+		if err = upsertRewardStatement(ctx, tx, statement, day, day.AddDate(0, 0, 1)); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET amount = ?, closed = ?, updated_at = ? WHERE id = ?`, tableNameRewardSettlement),
+		statement.Amount, final, now, settlement.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// settlementPostings returns the postings crediting the reward of the user with the difference between the amount of
+// the statement and the amount settled, from the earning or the referral system account. It returns nil if there's
+// no difference.
+func settlementPostings(statement *model.RewardStatement, settled int64) []*model.RewardLedger {
+	delta := statement.Amount - settled
+	if delta == 0 {
+		return nil
+	}
+
+	system := model.LedgerAccountEarning
+	if statement.Event != model.RewardEventEarning {
+		system = model.LedgerAccountReferral
+	}
+
+	return []*model.RewardLedger{
+		ledgerPosting(statement.Username, model.LedgerAccountReward, delta),
+		ledgerPosting("", system, -delta),
+	}
+}
+
+// SumLedgerEarnings returns the earnings credited to the users by the ledger.
+func SumLedgerEarnings(ctx context.Context) (map[string]int64, error) {
+	query := fmt.Sprintf(`SELECT username, SUM(amount) FROM %s WHERE account = ? AND event = ? GROUP BY username`, tableNameRewardLedger)
+
+	rows, err := DB.QueryxContext(ctx, query, model.LedgerAccountReward, model.RewardEventEarning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var username string
+		var amount int64
+		if err := rows.Scan(&username, &amount); err != nil {
+			return nil, err
+		}
+		out[username] = amount
+	}
+
+	return out, rows.Err()
+}
+
+// GetRewardReconciliationBaselines returns the ledger earnings and the device profits of the users at the opening of
+// the ledger, keyed by username.
+func GetRewardReconciliationBaselines(ctx context.Context) (map[string]*model.RewardReconciliationBaseline, error) {
+	var list []*model.RewardReconciliationBaseline
+	err := DB.SelectContext(ctx, &list, fmt.Sprintf(`SELECT * FROM %s`, tableNameReconciliationBase))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]*model.RewardReconciliationBaseline, len(list))
+	for _, baseline := range list {
+		out[baseline.Username] = baseline
+	}
+
+	return out, nil
+}
+
+// SaveRewardReconciliations keeps one record per user for the day, the records of the users no longer drifting are
+// removed.
+func SaveRewardReconciliations(ctx context.Context, day time.Time, records []*model.RewardReconciliation) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	date := day.Format(time.DateOnly)
+	if len(records) == 0 {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE time = ?`, tableNameRewardReconciliation), date)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	usernames := make([]string, 0, len(records))
+	for _, record := range records {
+		usernames = append(usernames, record.Username)
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`DELETE FROM %s WHERE time = ? AND username NOT IN (?)`, tableNameRewardReconciliation), date, usernames)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (username, time, ledger_amount, device_profit, drift, created_at, updated_at)
+			VALUES (:username, :time, :ledger_amount, :device_profit, :drift, :created_at, :updated_at)
+			ON DUPLICATE KEY UPDATE ledger_amount = VALUES(ledger_amount), device_profit = VALUES(device_profit),
+			drift = VALUES(drift), updated_at = VALUES(updated_at);`, tableNameRewardReconciliation),
+		records)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func ListRewardReconciliations(ctx context.Context, username string, option QueryOption) ([]*model.RewardReconciliation, int64, error) {
+	var args []interface{}
+	var total int64
+	var out []*model.RewardReconciliation
+
+	where := `WHERE 1=1`
+	if username != "" {
+		where += ` AND username = ?`
+		args = append(args, username)
+	}
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(
+		`SELECT count(*) FROM %s %s`, tableNameRewardReconciliation, where,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s %s ORDER BY time DESC, id DESC LIMIT %d OFFSET %d`, tableNameRewardReconciliation, where, limit, offset,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
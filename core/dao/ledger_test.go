@@ -0,0 +1,111 @@
+package dao
+
+import (
+	"errors"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+)
+
+// ledgerBalances sums the postings by username and account.
+func ledgerBalances(balances map[string]int64, postings []*model.RewardLedger) {
+	for _, p := range postings {
+		balances[p.Username+"/"+p.Account] += p.Amount
+	}
+}
+
+func TestCheckLedgerPostings(t *testing.T) {
+	cases := []struct {
+		name     string
+		postings []*model.RewardLedger
+		err      error
+	}{
+		{"balanced", []*model.RewardLedger{
+			ledgerPosting("alice", model.LedgerAccountReward, 100),
+			ledgerPosting("", model.LedgerAccountEarning, -100),
+		}, nil},
+		{"balanced across users", []*model.RewardLedger{
+			ledgerPosting("alice", model.LedgerAccountReward, 60),
+			ledgerPosting("bob", model.LedgerAccountReward, 40),
+			ledgerPosting("", model.LedgerAccountReferral, -100),
+		}, nil},
+		{"unbalanced", []*model.RewardLedger{
+			ledgerPosting("alice", model.LedgerAccountReward, 100),
+			ledgerPosting("", model.LedgerAccountEarning, -99),
+		}, ErrUnbalancedLedgerEntry},
+		{"single posting", []*model.RewardLedger{
+			ledgerPosting("alice", model.LedgerAccountReward, 100),
+		}, ErrUnbalancedLedgerEntry},
+		{"no posting", nil, ErrUnbalancedLedgerEntry},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkLedgerPostings(c.postings); !errors.Is(err, c.err) {
+				t.Errorf("checkLedgerPostings() = %v, want %v", err, c.err)
+			}
+		})
+	}
+}
+
+func TestSettlementPostings(t *testing.T) {
+	cases := []struct {
+		name    string
+		event   model.RewardEvent
+		amount  int64
+		settled int64
+		system  string
+		delta   int64
+	}{
+		{"first settlement", model.RewardEventEarning, 100, 0, model.LedgerAccountEarning, 100},
+		{"more earned", model.RewardEventEarning, 150, 100, model.LedgerAccountEarning, 50},
+		{"corrected down", model.RewardEventEarning, 120, 150, model.LedgerAccountEarning, -30},
+		{"already settled", model.RewardEventEarning, 120, 120, "", 0},
+		{"referral", model.RewardEventReferrals, 10, 4, model.LedgerAccountReferral, 6},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statement := &model.RewardStatement{Username: "alice", FromUser: "bob", Event: c.event, Amount: c.amount}
+			postings := settlementPostings(statement, c.settled)
+
+			if c.delta == 0 {
+				if postings != nil {
+					t.Fatalf("got %d postings, want none", len(postings))
+				}
+				return
+			}
+
+			if err := checkLedgerPostings(postings); err != nil {
+				t.Fatal(err)
+			}
+
+			balances := make(map[string]int64)
+			ledgerBalances(balances, postings)
+			if got := balances["alice/"+model.LedgerAccountReward]; got != c.delta {
+				t.Errorf("reward of the user = %d, want %d", got, c.delta)
+			}
+			if got := balances["/"+c.system]; got != -c.delta {
+				t.Errorf("%s = %d, want %d", c.system, got, -c.delta)
+			}
+		})
+	}
+}
+
+// TestSettlementReplay settles the same period again and again as the settlement job does, the reward of the user ends
+// at the last amount whatever the amounts before were.
+func TestSettlementReplay(t *testing.T) {
+	balances := make(map[string]int64)
+	var settled int64
+	for _, amount := range []int64{100, 100, 150, 120, 120, 0, 80} {
+		statement := &model.RewardStatement{Username: "alice", Event: model.RewardEventEarning, Amount: amount}
+		ledgerBalances(balances, settlementPostings(statement, settled))
+		settled = amount
+	}
+
+	if got := balances["alice/"+model.LedgerAccountReward]; got != 80 {
+		t.Errorf("reward = %d, want 80", got)
+	}
+	if got := balances["/"+model.LedgerAccountEarning]; got != -80 {
+		t.Errorf("system earning = %d, want -80", got)
+	}
+}
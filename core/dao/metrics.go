@@ -0,0 +1,14 @@
+package dao
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var bulkUpsertLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "titan_explorer",
+	Subsystem: "dao",
+	Name:      "bulk_upsert_duration_seconds",
+	Help:      "Latency of the bulk upsert statements by table.",
+	Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+}, []string{"table", "status"})
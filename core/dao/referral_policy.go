@@ -0,0 +1,80 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+const tableNameReferralPolicy = "referral_policy"
+
+func ListReferralPolicies(ctx context.Context, enabledOnly bool) ([]*model.ReferralPolicy, error) {
+	query := fmt.Sprintf(`SELECT * FROM %s`, tableNameReferralPolicy)
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	query += " ORDER BY level, priority DESC, min_referees"
+
+	var out []*model.ReferralPolicy
+	if err := DB.SelectContext(ctx, &out, query); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func AddReferralPolicy(ctx context.Context, policy *model.ReferralPolicy) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (name, level, percentage, min_referees, max_reward, invite_reward, bind_reward, priority, enabled, start_at, end_at, created_at, updated_at)
+			VALUES (:name, :level, :percentage, :min_referees, :max_reward, :invite_reward, :bind_reward, :priority, :enabled, :start_at, :end_at, :created_at, :updated_at);`,
+		tableNameReferralPolicy), policy)
+	if err != nil {
+		return err
+	}
+
+	policy.ID, err = result.LastInsertId()
+	return err
+}
+
+func UpdateReferralPolicy(ctx context.Context, policy *model.ReferralPolicy) error {
+	result, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET name = :name, level = :level, percentage = :percentage, min_referees = :min_referees, max_reward = :max_reward,
+			invite_reward = :invite_reward, bind_reward = :bind_reward, priority = :priority, enabled = :enabled, start_at = :start_at,
+			end_at = :end_at, updated_at = :updated_at WHERE id = :id`, tableNameReferralPolicy), policy)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+	return nil
+}
+
+func DeleteReferralPolicy(ctx context.Context, id int64) error {
+	result, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, tableNameReferralPolicy), id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+	return nil
+}
+
+// CountReferees returns the number of the users invited by the referral code.
+func CountReferees(ctx context.Context, referralCode string) (int64, error) {
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s WHERE referrer = ?`, tableNameUser), referralCode)
+	return total, err
+}
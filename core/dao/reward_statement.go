@@ -15,6 +15,9 @@ const (
 	tableNameRewardWithdraw  = "withdraw_record"
 )
 
+// UpdateUserReward pays the one-off rewards like the invite and the bind rewards, the earnings and the referral rewards
+// are paid by the settlements, see SettleUserReward. The reward is credited to the username of the statement, the
+// referrer, the statements paid before the ledger credited from_user.
 func UpdateUserReward(ctx context.Context, statement *model.RewardStatement) error {
 	tx, err := DB.Beginx()
 	if err != nil {
@@ -22,76 +25,56 @@ func UpdateUserReward(ctx context.Context, statement *model.RewardStatement) err
 	}
 	defer tx.Rollback()
 
-	if statement.Event == model.RewardEventEarning || statement.Event == model.RewardEventReferrals {
-		err = insertOrUpdateRewardStatement(ctx, tx, statement)
-		if err != nil {
-			return err
-		}
-		return tx.Commit()
-	}
-
-	updateRewardQuery := fmt.Sprintf("update %s set reward = reward + ? where username = ?", tableNameUser)
-
-	_, err = tx.ExecContext(ctx, updateRewardQuery, statement.Amount, statement.FromUser)
-	if err != nil {
-		return err
-	}
-
 	query := fmt.Sprintf(
 		`INSERT INTO %s (username, from_user, amount, event, status, device_id, created_at, updated_at)
 			VALUES (:username, :from_user, :amount, :event, :status, :device_id, :created_at, :updated_at);`, tableNameRewardStatement)
 
-	_, err = tx.NamedExecContext(ctx, query, statement)
+	result, err := tx.NamedExecContext(ctx, query, statement)
 	if err != nil {
 		return err
 	}
 
+	if statement.Amount != 0 {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		err = postLedger(ctx, tx, fmt.Sprintf("statement:%d", id), statement.Event,
+			ledgerPosting(statement.Username, model.LedgerAccountReward, statement.Amount),
+			ledgerPosting("", model.LedgerAccountReferral, -statement.Amount),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
-func insertOrUpdateRewardStatement(ctx context.Context, tx *sqlx.Tx, statement *model.RewardStatement) error {
-	getQuery := fmt.Sprintf(`select * from %s where username = ? and event =? and created_at >= ? limit 1`, tableNameRewardStatement)
+// upsertRewardStatement keeps one statement in the time range for each pair of the user and the source of the reward,
+// the statements are for display only, the balances come from the ledger.
+func upsertRewardStatement(ctx context.Context, tx *sqlx.Tx, statement *model.RewardStatement, start, end time.Time) error {
+	getQuery := fmt.Sprintf(`select * from %s where username = ? and from_user = ? and event = ? and created_at >= ? and created_at < ? limit 1`, tableNameRewardStatement)
 
 	var rs model.RewardStatement
-	err := DB.GetContext(ctx, &rs, getQuery, statement.Username, statement.Event, statement.CreatedAt.Format(time.DateOnly))
+	err := tx.GetContext(ctx, &rs, getQuery, statement.Username, statement.FromUser, statement.Event, start, end)
 	if errors.Is(err, sql.ErrNoRows) {
-		updateRewardQuery := fmt.Sprintf("update %s set reward = reward + ? where username = ?", tableNameUser)
-
-		_, err = tx.ExecContext(ctx, updateRewardQuery, statement.Amount, statement.FromUser)
-		if err != nil {
-			return err
-		}
-
 		query := fmt.Sprintf(
 			`INSERT INTO %s (username, from_user, amount, event, status, device_id, created_at, updated_at)
 			VALUES (:username, :from_user, :amount, :event, :status, :device_id, :created_at, :updated_at);`, tableNameRewardStatement)
 
 		_, err = tx.NamedExecContext(ctx, query, statement)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	if err != nil {
-		return err
-	}
-
-	reward := statement.Amount - rs.Amount
-	updateRewardQuery := fmt.Sprintf("update %s set reward = reward + ? where username = ?", tableNameUser)
-	_, err = tx.ExecContext(ctx, updateRewardQuery, reward, statement.FromUser)
-	if err != nil {
 		return err
 	}
 
-	updateQuery := fmt.Sprintf("update %s set amount = ? where id = ?", tableNameRewardStatement)
-	_, err = tx.ExecContext(ctx, updateQuery, statement.Amount, rs.ID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	updateQuery := fmt.Sprintf("update %s set amount = ?, updated_at = ? where id = ?", tableNameRewardStatement)
+	_, err = tx.ExecContext(ctx, updateQuery, statement.Amount, time.Now(), rs.ID)
+	return err
 }
 
 func GetRewardStatementByDeviceID(ctx context.Context, deviceId string) (*model.RewardStatement, error) {
@@ -171,17 +154,21 @@ func AddWithdrawRequest(ctx context.Context, withdraw *model.Withdraw) error {
 	}
 	defer tx.Rollback()
 
-	updateRewardQuery := fmt.Sprintf("update %s set reward = reward - ?, frozen_reward = frozen_reward + ? where username = ?", tableNameUser)
+	result, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (username, to_address, amount, hash, status, created_at, updated_at)
+			VALUES (:username, :to_address, :amount, :hash, :status, :created_at, :updated_at);`, tableNameRewardWithdraw),
+		withdraw)
+	if err != nil {
+		return err
+	}
 
-	_, err = tx.ExecContext(ctx, updateRewardQuery, withdraw.Amount, withdraw.Amount, withdraw.Username)
+	withdraw.ID, err = result.LastInsertId()
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
-		`INSERT INTO %s (username, to_address, amount, hash, status, created_at, updated_at)
-			VALUES (:username, :to_address, :amount, :hash, :status, :created_at, :updated_at);`, tableNameRewardWithdraw),
-		withdraw)
+	err = postLedger(ctx, tx, withdrawLedgerTxID(withdraw.ID, withdraw.Status), model.LedgerEventWithdraw,
+		withdrawPostings(withdraw, model.WithdrawStatusPending)...)
 	if err != nil {
 		return err
 	}
@@ -141,6 +141,9 @@ func GetNodesInfoDailyList(ctx context.Context, cond *model.DeviceInfoDaily, opt
 		where += ` AND user_id = ?`
 		args = append(args, cond.UserID)
 	}
+	filter, filterArgs := deviceFilterClause("device_id", option)
+	where += filter
+	args = append(args, filterArgs...)
 	if option.StartTime != "" {
 		where += ` AND time >= ?`
 		args = append(args, option.StartTime)
@@ -223,11 +226,12 @@ func append24HoursData(in []*DeviceStatistics) []*DeviceStatistics {
 }
 
 func GetUserIncome(cond *model.DeviceInfo, option QueryOption) (map[string]map[string]interface{}, error) {
+	filter, filterArgs := deviceFilterClause("a.device_id", option)
 	sqlClause := fmt.Sprintf(`
 		select date_format(b.time, '%%Y-%%m-%%d') as date, sum(b.income) as income  from %s a LEFT JOIN %s b on a.device_id = b.device_id 
-    	and a.user_id = '%s' and date_format(b.time, '%%Y-%%m-%%d') >='%s' and date_format(b.time, '%%Y-%%m-%%d') <='%s' group by date`,
-		tableNameDeviceInfo, tableNameDeviceInfoDaily, cond.UserID, option.StartTime, option.EndTime)
-	dataS, err := GetQueryDataList(sqlClause)
+    	and a.user_id = '%s' and date_format(b.time, '%%Y-%%m-%%d') >='%s' and date_format(b.time, '%%Y-%%m-%%d') <='%s'%s group by date`,
+		tableNameDeviceInfo, tableNameDeviceInfoDaily, cond.UserID, option.StartTime, option.EndTime, filter)
+	dataS, err := GetQueryDataList(sqlClause, filterArgs...)
 	if err != nil {
 		return nil, err
 	}
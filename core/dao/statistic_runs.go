@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+var tableNameStatisticRuns = "statistic_runs"
+
+func AddStatisticRun(ctx context.Context, run *model.StatisticRun) error {
+	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (job, scheduler, start_time, end_time, rows_touched, error, created_at)
+			VALUES (:job, :scheduler, :start_time, :end_time, :rows_touched, :error, now());`, tableNameStatisticRuns,
+	), run)
+	return err
+}
+
+func ListStatisticRuns(ctx context.Context, job string, option QueryOption) ([]*model.StatisticRun, int64, error) {
+	var args []interface{}
+	var total int64
+	var out []*model.StatisticRun
+
+	where := `WHERE 1=1`
+	if job != "" {
+		where += ` AND job = ?`
+		args = append(args, job)
+	}
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(
+		`SELECT count(*) FROM %s %s`, tableNameStatisticRuns, where,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s %s ORDER BY id DESC LIMIT %d OFFSET %d`, tableNameStatisticRuns, where, limit, offset,
+	), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, err
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"time"
 )
 
 var tableNameUserSecret = "user_secret"
 
+const (
+	UserSecretStatusActive = iota
+	UserSecretStatusRevoked
+)
+
 func AddUserSecret(ctx context.Context, userSecret *model.UserSecret) error {
 	_, err := DB.NamedExecContext(ctx, fmt.Sprintf(
-		`INSERT INTO %s (user_id, app_key, app_secret, status, created_at, updated_at) 
-			VALUES (:user_id, :app_key, :app_secret, :status, :created_at, :updated_at);`, tableNameUserSecret),
+		`INSERT INTO %s (user_id, app_key, app_secret, perms, ip_allow_list, expired_at, status, created_at, updated_at) 
+			VALUES (:user_id, :app_key, :app_secret, :perms, :ip_allow_list, :expired_at, :status, :created_at, :updated_at);`, tableNameUserSecret),
 		userSecret)
 	return err
 }
@@ -25,3 +31,38 @@ func GetSecretKey(ctx context.Context, key string) (*model.UserSecret, error) {
 	}
 	return &secret, err
 }
+
+func ListUserSecrets(ctx context.Context, userID string) ([]*model.UserSecret, error) {
+	var out []*model.UserSecret
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * from %s WHERE user_id = ? ORDER BY id DESC`, tableNameUserSecret), userID)
+	return out, err
+}
+
+func GetUserSecretByAppKey(ctx context.Context, userID, appKey string) (*model.UserSecret, error) {
+	var secret model.UserSecret
+	err := DB.GetContext(ctx, &secret, fmt.Sprintf(
+		`SELECT * from %s WHERE user_id = ? AND app_key = ?`, tableNameUserSecret), userID, appKey)
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func UpdateUserSecret(ctx context.Context, id int64, appSecret string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET app_secret = ?, updated_at = now() WHERE id = ?`, tableNameUserSecret), appSecret, id)
+	return err
+}
+
+func RevokeUserSecret(ctx context.Context, id int64) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET status = ?, updated_at = now() WHERE id = ?`, tableNameUserSecret), UserSecretStatusRevoked, id)
+	return err
+}
+
+func UpdateUserSecretLastUsed(ctx context.Context, id int64, lastUsedAt time.Time) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET last_used_at = ? WHERE id = ?`, tableNameUserSecret), lastUsedAt, id)
+	return err
+}
@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+)
+
+var tableNameUserTOTP = "user_totp"
+
+// GetUserTOTP returns nil if the user hasn't enrolled.
+func GetUserTOTP(ctx context.Context, username string) (*model.UserTOTP, error) {
+	var out model.UserTOTP
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE username = ?`, tableNameUserTOTP), username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// EnrollUserTOTP saves a pending secret of the user, the callers must check the 2FA isn't enabled.
+func EnrollUserTOTP(ctx context.Context, username, secret string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (username, secret, enabled, recovery_codes, last_used_step, created_at, updated_at)
+			VALUES (?, ?, 0, '', 0, now(), now())
+			ON DUPLICATE KEY UPDATE secret = VALUES(secret), updated_at = now()`, tableNameUserTOTP),
+		username, secret)
+	return err
+}
+
+func EnableUserTOTP(ctx context.Context, username, recoveryCodes string, step int64) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET enabled = 1, recovery_codes = ?, last_used_step = ?, updated_at = now() WHERE username = ?`, tableNameUserTOTP),
+		recoveryCodes, step, username)
+	return err
+}
+
+func DeleteUserTOTP(ctx context.Context, username string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE username = ?`, tableNameUserTOTP), username)
+	return err
+}
+
+func UpdateUserTOTPRecoveryCodes(ctx context.Context, username, recoveryCodes string) error {
+	_, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET recovery_codes = ?, updated_at = now() WHERE username = ?`, tableNameUserTOTP),
+		recoveryCodes, username)
+	return err
+}
+
+// ReplaceUserTOTPRecoveryCodes replaces the recovery codes if they're unchanged since read,
+// it returns false if a concurrent request has changed them.
+func ReplaceUserTOTPRecoveryCodes(ctx context.Context, username, old, new string) (bool, error) {
+	result, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET recovery_codes = ?, updated_at = now() WHERE username = ? AND recovery_codes = ?`, tableNameUserTOTP),
+		new, username, old)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// UseUserTOTPStep marks the step as used, it returns false if the step or a later one is already used,
+// so a code can't be replayed.
+func UseUserTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	result, err := DB.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET last_used_step = ? WHERE username = ? AND last_used_step < ?`, tableNameUserTOTP),
+		step, username, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,169 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const tableNameUserWallet = "user_wallet"
+
+func ListUserWallets(ctx context.Context, username string) ([]*model.UserWallet, error) {
+	var out []*model.UserWallet
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE username = ? ORDER BY is_primary DESC, id`, tableNameUserWallet), username)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func GetUserWallet(ctx context.Context, username string, id int64) (*model.UserWallet, error) {
+	var out model.UserWallet
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? AND username = ?`, tableNameUserWallet), id, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWalletByAddress returns the wallet of the address bound by any user.
+func GetWalletByAddress(ctx context.Context, chain, address string) (*model.UserWallet, error) {
+	var out model.UserWallet
+	err := DB.GetContext(ctx, &out, fmt.Sprintf(`SELECT * FROM %s WHERE chain = ? AND address = ?`, tableNameUserWallet), chain, address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddUserWallet binds the wallet to the user, the first wallet of the user becomes the primary payout address.
+func AddUserWallet(ctx context.Context, wallet *model.UserWallet) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int64
+	err = tx.GetContext(ctx, &count, fmt.Sprintf(`SELECT count(*) FROM %s WHERE username = ? FOR UPDATE`, tableNameUserWallet), wallet.Username)
+	if err != nil {
+		return err
+	}
+
+	wallet.IsPrimary = count == 0
+	wallet.CreatedAt = time.Now()
+	wallet.UpdatedAt = wallet.CreatedAt
+
+	result, err := tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (username, chain, address, is_primary, created_at, updated_at)
+			VALUES (:username, :chain, :address, :is_primary, :created_at, :updated_at);`, tableNameUserWallet), wallet)
+	if err != nil {
+		return err
+	}
+
+	wallet.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if wallet.IsPrimary {
+		if err = syncPrimaryWallet(ctx, tx, wallet.Username); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetPrimaryWallet makes the wallet the primary payout address of the user.
+func SetPrimaryWallet(ctx context.Context, username string, id int64) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int64
+	err = tx.GetContext(ctx, &count, fmt.Sprintf(`SELECT count(*) FROM %s WHERE id = ? AND username = ?`, tableNameUserWallet), id, username)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoRow
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET is_primary = (id = ?), updated_at = ? WHERE username = ?`, tableNameUserWallet), id, time.Now(), username)
+	if err != nil {
+		return err
+	}
+
+	if err = syncPrimaryWallet(ctx, tx, username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUserWallet unbinds the wallet, the oldest wallet left becomes the primary if the primary is unbound.
+func DeleteUserWallet(ctx context.Context, username string, id int64) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND username = ?`, tableNameUserWallet), id, username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	var primary int64
+	err = tx.GetContext(ctx, &primary, fmt.Sprintf(`SELECT count(*) FROM %s WHERE username = ? AND is_primary = 1`, tableNameUserWallet), username)
+	if err != nil {
+		return err
+	}
+
+	if primary == 0 {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s SET is_primary = 1, updated_at = ? WHERE username = ? ORDER BY id LIMIT 1`, tableNameUserWallet), time.Now(), username)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = syncPrimaryWallet(ctx, tx, username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// syncPrimaryWallet keeps the wallet_address of the user the same as the primary wallet.
+func syncPrimaryWallet(ctx context.Context, tx *sqlx.Tx, username string) error {
+	query := fmt.Sprintf(`UPDATE %s SET wallet_address = IFNULL((SELECT address FROM %s WHERE username = ? AND is_primary = 1 LIMIT 1), '') WHERE username = ?`,
+		tableNameUser, tableNameUserWallet)
+	_, err := tx.ExecContext(ctx, query, username, username)
+	return err
+}
@@ -0,0 +1,148 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"testing"
+)
+
+// useMockDB replaces the database with a mock for the test, the expectations must all be met.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := DB
+	DB = sqlx.NewDb(db, "mysql")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		DB = prev
+		db.Close()
+	})
+
+	return mock
+}
+
+func expectSyncPrimaryWallet(mock sqlmock.Sqlmock, username string) {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET wallet_address = IFNULL((SELECT address FROM user_wallet WHERE username = ? AND is_primary = 1 LIMIT 1), '') WHERE username = ?`)).
+		WithArgs(username, username).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestAddUserWallet(t *testing.T) {
+	cases := []struct {
+		name    string
+		count   int64
+		primary bool
+	}{
+		{"first wallet becomes the primary", 0, true},
+		{"other wallets are not primary", 2, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE username = ? FOR UPDATE`)).
+				WithArgs("alice").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(c.count))
+			mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_wallet`)).
+				WithArgs("alice", model.WalletChainEVM, "0xabc", c.primary, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(7, 1))
+			if c.primary {
+				expectSyncPrimaryWallet(mock, "alice")
+			}
+			mock.ExpectCommit()
+
+			wallet := &model.UserWallet{Username: "alice", Chain: model.WalletChainEVM, Address: "0xabc"}
+			if err := AddUserWallet(context.Background(), wallet); err != nil {
+				t.Fatal(err)
+			}
+			if wallet.ID != 7 || wallet.IsPrimary != c.primary {
+				t.Errorf("wallet = %d primary %v, want 7 primary %v", wallet.ID, wallet.IsPrimary, c.primary)
+			}
+		})
+	}
+}
+
+func TestSetPrimaryWallet(t *testing.T) {
+	t.Run("own wallet", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE id = ? AND username = ?`)).
+			WithArgs(7, "alice").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_wallet SET is_primary = (id = ?), updated_at = ? WHERE username = ?`)).
+			WithArgs(7, sqlmock.AnyArg(), "alice").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		expectSyncPrimaryWallet(mock, "alice")
+		mock.ExpectCommit()
+
+		if err := SetPrimaryWallet(context.Background(), "alice", 7); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("wallet of another user", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE id = ? AND username = ?`)).
+			WithArgs(8, "alice").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectRollback()
+
+		if err := SetPrimaryWallet(context.Background(), "alice", 8); !errors.Is(err, ErrNoRow) {
+			t.Fatalf("SetPrimaryWallet() = %v, want %v", err, ErrNoRow)
+		}
+	})
+}
+
+func TestDeleteUserWallet(t *testing.T) {
+	cases := []struct {
+		name     string
+		deleted  int64
+		primary  int64
+		promoted bool
+		err      error
+	}{
+		{"primary unbound", 1, 0, true, nil},
+		{"other wallet unbound", 1, 1, false, nil},
+		{"wallet not found", 0, 0, false, ErrNoRow},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_wallet WHERE id = ? AND username = ?`)).
+				WithArgs(7, "alice").
+				WillReturnResult(sqlmock.NewResult(0, c.deleted))
+
+			if c.err != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM user_wallet WHERE username = ? AND is_primary = 1`)).
+					WithArgs("alice").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(c.primary))
+				if c.promoted {
+					mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_wallet SET is_primary = 1, updated_at = ? WHERE username = ? ORDER BY id LIMIT 1`)).
+						WithArgs(sqlmock.AnyArg(), "alice").
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				expectSyncPrimaryWallet(mock, "alice")
+				mock.ExpectCommit()
+			}
+
+			if err := DeleteUserWallet(context.Background(), "alice", 7); !errors.Is(err, c.err) {
+				t.Fatalf("DeleteUserWallet() = %v, want %v", err, c.err)
+			}
+		})
+	}
+}
@@ -48,10 +48,23 @@ func GetUserIds(ctx context.Context) ([]string, error) {
 	return out, nil
 }
 
-func UpdateUserWalletAddress(ctx context.Context, username, address string) error {
-	query := fmt.Sprintf("update %s set wallet_address = ? where username = ?", tableNameUser)
-	_, err := DB.ExecContext(ctx, query, address, username)
-	return err
+func UpdateUserRole(ctx context.Context, username string, role int32) error {
+	query := fmt.Sprintf("update %s set role = ?, updated_at = now() where username = ?", tableNameUser)
+	result, err := DB.ExecContext(ctx, query, role, username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRow
+	}
+
+	return nil
 }
 
 func GetUsersReferrer(ctx context.Context, username string) (*model.User, error) {
@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"time"
+)
+
+const tableNameWithdrawAudit = "withdraw_audit"
+
+var ErrWithdrawTransitionNotAllowed = errors.New("withdraw status transition not allowed")
+
+func withdrawLedgerTxID(id int64, status model.WithdrawStatus) string {
+	return fmt.Sprintf("withdraw:%d:%s", id, model.WithdrawStatusNames[status])
+}
+
+// TransitionWithdraw moves the withdraw request to the status and records the transition to the audit table.
+// The rejected and failed requests give the frozen amount back to the reward of the user, the confirmed requests
+// move it to the payout, the ledger entries are posted in the same transaction as the status change.
+func TransitionWithdraw(ctx context.Context, id int64, to model.WithdrawStatus, operator, hash, reason string) (*model.Withdraw, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var withdraw model.Withdraw
+	err = tx.GetContext(ctx, &withdraw, fmt.Sprintf(`SELECT * FROM %s WHERE id = ? FOR UPDATE`, tableNameRewardWithdraw), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRow
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !model.WithdrawTransitionAllowed(withdraw.Status, to) {
+		return nil, ErrWithdrawTransitionNotAllowed
+	}
+
+	audit := &model.WithdrawAudit{
+		WithdrawID: withdraw.ID,
+		Operator:   operator,
+		FromStatus: withdraw.Status,
+		ToStatus:   to,
+		Hash:       hash,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+
+	if hash != "" {
+		withdraw.Hash = hash
+	}
+	if reason != "" {
+		withdraw.Reason = reason
+	}
+	withdraw.Status = to
+	withdraw.UpdatedAt = audit.CreatedAt
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET status = :status, hash = :hash, reason = :reason, updated_at = :updated_at WHERE id = :id`, tableNameRewardWithdraw),
+		&withdraw)
+	if err != nil {
+		return nil, err
+	}
+
+	if postings := withdrawPostings(&withdraw, to); len(postings) > 0 {
+		err = postLedger(ctx, tx, withdrawLedgerTxID(withdraw.ID, to), model.LedgerEventWithdraw, postings...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.NamedExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (withdraw_id, operator, from_status, to_status, hash, reason, created_at)
+			VALUES (:withdraw_id, :operator, :from_status, :to_status, :hash, :reason, :created_at);`, tableNameWithdrawAudit),
+		audit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &withdraw, tx.Commit()
+}
+
+// withdrawPostings returns the postings of the withdraw request moving to the status, the pending requests freeze the
+// amount from the reward, the rejected and failed ones give it back to the reward and the confirmed ones move it to
+// the payout. The other statuses move nothing.
+func withdrawPostings(withdraw *model.Withdraw, to model.WithdrawStatus) []*model.RewardLedger {
+	switch to {
+	case model.WithdrawStatusPending:
+		return []*model.RewardLedger{
+			ledgerPosting(withdraw.Username, model.LedgerAccountReward, -withdraw.Amount),
+			ledgerPosting(withdraw.Username, model.LedgerAccountFrozen, withdraw.Amount),
+		}
+	case model.WithdrawStatusRejected, model.WithdrawStatusFailed:
+		return []*model.RewardLedger{
+			ledgerPosting(withdraw.Username, model.LedgerAccountFrozen, -withdraw.Amount),
+			ledgerPosting(withdraw.Username, model.LedgerAccountReward, withdraw.Amount),
+		}
+	case model.WithdrawStatusConfirmed:
+		return []*model.RewardLedger{
+			ledgerPosting(withdraw.Username, model.LedgerAccountFrozen, -withdraw.Amount),
+			ledgerPosting(withdraw.Username, model.LedgerAccountPayout, withdraw.Amount),
+		}
+	default:
+		return nil
+	}
+}
+
+// GetWithdrawRequests returns the withdraw requests of all users, filtered by the status if it's not negative.
+func GetWithdrawRequests(ctx context.Context, username string, status int32, option QueryOption) (int64, []*model.Withdraw, error) {
+	var out []*model.Withdraw
+
+	limit := option.PageSize
+	offset := option.Page
+	if option.PageSize <= 0 {
+		limit = 50
+	}
+	if option.Page > 0 {
+		offset = limit * (option.Page - 1)
+	}
+
+	where := "WHERE 1=1"
+	var args []interface{}
+	if username != "" {
+		where += " AND username = ?"
+		args = append(args, username)
+	}
+	if status >= 0 {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	var total int64
+	err := DB.GetContext(ctx, &total, fmt.Sprintf(`SELECT count(*) FROM %s %s`, tableNameRewardWithdraw, where), args...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM %s %s ORDER BY created_at DESC LIMIT ? OFFSET ?`, tableNameRewardWithdraw, where)
+	err = DB.SelectContext(ctx, &out, query, append(args, limit, offset)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, out, nil
+}
+
+func GetWithdrawAudits(ctx context.Context, withdrawID int64) ([]*model.WithdrawAudit, error) {
+	var out []*model.WithdrawAudit
+	err := DB.SelectContext(ctx, &out, fmt.Sprintf(
+		`SELECT * FROM %s WHERE withdraw_id = ? ORDER BY id`, tableNameWithdrawAudit), withdrawID)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
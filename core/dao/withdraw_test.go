@@ -0,0 +1,101 @@
+package dao
+
+import (
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+)
+
+func TestWithdrawTransitionAllowed(t *testing.T) {
+	allowed := map[[2]model.WithdrawStatus]bool{
+		{model.WithdrawStatusPending, model.WithdrawStatusApproved}:    true,
+		{model.WithdrawStatusPending, model.WithdrawStatusRejected}:    true,
+		{model.WithdrawStatusApproved, model.WithdrawStatusBroadcast}:  true,
+		{model.WithdrawStatusApproved, model.WithdrawStatusRejected}:   true,
+		{model.WithdrawStatusBroadcast, model.WithdrawStatusConfirmed}: true,
+		{model.WithdrawStatusBroadcast, model.WithdrawStatusFailed}:    true,
+	}
+
+	for from := range model.WithdrawStatusNames {
+		for to := range model.WithdrawStatusNames {
+			want := allowed[[2]model.WithdrawStatus{from, to}]
+			if got := model.WithdrawTransitionAllowed(from, to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v",
+					model.WithdrawStatusNames[from], model.WithdrawStatusNames[to], got, want)
+			}
+		}
+	}
+}
+
+// TestWithdrawPaths walks the withdraw requests through the state machine, the amount requested is frozen until the
+// request ends and the total of the user never changes.
+func TestWithdrawPaths(t *testing.T) {
+	const reward, amount = 1000, 300
+
+	cases := []struct {
+		name   string
+		path   []model.WithdrawStatus
+		reward int64
+		frozen int64
+		payout int64
+	}{
+		{"pending", []model.WithdrawStatus{model.WithdrawStatusPending}, reward - amount, amount, 0},
+		{"approved", []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusApproved}, reward - amount, amount, 0},
+		{"confirmed", []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusApproved,
+			model.WithdrawStatusBroadcast, model.WithdrawStatusConfirmed}, reward - amount, 0, amount},
+		{"rejected when pending", []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusRejected}, reward, 0, 0},
+		{"rejected when approved", []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusApproved,
+			model.WithdrawStatusRejected}, reward, 0, 0},
+		{"failed", []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusApproved,
+			model.WithdrawStatusBroadcast, model.WithdrawStatusFailed}, reward, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			withdraw := &model.Withdraw{Username: "alice", Amount: amount}
+			balances := map[string]int64{"alice/" + model.LedgerAccountReward: reward}
+
+			for i, status := range c.path {
+				if i > 0 && !model.WithdrawTransitionAllowed(c.path[i-1], status) {
+					t.Fatalf("%s -> %s not allowed", model.WithdrawStatusNames[c.path[i-1]], model.WithdrawStatusNames[status])
+				}
+
+				postings := withdrawPostings(withdraw, status)
+				if len(postings) > 0 {
+					if err := checkLedgerPostings(postings); err != nil {
+						t.Fatalf("postings of %s: %v", model.WithdrawStatusNames[status], err)
+					}
+				}
+				ledgerBalances(balances, postings)
+				withdraw.Status = status
+			}
+
+			got := [3]int64{
+				balances["alice/"+model.LedgerAccountReward],
+				balances["alice/"+model.LedgerAccountFrozen],
+				balances["alice/"+model.LedgerAccountPayout],
+			}
+			if want := [3]int64{c.reward, c.frozen, c.payout}; got != want {
+				t.Errorf("reward, frozen, payout = %v, want %v", got, want)
+			}
+			if total := got[0] + got[1] + got[2]; total != reward {
+				t.Errorf("total = %d, want %d", total, reward)
+			}
+		})
+	}
+}
+
+func TestWithdrawLedgerTxID(t *testing.T) {
+	if got := withdrawLedgerTxID(7, model.WithdrawStatusConfirmed); got != "withdraw:7:confirmed" {
+		t.Errorf("withdrawLedgerTxID() = %s", got)
+	}
+
+	// the tx ids of the transitions of a request differ, so each posts once
+	seen := make(map[string]bool)
+	for status := range model.WithdrawStatusNames {
+		id := withdrawLedgerTxID(7, status)
+		if seen[id] {
+			t.Errorf("duplicated tx id %s", id)
+		}
+		seen[id] = true
+	}
+}
@@ -37,6 +37,20 @@ const (
 	DeviceBound
 	InvalidCode
 	TimeoutCode
+	PermissionDenied
+	APPKeyExpired
+	IPNotAllowed
+	TooManyRequests
+	AccountLocked
+	TOTPRequired
+	InvalidTOTPCode
+	TOTPAlreadyEnabled
+	TOTPNotEnrolled
+	InvalidWithdrawStatus
+	WalletNotFound
+	WalletUnbindCooldown
+	DeviceGroupExists
+	DeviceBatchUndoNotAllowed
 
 	InvalidMinerID = iota + 2000
 	InvalidAddress
@@ -107,6 +121,20 @@ var ErrMap = map[int]string{
 	DeviceBound:                              "device already bound: 设备已经绑定",
 	InvalidCode:                              "invalid code: 无效的绑定码",
 	TimeoutCode:                              "request timeout, please try again later: 请求超时, 请稍后再试",
+	PermissionDenied:                         "permission denied: 没有权限",
+	APPKeyExpired:                            "key expired: key已过期",
+	IPNotAllowed:                             "ip address not allowed: ip地址不允许访问",
+	TooManyRequests:                          "too many requests, please try again later: 请求过于频繁, 请稍后再试",
+	AccountLocked:                            "account locked due to too many failed logins, please try again later: 登录失败次数过多, 账号已被临时锁定",
+	TOTPRequired:                             "two-factor authentication code required: 需要二次验证码",
+	InvalidTOTPCode:                          "invalid two-factor authentication code: 无效的二次验证码",
+	TOTPAlreadyEnabled:                       "two-factor authentication already enabled: 已开启二次验证",
+	TOTPNotEnrolled:                          "two-factor authentication not enrolled: 未开启二次验证",
+	InvalidWithdrawStatus:                    "withdraw status change not allowed: 不允许变更提现状态",
+	WalletNotFound:                           "wallet not found: 钱包未绑定",
+	WalletUnbindCooldown:                     "the wallet can not be unbound yet, please try again later: 钱包绑定时间过短, 暂不能解绑",
+	DeviceGroupExists:                        "device group name already exists: 分组名称已存在",
+	DeviceBatchUndoNotAllowed:                "the batch can no longer be undone: 该批次已无法撤销",
 
 	InvalidMinerID:          "invalid miner id:miner id错误",
 	InvalidAddress:          "invalid owner/worker address: owner/worker 地址错误",
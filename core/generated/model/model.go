@@ -20,6 +20,101 @@ var (
 	RewardEventReferrals   RewardEvent = "referrals"
 )
 
+// the accounts of the reward ledger, the user accounts back the reward, frozen_reward and payout of the users,
+// the system accounts are where the rewards come from and have no username.
+const (
+	LedgerAccountReward   = "reward"
+	LedgerAccountFrozen   = "frozen"
+	LedgerAccountPayout   = "payout"
+	LedgerAccountEarning  = "system_earning"
+	LedgerAccountReferral = "system_referral"
+	LedgerAccountOpening  = "system_opening"
+)
+
+// LedgerEventWithdraw is the event of the ledger entries moving the rewards by the withdraw requests.
+const LedgerEventWithdraw RewardEvent = "withdraw"
+
+// the chains of the wallets the users bind, the filecoin wallets are f1 or f3 addresses.
+const (
+	WalletChainFilecoin = "filecoin"
+	WalletChainEVM      = "evm"
+)
+
+// the changes of the devices recorded to the device events, found by comparing with the previous device info.
+const (
+	DeviceEventStatus     = "status"
+	DeviceEventExternalIP = "external_ip"
+	DeviceEventDiskSpace  = "disk_space"
+	DeviceEventVersion    = "version"
+)
+
+// the alert rules of the devices, the threshold of the offline rules is in minutes and of the disk usage rules in percent.
+const (
+	DeviceAlertOffline   = "offline"
+	DeviceAlertAbnormal  = "abnormal"
+	DeviceAlertDiskUsage = "disk_usage"
+)
+
+// the channels the device alerts are delivered by.
+const (
+	AlertChannelEmail   = "email"
+	AlertChannelWebhook = "webhook"
+)
+
+// Role of the user, the zero value is the role of the registered users.
+type Role = int32
+
+const (
+	RoleUser Role = iota
+	RoleAdmin
+	RoleOperator
+	RoleReadOnly
+)
+
+var RoleNames = map[Role]string{
+	RoleUser:     "user",
+	RoleAdmin:    "admin",
+	RoleOperator: "operator",
+	RoleReadOnly: "read-only",
+}
+
+// WithdrawStatus is the state of a withdraw request, see WithdrawTransitions for the allowed changes.
+type WithdrawStatus = int32
+
+const (
+	WithdrawStatusPending WithdrawStatus = iota
+	WithdrawStatusApproved
+	WithdrawStatusBroadcast
+	WithdrawStatusConfirmed
+	WithdrawStatusRejected
+	WithdrawStatusFailed
+)
+
+var WithdrawStatusNames = map[WithdrawStatus]string{
+	WithdrawStatusPending:   "pending",
+	WithdrawStatusApproved:  "approved",
+	WithdrawStatusBroadcast: "broadcast",
+	WithdrawStatusConfirmed: "confirmed",
+	WithdrawStatusRejected:  "rejected",
+	WithdrawStatusFailed:    "failed",
+}
+
+// WithdrawTransitions are the statuses each status can move to, the confirmed, rejected and failed requests are final.
+var WithdrawTransitions = map[WithdrawStatus][]WithdrawStatus{
+	WithdrawStatusPending:   {WithdrawStatusApproved, WithdrawStatusRejected},
+	WithdrawStatusApproved:  {WithdrawStatusBroadcast, WithdrawStatusRejected},
+	WithdrawStatusBroadcast: {WithdrawStatusConfirmed, WithdrawStatusFailed},
+}
+
+func WithdrawTransitionAllowed(from, to WithdrawStatus) bool {
+	for _, status := range WithdrawTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
 type Project struct {
 	ID        int64     `db:"id" json:"id"`
 	Name      string    `db:"name" json:"name"`
@@ -84,3 +179,19 @@ type SignInfo struct {
 	MinerPower   string `json:"miner_power" db:"miner_power"`
 	MinerBalance string `json:"miner_balance" db:"miner_balance"`
 }
+
+type AssetBackupStats struct {
+	Key         string `db:"stat_key" json:"key"`
+	Backed      int64  `db:"backed" json:"backed"`
+	Pending     int64  `db:"pending" json:"pending"`
+	Failed      int64  `db:"failed" json:"failed"`
+	BackedSize  int64  `db:"backed_size" json:"backed_size"`
+	PendingSize int64  `db:"pending_size" json:"pending_size"`
+	FailedSize  int64  `db:"failed_size" json:"failed_size"`
+}
+
+type BackupDirStats struct {
+	Path       string `db:"path" json:"path"`
+	AssetCount int64  `db:"asset_count" json:"asset_count"`
+	TotalSize  int64  `db:"total_size" json:"total_size"`
+}
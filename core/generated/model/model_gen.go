@@ -101,7 +101,8 @@ type DeviceInfo struct {
 	UserID           string    `db:"user_id" json:"-"`
 
 	NodeType        int64   `db:"node_type" json:"node_type"`
-	DeviceRank      int64   `db:"device_rank" json:"device_rank"`
+	// Deprecated: device_rank is no longer updated, the devices are ranked on the leaderboards.
+	DeviceRank      int64   `db:"device_rank" json:"-"`
 	DeviceName      string  `db:"device_name" json:"device_name"`
 	SystemVersion   string  `db:"system_version" json:"system_version"`
 	NetworkInfo     string  `db:"network_info" json:"network_info"`
@@ -130,17 +131,22 @@ type DeviceInfo struct {
 	MonthProfit     float64 `db:"month_profit" json:"month_profit"`
 	AvailableProfit float64 `db:"available_profit" json:"available_profit"`
 	DeactivateTime  int64   `db:"deactivate_time" json:"deactivate_time"`
+	Uptime24h       float64 `db:"uptime_24h" json:"uptime_24h"`
+	Uptime7d        float64 `db:"uptime_7d" json:"uptime_7d"`
+	Uptime30d       float64 `db:"uptime_30d" json:"uptime_30d"`
+	QualityScore    float64 `db:"quality_score" json:"quality_score"`
 
 	Location
 }
 
 type NodesInfo struct {
-	Rank        string  `db:"rank" json:"rank"`
-	NodeType    string  `db:"node_type" json:"node_type"`
-	UserId      string  `db:"user_id" json:"user_id"`
-	NodeCount   int64   `db:"node_count" json:"node_count"`
-	DiskSpace   float64 `db:"disk_space" json:"disk_space"`
-	BandwidthUp float64 `db:"bandwidth_up" json:"bandwidth_up"`
+	Rank         string  `db:"rank" json:"rank"`
+	NodeType     string  `db:"node_type" json:"node_type"`
+	UserId       string  `db:"user_id" json:"user_id"`
+	NodeCount    int64   `db:"node_count" json:"node_count"`
+	DiskSpace    float64 `db:"disk_space" json:"disk_space"`
+	BandwidthUp  float64 `db:"bandwidth_up" json:"bandwidth_up"`
+	QualityScore float64 `db:"quality_score" json:"quality_score"`
 }
 
 type DeviceInfoDaily struct {
@@ -464,14 +470,18 @@ type FilStorage struct {
 }
 
 type UserSecret struct {
-	ID        int64     `db:"id" json:"id"`
-	UserID    string    `db:"user_id" json:"user_id"`
-	AppKey    string    `db:"app_key" json:"app_key"`
-	AppSecret string    `db:"app_secret" json:"app_secret"`
-	Status    int32     `db:"status" json:"status"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
-	DeletedAt time.Time `db:"deleted_at" json:"deleted_at"`
+	ID          int64     `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	AppKey      string    `db:"app_key" json:"app_key"`
+	AppSecret   string    `db:"app_secret" json:"app_secret"`
+	Perms       string    `db:"perms" json:"perms"`
+	IPAllowList string    `db:"ip_allow_list" json:"ip_allow_list"`
+	ExpiredAt   time.Time `db:"expired_at" json:"expired_at"`
+	LastUsedAt  time.Time `db:"last_used_at" json:"last_used_at"`
+	Status      int32     `db:"status" json:"status"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	DeletedAt   time.Time `db:"deleted_at" json:"deleted_at"`
 }
 
 type RewardStatement struct {
@@ -491,12 +501,91 @@ type Withdraw struct {
 	Username  string    `db:"username" json:"username"`
 	Amount    int64     `db:"amount" json:"amount"`
 	ToAddress string    `db:"to_address" json:"to_address"`
-	Hash      string    `db:"hash" json:"hash"'`
+	Hash      string    `db:"hash" json:"hash"`
 	Status    int32     `db:"status" json:"status"`
+	Reason    string    `db:"reason" json:"reason"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
+type ReferralPolicy struct {
+	ID           int64     `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	Level        int       `db:"level" json:"level"`
+	Percentage   float64   `db:"percentage" json:"percentage"`
+	MinReferees  int64     `db:"min_referees" json:"min_referees"`
+	MaxReward    int64     `db:"max_reward" json:"max_reward"`
+	InviteReward int64     `db:"invite_reward" json:"invite_reward"`
+	BindReward   int64     `db:"bind_reward" json:"bind_reward"`
+	Priority     int       `db:"priority" json:"priority"`
+	Enabled      bool      `db:"enabled" json:"enabled"`
+	StartAt      time.Time `db:"start_at" json:"start_at"`
+	EndAt        time.Time `db:"end_at" json:"end_at"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type RewardLedger struct {
+	ID        int64       `db:"id" json:"id"`
+	TxID      string      `db:"tx_id" json:"tx_id"`
+	Username  string      `db:"username" json:"username"`
+	Account   string      `db:"account" json:"account"`
+	Event     RewardEvent `db:"event" json:"event"`
+	Amount    int64       `db:"amount" json:"amount"`
+	CreatedAt time.Time   `db:"created_at" json:"created_at"`
+}
+
+type RewardSettlement struct {
+	ID        int64       `db:"id" json:"id"`
+	Username  string      `db:"username" json:"username"`
+	FromUser  string      `db:"from_user" json:"from_user"`
+	Event     RewardEvent `db:"event" json:"event"`
+	Period    string      `db:"period" json:"period"`
+	Amount    int64       `db:"amount" json:"amount"`
+	Closed    bool        `db:"closed" json:"closed"`
+	CreatedAt time.Time   `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time   `db:"updated_at" json:"updated_at"`
+}
+
+type RewardReconciliation struct {
+	ID           int64     `db:"id" json:"id"`
+	Username     string    `db:"username" json:"username"`
+	Time         time.Time `db:"time" json:"time"`
+	LedgerAmount int64     `db:"ledger_amount" json:"ledger_amount"`
+	DeviceProfit float64   `db:"device_profit" json:"device_profit"`
+	Drift        float64   `db:"drift" json:"drift"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type RewardReconciliationBaseline struct {
+	Username     string    `db:"username" json:"username"`
+	LedgerAmount int64     `db:"ledger_amount" json:"ledger_amount"`
+	DeviceProfit float64   `db:"device_profit" json:"device_profit"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type UserWallet struct {
+	ID        int64     `db:"id" json:"id"`
+	Username  string    `db:"username" json:"username"`
+	Chain     string    `db:"chain" json:"chain"`
+	Address   string    `db:"address" json:"address"`
+	IsPrimary bool      `db:"is_primary" json:"is_primary"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type WithdrawAudit struct {
+	ID         int64     `db:"id" json:"id"`
+	WithdrawID int64     `db:"withdraw_id" json:"withdraw_id"`
+	Operator   string    `db:"operator" json:"operator"`
+	FromStatus int32     `db:"from_status" json:"from_status"`
+	ToStatus   int32     `db:"to_status" json:"to_status"`
+	Hash       string    `db:"hash" json:"hash"`
+	Reason     string    `db:"reason" json:"reason"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
 type Subscription struct {
 	ID                      int64     `db:"id" json:"id"`
 	Company                 string    `db:"company" json:"company"`
@@ -527,3 +616,113 @@ type Signature struct {
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+type StatisticRun struct {
+	ID          int64     `db:"id" json:"id"`
+	Job         string    `db:"job" json:"job"`
+	Scheduler   string    `db:"scheduler" json:"scheduler"`
+	StartTime   time.Time `db:"start_time" json:"start_time"`
+	EndTime     time.Time `db:"end_time" json:"end_time"`
+	RowsTouched int64     `db:"rows_touched" json:"rows_touched"`
+	Error       string    `db:"error" json:"error"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+type UserTOTP struct {
+	ID            int64     `db:"id" json:"id"`
+	Username      string    `db:"username" json:"username"`
+	Secret        string    `db:"secret" json:"-"`
+	Enabled       bool      `db:"enabled" json:"enabled"`
+	RecoveryCodes string    `db:"recovery_codes" json:"-"`
+	LastUsedStep  int64     `db:"last_used_step" json:"-"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type DeviceEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	DeviceID  string    `db:"device_id" json:"device_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Event     string    `db:"event" json:"event"`
+	OldValue  string    `db:"old_value" json:"old_value"`
+	NewValue  string    `db:"new_value" json:"new_value"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceAlertRule struct {
+	ID          int64     `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	DeviceID    string    `db:"device_id" json:"device_id"`
+	Type        string    `db:"type" json:"type"`
+	Threshold   float64   `db:"threshold" json:"threshold"`
+	Channel     string    `db:"channel" json:"channel"`
+	Webhook     string    `db:"webhook" json:"webhook"`
+	Enabled     bool      `db:"enabled" json:"enabled"`
+	Triggered   bool      `db:"triggered" json:"triggered"`
+	TriggeredAt time.Time `db:"triggered_at" json:"triggered_at"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type DeviceGroup struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type DeviceGroupMember struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	GroupID   int64     `db:"group_id" json:"group_id"`
+	DeviceID  string    `db:"device_id" json:"device_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceTag struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	DeviceID  string    `db:"device_id" json:"device_id"`
+	Tag       string    `db:"tag" json:"tag"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceUnbindBatch struct {
+	ID        int64     `db:"id" json:"id"`
+	Username  string    `db:"username" json:"username"`
+	Total     int64     `db:"total" json:"total"`
+	Undone    bool      `db:"undone" json:"undone"`
+	UndoneAt  time.Time `db:"undone_at" json:"undone_at"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceUnbindItem struct {
+	ID             int64     `db:"id" json:"id"`
+	BatchID        int64     `db:"batch_id" json:"batch_id"`
+	DeviceID       string    `db:"device_id" json:"device_id"`
+	PrevUserID     string    `db:"prev_user_id" json:"-"`
+	PrevBindStatus string    `db:"prev_bind_status" json:"prev_bind_status"`
+	PrevBoundAt    time.Time `db:"prev_bound_at" json:"prev_bound_at"`
+	Restored       bool      `db:"restored" json:"restored"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceReliability struct {
+	ID             int64     `db:"id" json:"id"`
+	UserID         string    `db:"user_id" json:"user_id"`
+	DeviceID       string    `db:"device_id" json:"device_id"`
+	Time           time.Time `db:"time" json:"time"`
+	Uptime24h      float64   `db:"uptime_24h" json:"uptime_24h"`
+	Uptime7d       float64   `db:"uptime_7d" json:"uptime_7d"`
+	Uptime30d      float64   `db:"uptime_30d" json:"uptime_30d"`
+	Outages        int64     `db:"outages" json:"outages"`
+	OutageDuration int64     `db:"outage_duration" json:"outage_duration"`
+	LongestOutage  int64     `db:"longest_outage" json:"longest_outage"`
+	Mtbo           int64     `db:"mtbo" json:"mtbo"`
+	PkgLossRatio   float64   `db:"pkg_loss_ratio" json:"pkg_loss_ratio"`
+	Latency        float64   `db:"latency" json:"latency"`
+	QualityScore   float64   `db:"quality_score" json:"quality_score"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,272 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/mail"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var log = logging.Logger("mailer")
+
+const (
+	defaultQueueSize  = 256
+	defaultWorkers    = 2
+	defaultMaxRetries = 5
+)
+
+// the delay before retrying a failed delivery, doubled on each retry up to retryMaxDelay
+var (
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+var defaultMailer *Mailer
+
+type job struct {
+	msg      *mail.EmailMessage
+	attempts int
+}
+
+// Mailer renders the templates and delivers the messages by the transport, the queued messages are retried with
+// exponential backoff.
+type Mailer struct {
+	cfg       config.EmailConfig
+	registry  *Registry
+	transport Transport
+
+	queue   chan *job
+	closing chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// Init creates the default mailer by the config.
+func Init(cfg config.EmailConfig) error {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return err
+	}
+
+	m, err := New(cfg, transport)
+	if err != nil {
+		return err
+	}
+
+	SetDefault(m)
+	return nil
+}
+
+// SetDefault replaces the default mailer, the previous one is closed.
+func SetDefault(m *Mailer) {
+	if defaultMailer != nil {
+		defaultMailer.Close()
+	}
+	defaultMailer = m
+}
+
+func newTransport(cfg config.EmailConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "", TransportSMTP:
+		port, err := strconv.Atoi(cfg.SMTPPort)
+		if err != nil {
+			// the server still starts without mails rather than failing on a missing smtp config
+			log.Errorf("parse smtp port %q: %v, the mails are discarded", cfg.SMTPPort, err)
+			return &DiscardTransport{}, nil
+		}
+		return &SMTPTransport{Host: cfg.SMTPHost, Port: port, Username: cfg.Username, Password: cfg.Password}, nil
+	case TransportFile:
+		return &FileTransport{Dir: cfg.FileDir}, nil
+	case TransportMemory:
+		return &MemoryTransport{}, nil
+	default:
+		return nil, errors.Errorf("unknown mail transport: %s", cfg.Transport)
+	}
+}
+
+func New(cfg config.EmailConfig, transport Transport) (*Mailer, error) {
+	registry, err := NewRegistry()
+	if err != nil {
+		return nil, errors.Wrap(err, "parse mail templates")
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+
+	m := &Mailer{
+		cfg:       cfg,
+		registry:  registry,
+		transport: transport,
+		queue:     make(chan *job, cfg.QueueSize),
+		closing:   make(chan struct{}),
+	}
+
+	m.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go m.worker()
+	}
+
+	return m, nil
+}
+
+// Transport returns the transport of the mailer.
+func (m *Mailer) Transport() Transport {
+	return m.transport
+}
+
+func (m *Mailer) render(to string, lang model.Language, name Template, data interface{}) (*mail.EmailMessage, error) {
+	rendered, err := m.registry.Render(name, lang, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "render template %s", name)
+	}
+
+	msg := mail.NewEmailMessage(m.cfg.From, m.cfg.Nickname, rendered.Subject, "text/html", rendered.HTML, "", []string{to}, nil)
+	msg.TextContent = rendered.Text
+	return msg, nil
+}
+
+// Send delivers the message right away without retry, it's used when the caller reports the error to the user,
+// e.g. the verify codes.
+func (m *Mailer) Send(ctx context.Context, to string, lang model.Language, name Template, data interface{}) error {
+	msg, err := m.render(to, lang, name, data)
+	if err != nil {
+		return err
+	}
+
+	return m.transport.Send(ctx, msg)
+}
+
+// Enqueue renders the message and queues it for delivery.
+func (m *Mailer) Enqueue(to string, lang model.Language, name Template, data interface{}) error {
+	msg, err := m.render(to, lang, name, data)
+	if err != nil {
+		return err
+	}
+
+	return m.push(&job{msg: msg})
+}
+
+func (m *Mailer) push(j *job) error {
+	select {
+	case <-m.closing:
+		return errors.New("mailer closed")
+	default:
+	}
+
+	select {
+	case m.queue <- j:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (m *Mailer) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case j := <-m.queue:
+			m.deliver(j)
+		case <-m.closing:
+			// deliver the queued messages once before exit, the failed ones are not retried
+			for {
+				select {
+				case j := <-m.queue:
+					if err := m.transport.Send(context.Background(), j.msg); err != nil {
+						log.Errorf("send mail to %v: %v", j.msg.To, err)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Mailer) deliver(j *job) {
+	err := m.transport.Send(context.Background(), j.msg)
+	if err == nil {
+		return
+	}
+
+	j.attempts++
+	if j.attempts > m.cfg.MaxRetries {
+		log.Errorf("send mail to %v failed after %d attempts: %v", j.msg.To, j.attempts, err)
+		return
+	}
+
+	delay := retryDelay(j.attempts)
+	log.Warnf("send mail to %v: %v, retry in %s", j.msg.To, err, delay)
+
+	time.AfterFunc(delay, func() {
+		if err := m.push(j); err != nil {
+			log.Errorf("requeue mail to %v: %v", j.msg.To, err)
+		}
+	})
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay << uint(attempts-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// Close stops the workers after the queued messages are delivered.
+func (m *Mailer) Close() {
+	m.once.Do(func() {
+		close(m.closing)
+		m.wg.Wait()
+	})
+}
+
+func getDefault() (*Mailer, error) {
+	if defaultMailer == nil {
+		return nil, fmt.Errorf("mailer is not initialized")
+	}
+	return defaultMailer, nil
+}
+
+// Send delivers the message by the default mailer right away.
+func Send(ctx context.Context, to string, lang model.Language, name Template, data interface{}) error {
+	m, err := getDefault()
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, to, lang, name, data)
+}
+
+// Enqueue queues the message to the default mailer.
+func Enqueue(to string, lang model.Language, name Template, data interface{}) error {
+	m, err := getDefault()
+	if err != nil {
+		return err
+	}
+	return m.Enqueue(to, lang, name, data)
+}
+
+// Close closes the default mailer.
+func Close() {
+	if defaultMailer != nil {
+		defaultMailer.Close()
+	}
+}
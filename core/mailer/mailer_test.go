@@ -0,0 +1,257 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var templateData = map[Template]interface{}{
+	TemplateVerifyCode:        NewVerifyCodeData("123456"),
+	TemplatePasswordReset:     NewVerifyCodeData("654321"),
+	TemplateDeviceOffline:     DeviceOfflineData{DeviceID: "c_device", LastSeen: "2024-01-01 00:00:00"},
+	TemplateDeviceAbnormal:    DeviceAbnormalData{DeviceID: "c_device", Since: "2024-01-01 00:00:00"},
+	TemplateDeviceDiskUsage:   DeviceDiskUsageData{DeviceID: "c_device", DiskUsage: "95%", Threshold: "90%"},
+	TemplateWithdrawStatus:    WithdrawStatusData{Amount: "10", ToAddress: "titan1address", Status: "succeeded", Hash: "0xhash"},
+	TemplateApplicationResult: ApplicationResultData{Num: 1, Approved: true, DeviceIDs: []string{"e_device"}},
+}
+
+func TestRegistryRender(t *testing.T) {
+	registry, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lang := range model.SupportLanguages {
+		for _, name := range templateNames {
+			data, ok := templateData[name]
+			if !ok {
+				t.Fatalf("no test data for template %s", name)
+			}
+
+			rendered, err := registry.Render(name, lang, data)
+			if err != nil {
+				t.Errorf("render %s in %s: %v", name, lang, err)
+				continue
+			}
+
+			if rendered.Subject == "" || rendered.HTML == "" || rendered.Text == "" {
+				t.Errorf("render %s in %s: empty subject, html or text", name, lang)
+			}
+		}
+	}
+}
+
+func TestRegistryRenderFallback(t *testing.T) {
+	registry, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := templateData[TemplateApplicationResult]
+	want, err := registry.Render(TemplateApplicationResult, model.LanguageEN, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := registry.Render(TemplateApplicationResult, model.Language("fr"), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Subject != want.Subject {
+		t.Errorf("got subject %q, want the english one %q", got.Subject, want.Subject)
+	}
+
+	if _, err = registry.Render(Template("unknown"), model.LanguageEN, nil); err == nil {
+		t.Error("render an unknown template should fail")
+	}
+}
+
+// flakyTransport fails the first deliveries before passing them to the memory transport.
+type flakyTransport struct {
+	MemoryTransport
+
+	lk       sync.Mutex
+	failures int
+}
+
+func (t *flakyTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	t.lk.Lock()
+	if t.failures > 0 {
+		t.failures--
+		t.lk.Unlock()
+		return errors.New("smtp unavailable")
+	}
+	t.lk.Unlock()
+
+	return t.MemoryTransport.Send(ctx, msg)
+}
+
+// waitMessages waits for the transport to receive n messages.
+func waitMessages(t *testing.T, transport *MemoryTransport, n int) []*mail.EmailMessage {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := transport.Messages(); len(messages) >= n {
+			return messages
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("got %d messages, want %d", len(transport.Messages()), n)
+	return nil
+}
+
+func TestMailerEnqueue(t *testing.T) {
+	transport := &MemoryTransport{}
+	m, err := New(config.EmailConfig{From: "no-reply@titannet.io"}, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err = m.Enqueue("user@example.com", model.LanguageEN, TemplateApplicationResult, templateData[TemplateApplicationResult]); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := waitMessages(t, transport, 1)
+	if messages[0].To[0] != "user@example.com" || !strings.Contains(messages[0].Subject, "approved") {
+		t.Errorf("got message to %v subject %q", messages[0].To, messages[0].Subject)
+	}
+}
+
+func TestMailerRetry(t *testing.T) {
+	retryBaseDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+
+	tests := []struct {
+		name       string
+		failures   int
+		maxRetries int
+		delivered  bool
+	}{
+		{"delivered after retries", 2, 3, true},
+		{"dropped after max retries", 5, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &flakyTransport{failures: tt.failures}
+			m, err := New(config.EmailConfig{MaxRetries: tt.maxRetries, Workers: 1}, transport)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = m.Enqueue("user@example.com", model.LanguageEN, TemplateVerifyCode, templateData[TemplateVerifyCode]); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.delivered {
+				waitMessages(t, &transport.MemoryTransport, 1)
+				m.Close()
+				return
+			}
+
+			// let the retries run out before checking nothing is delivered
+			time.Sleep(50 * time.Millisecond)
+			m.Close()
+			if n := len(transport.Messages()); n != 0 {
+				t.Errorf("got %d messages, want 0", n)
+			}
+		})
+	}
+}
+
+// blockingTransport blocks the deliveries until released.
+type blockingTransport struct {
+	MemoryTransport
+	release chan struct{}
+}
+
+func (t *blockingTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	<-t.release
+	return t.MemoryTransport.Send(ctx, msg)
+}
+
+func TestMailerQueueFullAndClose(t *testing.T) {
+	transport := &blockingTransport{release: make(chan struct{})}
+	m, err := New(config.EmailConfig{QueueSize: 1, Workers: 1}, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enqueue := func() error {
+		return m.Enqueue("user@example.com", model.LanguageEN, TemplateVerifyCode, templateData[TemplateVerifyCode])
+	}
+
+	// the first message is taken by the worker, the second one waits in the queue
+	if err = enqueue(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.queue) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err = enqueue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = enqueue(); err != ErrQueueFull {
+		t.Fatalf("got %v, want %v", err, ErrQueueFull)
+	}
+
+	close(transport.release)
+	m.Close()
+
+	if n := len(transport.Messages()); n != 2 {
+		t.Errorf("got %d messages delivered before close, want 2", n)
+	}
+
+	if err = enqueue(); err == nil {
+		t.Error("enqueue after close should fail")
+	}
+}
+
+func TestNewTransportDegrades(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.EmailConfig
+		want Transport
+		err  bool
+	}{
+		{"smtp", config.EmailConfig{SMTPPort: "465"}, &SMTPTransport{Port: 465}, false},
+		{"empty smtp port", config.EmailConfig{}, &DiscardTransport{}, false},
+		{"invalid smtp port", config.EmailConfig{SMTPPort: "smtp"}, &DiscardTransport{}, false},
+		{"file", config.EmailConfig{Transport: TransportFile, FileDir: "mails"}, &FileTransport{Dir: "mails"}, false},
+		{"unknown", config.EmailConfig{Transport: "pigeon"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := newTransport(tt.cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			switch want := tt.want.(type) {
+			case *SMTPTransport:
+				if got, ok := transport.(*SMTPTransport); !ok || got.Port != want.Port {
+					t.Errorf("got %#v, want %#v", transport, want)
+				}
+			case *FileTransport:
+				if got, ok := transport.(*FileTransport); !ok || got.Dir != want.Dir {
+					t.Errorf("got %#v, want %#v", transport, want)
+				}
+			case *DiscardTransport:
+				if _, ok := transport.(*DiscardTransport); !ok {
+					t.Errorf("got %#v, want the discard transport", transport)
+				}
+			}
+		})
+	}
+}
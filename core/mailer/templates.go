@@ -0,0 +1,152 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template is the name of a mail template, each template has an html and a text version per language.
+type Template string
+
+const (
+	TemplateVerifyCode        Template = "verify_code"
+	TemplatePasswordReset     Template = "password_reset"
+	TemplateDeviceOffline     Template = "device_offline"
+	TemplateDeviceAbnormal    Template = "device_abnormal"
+	TemplateDeviceDiskUsage   Template = "device_disk_usage"
+	TemplateWithdrawStatus    Template = "withdraw_status"
+	TemplateApplicationResult Template = "application_result"
+)
+
+var templateNames = []Template{
+	TemplateVerifyCode,
+	TemplatePasswordReset,
+	TemplateDeviceOffline,
+	TemplateDeviceAbnormal,
+	TemplateDeviceDiskUsage,
+	TemplateWithdrawStatus,
+	TemplateApplicationResult,
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+type VerifyCodeData struct {
+	Code   string
+	Digits []string
+}
+
+func NewVerifyCodeData(code string) VerifyCodeData {
+	return VerifyCodeData{Code: code, Digits: strings.Split(code, "")}
+}
+
+type DeviceOfflineData struct {
+	DeviceID string
+	LastSeen string
+}
+
+type DeviceAbnormalData struct {
+	DeviceID string
+	Since    string
+}
+
+type DeviceDiskUsageData struct {
+	DeviceID  string
+	DiskUsage string
+	Threshold string
+}
+
+type WithdrawStatusData struct {
+	Amount    string
+	ToAddress string
+	Status    string
+	Reason    string
+	Hash      string
+}
+
+type ApplicationResultData struct {
+	Num       int32
+	Approved  bool
+	DeviceIDs []string
+	Reason    string
+}
+
+// Rendered is a rendered mail.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type templateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Registry holds the parsed templates, keyed by language and template name.
+type Registry struct {
+	templates map[model.Language]map[Template]*templateSet
+}
+
+// NewRegistry parses the embedded templates of the supported languages.
+func NewRegistry() (*Registry, error) {
+	r := &Registry{templates: make(map[model.Language]map[Template]*templateSet)}
+
+	for _, lang := range model.SupportLanguages {
+		r.templates[lang] = make(map[Template]*templateSet)
+		for _, name := range templateNames {
+			dir := fmt.Sprintf("templates/%s", lang)
+
+			html, err := htmltemplate.ParseFS(templateFS, dir+"/layout.html", fmt.Sprintf("%s/%s.html", dir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			text, err := texttemplate.ParseFS(templateFS, fmt.Sprintf("%s/%s.txt", dir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			r.templates[lang][name] = &templateSet{html: html, text: text}
+		}
+	}
+
+	return r, nil
+}
+
+// Render renders the template in the language, the english templates are used for the unsupported languages.
+func (r *Registry) Render(name Template, lang model.Language, data interface{}) (*Rendered, error) {
+	templates, ok := r.templates[lang]
+	if !ok {
+		templates = r.templates[model.LanguageEN]
+	}
+
+	set, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := set.text.ExecuteTemplate(&text, "body", data); err != nil {
+		return nil, err
+	}
+
+	if err := set.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
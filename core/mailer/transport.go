@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/pkg/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	TransportSMTP   = "smtp"
+	TransportFile   = "file"
+	TransportMemory = "memory"
+)
+
+// Transport delivers the messages, the tests use the memory or file transport instead of SMTP.
+type Transport interface {
+	Send(ctx context.Context, msg *mail.EmailMessage) error
+}
+
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	client := mail.NewEmailClient(t.Host, t.Username, t.Password, t.Port, msg)
+	_, err := client.SendMessage()
+	return err
+}
+
+// FileTransport writes each message to an .eml file in Dir.
+type FileTransport struct {
+	Dir string
+}
+
+func (t *FileTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102150405.000000000"), msg.To[0])
+	return os.WriteFile(filepath.Join(t.Dir, name), data, 0644)
+}
+
+// DiscardTransport drops the messages, it's used when the mails are not configured.
+type DiscardTransport struct{}
+
+func (t *DiscardTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	log.Warnf("mail to %v discarded: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// MemoryTransport keeps the messages in memory.
+type MemoryTransport struct {
+	lk       sync.Mutex
+	messages []*mail.EmailMessage
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, msg *mail.EmailMessage) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.messages = append(t.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (t *MemoryTransport) Messages() []*mail.EmailMessage {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := make([]*mail.EmailMessage, len(t.messages))
+	copy(out, t.messages)
+	return out
+}
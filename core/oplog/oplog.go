@@ -15,6 +15,13 @@ const (
 	loggerOperationTopic        = "operation"
 )
 
+// business types of the operation logs
+const (
+	BusinessTypeOther int32 = iota
+	BusinessTypeGrantRole
+	BusinessTypeRevokeRole
+)
+
 var o *oplog
 
 func init() {
@@ -0,0 +1,192 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"time"
+)
+
+// Policies are the referral policies in effect, a policy pays its percentage of the earnings of the referees
+// to the referrers at its level, the direct referrer is at level 1.
+type Policies []*model.ReferralPolicy
+
+// Load returns the enabled policies.
+func Load(ctx context.Context) (Policies, error) {
+	return dao.ListReferralPolicies(ctx, true)
+}
+
+// Depth returns the deepest level paid by the policies.
+func (ps Policies) Depth() int {
+	var depth int
+	for _, p := range ps {
+		if p.Enabled && p.Level > depth {
+			depth = p.Level
+		}
+	}
+	return depth
+}
+
+// Match returns the policy of the level for a referrer with the number of referees at the time,
+// the campaigns not running at the time are skipped. The policy with the highest priority wins,
+// the highest tier reached wins among the same priority. It returns nil if no policy matches.
+func (ps Policies) Match(level int, referees int64, t time.Time) *model.ReferralPolicy {
+	var matched *model.ReferralPolicy
+	for _, p := range ps {
+		if !p.Enabled || p.Level != level || referees < p.MinReferees {
+			continue
+		}
+
+		if !p.StartAt.IsZero() && t.Before(p.StartAt) {
+			continue
+		}
+
+		if !p.EndAt.IsZero() && !t.Before(p.EndAt) {
+			continue
+		}
+
+		if matched == nil || p.Priority > matched.Priority ||
+			(p.Priority == matched.Priority && p.MinReferees > matched.MinReferees) {
+			matched = p
+		}
+	}
+	return matched
+}
+
+// NextTier returns the policy of the level the referrer reaches with more referees at the time.
+func (ps Policies) NextTier(level int, referees int64, t time.Time) *model.ReferralPolicy {
+	current := ps.Match(level, referees, t)
+
+	var next *model.ReferralPolicy
+	for _, p := range ps {
+		if !p.Enabled || p.Level != level || p.MinReferees <= referees {
+			continue
+		}
+
+		if current != nil && p.Priority < current.Priority {
+			continue
+		}
+
+		if !p.EndAt.IsZero() && !t.Before(p.EndAt) {
+			continue
+		}
+
+		if next == nil || p.MinReferees < next.MinReferees {
+			next = p
+		}
+	}
+	return next
+}
+
+// Reward returns the amount the policy pays for the earning, limited by the cap of the policy.
+func Reward(p *model.ReferralPolicy, earning int64) int64 {
+	if p == nil || earning <= 0 {
+		return 0
+	}
+
+	reward := int64(float64(earning) * p.Percentage / 100)
+	if p.MaxReward > 0 && reward > p.MaxReward {
+		reward = p.MaxReward
+	}
+	return reward
+}
+
+// Payout is the reward paid to a referrer for the earning of a referee.
+type Payout struct {
+	Username string `json:"username"`
+	FromUser string `json:"from_user"`
+	Level    int    `json:"level"`
+	PolicyID int64  `json:"policy_id"`
+	Amount   int64  `json:"amount"`
+}
+
+// Calculator works out the payouts of the earnings, the referrers and the referee counts are cached,
+// so a calculator should only be used for one run.
+type Calculator struct {
+	policies  Policies
+	now       time.Time
+	referrers map[string]*model.User
+	referees  map[string]int64
+}
+
+func NewCalculator(policies Policies, now time.Time) *Calculator {
+	return &Calculator{
+		policies:  policies,
+		now:       now,
+		referrers: make(map[string]*model.User),
+		referees:  make(map[string]int64),
+	}
+}
+
+// Payouts walks up the referral chain of the user as deep as the policies go.
+func (c *Calculator) Payouts(ctx context.Context, username string, earning int64) ([]*Payout, error) {
+	var out []*Payout
+
+	visited := map[string]bool{username: true}
+	current := username
+	for level := 1; level <= c.policies.Depth(); level++ {
+		referrer, err := c.referrer(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+
+		if referrer == nil || visited[referrer.Username] {
+			break
+		}
+		visited[referrer.Username] = true
+		current = referrer.Username
+
+		referees, err := c.refereeCount(ctx, referrer)
+		if err != nil {
+			return nil, err
+		}
+
+		policy := c.policies.Match(level, referees, c.now)
+		amount := Reward(policy, earning)
+		if amount <= 0 {
+			continue
+		}
+
+		out = append(out, &Payout{
+			Username: referrer.Username,
+			FromUser: username,
+			Level:    level,
+			PolicyID: policy.ID,
+			Amount:   amount,
+		})
+	}
+
+	return out, nil
+}
+
+func (c *Calculator) referrer(ctx context.Context, username string) (*model.User, error) {
+	if u, ok := c.referrers[username]; ok {
+		return u, nil
+	}
+
+	u, err := dao.GetUsersReferrer(ctx, username)
+	if errors.Is(err, dao.ErrNoRow) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.referrers[username] = u
+	return u, nil
+}
+
+func (c *Calculator) refereeCount(ctx context.Context, user *model.User) (int64, error) {
+	if n, ok := c.referees[user.Username]; ok {
+		return n, nil
+	}
+
+	n, err := dao.CountReferees(ctx, user.ReferralCode)
+	if err != nil {
+		return 0, err
+	}
+
+	c.referees[user.Username] = n
+	return n, nil
+}
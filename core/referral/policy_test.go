@@ -0,0 +1,245 @@
+package referral
+
+import (
+	"context"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+func testPolicies() Policies {
+	return Policies{
+		{ID: 1, Level: 1, Percentage: 10, Enabled: true},
+		{ID: 2, Level: 1, Percentage: 12, MinReferees: 10, Enabled: true},
+		{ID: 3, Level: 1, Percentage: 15, MinReferees: 50, Enabled: true},
+		{ID: 4, Level: 2, Percentage: 5, Enabled: true},
+		{ID: 5, Level: 1, Percentage: 20, Priority: 1, Enabled: true,
+			StartAt: testNow.AddDate(0, 0, -1), EndAt: testNow.AddDate(0, 0, 1)},
+		{ID: 6, Level: 1, Percentage: 30, Priority: 2, Enabled: true,
+			StartAt: testNow.AddDate(0, 0, 1)},
+		{ID: 7, Level: 1, Percentage: 40, Priority: 3, Enabled: false},
+		{ID: 8, Level: 3, Percentage: 1, Enabled: false},
+	}
+}
+
+func TestPoliciesMatch(t *testing.T) {
+	base := Policies{testPolicies()[0], testPolicies()[1], testPolicies()[2], testPolicies()[3]}
+
+	cases := []struct {
+		name     string
+		policies Policies
+		level    int
+		referees int64
+		t        time.Time
+		want     int64
+	}{
+		{"lowest tier", base, 1, 0, testNow, 1},
+		{"tier reached", base, 1, 10, testNow, 2},
+		{"highest tier reached", base, 1, 75, testNow, 3},
+		{"other level", base, 2, 100, testNow, 4},
+		{"no policy at the level", base, 3, 100, testNow, 0},
+		{"campaign wins by priority", testPolicies(), 1, 75, testNow, 5},
+		{"campaign over at its end", testPolicies(), 1, 75, testNow.AddDate(0, 0, 1), 6},
+		{"campaign not started", testPolicies(), 1, 75, testNow.AddDate(0, 0, -2), 3},
+		{"disabled policy skipped", testPolicies(), 3, 100, testNow, 0},
+		{"empty policies", nil, 1, 100, testNow, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got int64
+			if p := c.policies.Match(c.level, c.referees, c.t); p != nil {
+				got = p.ID
+			}
+			if got != c.want {
+				t.Errorf("Match(%d, %d) = policy %d, want %d", c.level, c.referees, got, c.want)
+			}
+		})
+	}
+}
+
+func TestPoliciesNextTier(t *testing.T) {
+	base := Policies{testPolicies()[0], testPolicies()[1], testPolicies()[2]}
+
+	cases := []struct {
+		name     string
+		referees int64
+		want     int64
+	}{
+		{"next tier from the lowest", 0, 2},
+		{"next tier from the middle", 10, 3},
+		{"highest tier reached", 50, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got int64
+			if p := base.NextTier(1, c.referees, testNow); p != nil {
+				got = p.ID
+			}
+			if got != c.want {
+				t.Errorf("NextTier(1, %d) = policy %d, want %d", c.referees, got, c.want)
+			}
+		})
+	}
+}
+
+func TestPoliciesDepth(t *testing.T) {
+	if got := testPolicies().Depth(); got != 2 {
+		t.Errorf("Depth() = %d, want 2, the disabled level 3 is not paid", got)
+	}
+
+	if got := Policies(nil).Depth(); got != 0 {
+		t.Errorf("Depth() of no policies = %d, want 0", got)
+	}
+}
+
+func TestReward(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  *model.ReferralPolicy
+		earning int64
+		want    int64
+	}{
+		{"percentage", &model.ReferralPolicy{Percentage: 10}, 1000, 100},
+		{"rounded down", &model.ReferralPolicy{Percentage: 10}, 99, 9},
+		{"capped", &model.ReferralPolicy{Percentage: 10, MaxReward: 50}, 1000, 50},
+		{"under the cap", &model.ReferralPolicy{Percentage: 10, MaxReward: 500}, 1000, 100},
+		{"no policy", nil, 1000, 0},
+		{"no earning", &model.ReferralPolicy{Percentage: 10}, 0, 0},
+		{"negative earning", &model.ReferralPolicy{Percentage: 10}, -1000, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Reward(c.policy, c.earning); got != c.want {
+				t.Errorf("Reward() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+// newTestCalculator returns a calculator with the referral chain and the referee counts cached, so no database is
+// queried. The users without a referrer must be in the chain with a nil referrer.
+func newTestCalculator(policies Policies, chain map[string]string, referees map[string]int64) *Calculator {
+	c := NewCalculator(policies, testNow)
+	for username, referrer := range chain {
+		if referrer == "" {
+			c.referrers[username] = nil
+			continue
+		}
+		c.referrers[username] = &model.User{Username: referrer}
+	}
+	for username, n := range referees {
+		c.referees[username] = n
+	}
+	return c
+}
+
+func TestCalculatorPayouts(t *testing.T) {
+	base := Policies{testPolicies()[0], testPolicies()[1], testPolicies()[3]}
+
+	cases := []struct {
+		name     string
+		policies Policies
+		chain    map[string]string
+		referees map[string]int64
+		earning  int64
+		want     []Payout
+	}{
+		{
+			name:     "no referrer",
+			policies: base,
+			chain:    map[string]string{"alice": ""},
+			earning:  1000,
+		},
+		{
+			name:     "two levels",
+			policies: base,
+			chain:    map[string]string{"alice": "bob", "bob": "carol", "carol": ""},
+			referees: map[string]int64{"bob": 1, "carol": 3},
+			earning:  1000,
+			want: []Payout{
+				{Username: "bob", FromUser: "alice", Level: 1, PolicyID: 1, Amount: 100},
+				{Username: "carol", FromUser: "alice", Level: 2, PolicyID: 4, Amount: 50},
+			},
+		},
+		{
+			name:     "tier of the referrer",
+			policies: base,
+			chain:    map[string]string{"alice": "bob", "bob": ""},
+			referees: map[string]int64{"bob": 10},
+			earning:  1000,
+			want: []Payout{
+				{Username: "bob", FromUser: "alice", Level: 1, PolicyID: 2, Amount: 120},
+			},
+		},
+		{
+			name:     "no deeper than the policies",
+			policies: Policies{testPolicies()[0]},
+			chain:    map[string]string{"alice": "bob", "bob": "carol", "carol": ""},
+			referees: map[string]int64{"bob": 1, "carol": 1},
+			earning:  1000,
+			want: []Payout{
+				{Username: "bob", FromUser: "alice", Level: 1, PolicyID: 1, Amount: 100},
+			},
+		},
+		{
+			name:     "cycle stops",
+			policies: base,
+			chain:    map[string]string{"alice": "bob", "bob": "alice"},
+			referees: map[string]int64{"bob": 1, "alice": 1},
+			earning:  1000,
+			want: []Payout{
+				{Username: "bob", FromUser: "alice", Level: 1, PolicyID: 1, Amount: 100},
+			},
+		},
+		{
+			name:     "nothing to pay",
+			policies: base,
+			chain:    map[string]string{"alice": "bob", "bob": "carol", "carol": ""},
+			referees: map[string]int64{"bob": 1, "carol": 1},
+			earning:  5,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			calc := newTestCalculator(c.policies, c.chain, c.referees)
+			got, err := calc.Payouts(context.Background(), "alice", c.earning)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d payouts, want %d", len(got), len(c.want))
+			}
+			for i := range got {
+				if *got[i] != c.want[i] {
+					t.Errorf("payout %d = %+v, want %+v", i, *got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPoliciesWithWithout(t *testing.T) {
+	base := Policies{testPolicies()[0], testPolicies()[1]}
+
+	replaced := base.With(&model.ReferralPolicy{ID: 1, Level: 1, Percentage: 11, Enabled: true})
+	if len(replaced) != 2 || replaced[0].Percentage != 11 || base[0].Percentage != 10 {
+		t.Errorf("With() of an existing id should replace it in a copy")
+	}
+
+	added := base.With(&model.ReferralPolicy{Level: 2, Percentage: 5, Enabled: true})
+	if len(added) != 3 || len(base) != 2 {
+		t.Errorf("With() of a new policy should append it to a copy")
+	}
+
+	removed := base.Without(1)
+	if len(removed) != 1 || removed[0].ID != 2 || len(base) != 2 {
+		t.Errorf("Without() should drop the policy from a copy")
+	}
+}
@@ -0,0 +1,121 @@
+package referral
+
+import (
+	"context"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"sort"
+	"time"
+)
+
+// With returns a copy of the policies with the policy added, or replaced if the id exists.
+func (ps Policies) With(policy *model.ReferralPolicy) Policies {
+	out := make(Policies, 0, len(ps)+1)
+	replaced := false
+	for _, p := range ps {
+		if policy.ID != 0 && p.ID == policy.ID {
+			out = append(out, policy)
+			replaced = true
+			continue
+		}
+		out = append(out, p)
+	}
+
+	if !replaced {
+		out = append(out, policy)
+	}
+	return out
+}
+
+// Without returns a copy of the policies without the policy of the id.
+func (ps Policies) Without(id int64) Policies {
+	out := make(Policies, 0, len(ps))
+	for _, p := range ps {
+		if p.ID != id {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+type LevelImpact struct {
+	Level    int   `json:"level"`
+	Current  int64 `json:"current"`
+	Proposed int64 `json:"proposed"`
+}
+
+// Impact compares the referral rewards of the earnings today under the current and the proposed policies.
+type Impact struct {
+	Current   int64          `json:"current"`
+	Proposed  int64          `json:"proposed"`
+	Delta     int64          `json:"delta"`
+	Referrers int            `json:"referrers"`
+	Levels    []*LevelImpact `json:"levels"`
+}
+
+// Preview works out how much the proposed policies would pay for the earnings today.
+func Preview(ctx context.Context, current, proposed Policies, now time.Time) (*Impact, error) {
+	earnings, err := dao.SumUserDeviceReward(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currentCalc := NewCalculator(current, now)
+	proposedCalc := &Calculator{
+		policies:  proposed,
+		now:       now,
+		referrers: currentCalc.referrers,
+		referees:  currentCalc.referees,
+	}
+
+	levels := make(map[int]*LevelImpact)
+	referrers := make(map[string]int64)
+
+	level := func(l int) *LevelImpact {
+		if _, ok := levels[l]; !ok {
+			levels[l] = &LevelImpact{Level: l}
+		}
+		return levels[l]
+	}
+
+	impact := &Impact{}
+	for username, earning := range earnings {
+		payouts, err := currentCalc.Payouts(ctx, username, earning)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range payouts {
+			impact.Current += p.Amount
+			level(p.Level).Current += p.Amount
+			referrers[p.Username] -= p.Amount
+		}
+
+		payouts, err = proposedCalc.Payouts(ctx, username, earning)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range payouts {
+			impact.Proposed += p.Amount
+			level(p.Level).Proposed += p.Amount
+			referrers[p.Username] += p.Amount
+		}
+	}
+
+	for _, delta := range referrers {
+		if delta != 0 {
+			impact.Referrers++
+		}
+	}
+
+	for _, l := range levels {
+		impact.Levels = append(impact.Levels, l)
+	}
+	sort.Slice(impact.Levels, func(i, j int) bool {
+		return impact.Levels[i].Level < impact.Levels[j].Level
+	})
+
+	impact.Delta = impact.Proposed - impact.Current
+	return impact, nil
+}
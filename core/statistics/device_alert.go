@@ -0,0 +1,167 @@
+package statistics
+
+import (
+	"context"
+	"fmt"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/mailer"
+	"github.com/gnasnik/titan-explorer/core/webhook"
+	"strconv"
+	"time"
+)
+
+// diffDeviceInfo returns the events of the changes of the device since the previous poll, only the status of the
+// offline devices is updated so the other changes are not compared for them.
+func diffDeviceInfo(prev, cur *model.DeviceInfo, now time.Time) []*model.DeviceEvent {
+	if prev == nil {
+		return nil
+	}
+
+	var out []*model.DeviceEvent
+	add := func(event, oldValue, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		out = append(out, &model.DeviceEvent{
+			DeviceID:  cur.DeviceID,
+			UserID:    prev.UserID,
+			Event:     event,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			CreatedAt: now,
+		})
+	}
+
+	add(model.DeviceEventStatus, prev.DeviceStatus, cur.DeviceStatus)
+	if cur.DeviceStatus == DeviceStatusOffline {
+		return out
+	}
+
+	add(model.DeviceEventExternalIP, prev.ExternalIp, cur.ExternalIp)
+	add(model.DeviceEventDiskSpace, strconv.FormatFloat(prev.DiskSpace, 'f', -1, 64), strconv.FormatFloat(cur.DiskSpace, 'f', -1, 64))
+	add(model.DeviceEventVersion, prev.SystemVersion, cur.SystemVersion)
+
+	return out
+}
+
+// alertFiring returns whether the condition of the rule holds for the device.
+func alertFiring(rule *model.DeviceAlertRule, device *model.DeviceInfo, now time.Time) bool {
+	switch rule.Type {
+	case model.DeviceAlertOffline:
+		if device.DeviceStatus != DeviceStatusOffline {
+			return false
+		}
+		return device.UpdatedAt.IsZero() || now.Sub(device.UpdatedAt) >= time.Duration(rule.Threshold*float64(time.Minute))
+	case model.DeviceAlertAbnormal:
+		return device.DeviceStatus == DeviceStatusAbnormal
+	case model.DeviceAlertDiskUsage:
+		return device.DeviceStatus != DeviceStatusOffline && device.DiskUsage > rule.Threshold
+	default:
+		return false
+	}
+}
+
+// checkDeviceAlerts delivers the rules of the devices whose condition starts to hold, a rule fires once until its condition
+// clears. The alerts are queued to the mailer or the webhook dispatcher which retry the delivery, the rules failed to
+// be queued stay armed and are tried again by the next poll.
+func checkDeviceAlerts(ctx context.Context, devices []*model.DeviceInfo) error {
+	deviceMap := make(map[string]*model.DeviceInfo)
+	var deviceIds []string
+	for _, device := range devices {
+		deviceMap[device.DeviceID] = device
+		deviceIds = append(deviceIds, device.DeviceID)
+	}
+
+	rules, err := dao.ListEnabledDeviceAlertRules(ctx, deviceIds)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		device, ok := deviceMap[rule.DeviceID]
+		if !ok {
+			continue
+		}
+
+		firing := alertFiring(rule, device, now)
+		if firing == rule.Triggered {
+			continue
+		}
+
+		if firing {
+			if err = deliverDeviceAlert(ctx, rule, device, now); err != nil {
+				log.Errorf("deliver device alert %d: %v", rule.ID, err)
+				continue
+			}
+		}
+
+		if err = dao.SetDeviceAlertRuleTriggered(ctx, rule.ID, firing, now); err != nil {
+			log.Errorf("set device alert rule triggered: %v", err)
+		}
+	}
+
+	return nil
+}
+
+type deviceAlertPayload struct {
+	RuleID       int64     `json:"rule_id"`
+	DeviceID     string    `json:"device_id"`
+	Type         string    `json:"type"`
+	Threshold    float64   `json:"threshold"`
+	DeviceStatus string    `json:"device_status"`
+	DiskUsage    float64   `json:"disk_usage"`
+	LastSeen     time.Time `json:"last_seen"`
+	TriggeredAt  time.Time `json:"triggered_at"`
+}
+
+func deliverDeviceAlert(ctx context.Context, rule *model.DeviceAlertRule, device *model.DeviceInfo, now time.Time) error {
+	switch rule.Channel {
+	case model.AlertChannelEmail:
+		return sendDeviceAlertEmail(ctx, rule, device, now)
+	case model.AlertChannelWebhook:
+		return webhook.Enqueue(rule.Webhook, &deviceAlertPayload{
+			RuleID:       rule.ID,
+			DeviceID:     device.DeviceID,
+			Type:         rule.Type,
+			Threshold:    rule.Threshold,
+			DeviceStatus: device.DeviceStatus,
+			DiskUsage:    device.DiskUsage,
+			LastSeen:     device.UpdatedAt,
+			TriggeredAt:  now,
+		})
+	default:
+		return fmt.Errorf("unknown alert channel %s", rule.Channel)
+	}
+}
+
+func sendDeviceAlertEmail(ctx context.Context, rule *model.DeviceAlertRule, device *model.DeviceInfo, now time.Time) error {
+	user, err := dao.GetUserByUsername(ctx, rule.UserID)
+	if err != nil {
+		return err
+	}
+
+	if user.UserEmail == "" {
+		return fmt.Errorf("user %s has no email", rule.UserID)
+	}
+
+	switch rule.Type {
+	case model.DeviceAlertOffline:
+		return mailer.Enqueue(user.UserEmail, model.LanguageEN, mailer.TemplateDeviceOffline, mailer.DeviceOfflineData{
+			DeviceID: device.DeviceID,
+			LastSeen: device.UpdatedAt.Format(time.DateTime),
+		})
+	case model.DeviceAlertAbnormal:
+		return mailer.Enqueue(user.UserEmail, model.LanguageEN, mailer.TemplateDeviceAbnormal, mailer.DeviceAbnormalData{
+			DeviceID: device.DeviceID,
+			Since:    now.Format(time.DateTime),
+		})
+	default:
+		return mailer.Enqueue(user.UserEmail, model.LanguageEN, mailer.TemplateDeviceDiskUsage, mailer.DeviceDiskUsageData{
+			DeviceID:  device.DeviceID,
+			DiskUsage: strconv.FormatFloat(device.DiskUsage, 'f', 2, 64),
+			Threshold: strconv.FormatFloat(rule.Threshold, 'f', -1, 64),
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+	"time"
+)
+
+func TestDiffDeviceInfo(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	prev := &model.DeviceInfo{DeviceID: "d1", UserID: "alice", DeviceStatus: DeviceStatusOnline,
+		ExternalIp: "1.1.1.1", DiskSpace: 100, SystemVersion: "0.1.0"}
+
+	cases := []struct {
+		name   string
+		prev   *model.DeviceInfo
+		cur    model.DeviceInfo
+		events map[string][2]string
+	}{
+		{"first poll", nil, *prev, nil},
+		{"unchanged", prev, *prev, nil},
+		{"online to offline", prev,
+			model.DeviceInfo{DeviceID: "d1", DeviceStatus: DeviceStatusOffline},
+			map[string][2]string{model.DeviceEventStatus: {DeviceStatusOnline, DeviceStatusOffline}}},
+		{"changed", prev,
+			model.DeviceInfo{DeviceID: "d1", DeviceStatus: DeviceStatusOnline, ExternalIp: "2.2.2.2", DiskSpace: 100.5, SystemVersion: "0.1.1"},
+			map[string][2]string{
+				model.DeviceEventExternalIP: {"1.1.1.1", "2.2.2.2"},
+				model.DeviceEventDiskSpace:  {"100", "100.5"},
+				model.DeviceEventVersion:    {"0.1.0", "0.1.1"},
+			}},
+		{"abnormal", prev,
+			model.DeviceInfo{DeviceID: "d1", DeviceStatus: DeviceStatusAbnormal, ExternalIp: "1.1.1.1", DiskSpace: 100, SystemVersion: "0.1.0"},
+			map[string][2]string{model.DeviceEventStatus: {DeviceStatusOnline, DeviceStatusAbnormal}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cur := c.cur
+			got := diffDeviceInfo(c.prev, &cur, now)
+			if len(got) != len(c.events) {
+				t.Fatalf("got %d events, want %d", len(got), len(c.events))
+			}
+
+			for _, event := range got {
+				want, ok := c.events[event.Event]
+				if !ok {
+					t.Errorf("unexpected event %s", event.Event)
+					continue
+				}
+				if event.OldValue != want[0] || event.NewValue != want[1] {
+					t.Errorf("%s = %s -> %s, want %s -> %s", event.Event, event.OldValue, event.NewValue, want[0], want[1])
+				}
+				if event.DeviceID != "d1" || event.UserID != "alice" || !event.CreatedAt.Equal(now) {
+					t.Errorf("%s = %+v", event.Event, event)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertFiring(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	offline := &model.DeviceAlertRule{Type: model.DeviceAlertOffline, Threshold: 10}
+	abnormal := &model.DeviceAlertRule{Type: model.DeviceAlertAbnormal}
+	disk := &model.DeviceAlertRule{Type: model.DeviceAlertDiskUsage, Threshold: 90}
+
+	cases := []struct {
+		name   string
+		rule   *model.DeviceAlertRule
+		device *model.DeviceInfo
+		want   bool
+	}{
+		{"online", offline, &model.DeviceInfo{DeviceStatus: DeviceStatusOnline, UpdatedAt: now.Add(-time.Hour)}, false},
+		{"offline for a while", offline, &model.DeviceInfo{DeviceStatus: DeviceStatusOffline, UpdatedAt: now.Add(-10 * time.Minute)}, true},
+		{"offline just now", offline, &model.DeviceInfo{DeviceStatus: DeviceStatusOffline, UpdatedAt: now.Add(-time.Minute)}, false},
+		{"offline since unknown", offline, &model.DeviceInfo{DeviceStatus: DeviceStatusOffline}, true},
+		{"abnormal", abnormal, &model.DeviceInfo{DeviceStatus: DeviceStatusAbnormal}, true},
+		{"not abnormal", abnormal, &model.DeviceInfo{DeviceStatus: DeviceStatusOnline}, false},
+		{"disk full", disk, &model.DeviceInfo{DeviceStatus: DeviceStatusOnline, DiskUsage: 95}, true},
+		{"disk at the threshold", disk, &model.DeviceInfo{DeviceStatus: DeviceStatusOnline, DiskUsage: 90}, false},
+		{"disk of an offline device", disk, &model.DeviceInfo{DeviceStatus: DeviceStatusOffline, DiskUsage: 95}, false},
+		{"unknown rule", &model.DeviceAlertRule{Type: "unknown"}, &model.DeviceInfo{DeviceStatus: DeviceStatusOffline}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := alertFiring(c.rule, c.device, now); got != c.want {
+				t.Errorf("alertFiring() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -24,12 +24,12 @@ type AssertFetcher struct {
 
 // Register the AssertFetcher during initialization
 func init() {
-	RegisterFetcher(newAssertFetcher)
+	RegisterFetcher("assets", newAssertFetcher)
 }
 
 // newAssertFetcher creates a new instance of AssertFetcher.
-func newAssertFetcher() Fetcher {
-	return &AssertFetcher{BaseFetcher: newBaseFetcher()}
+func newAssertFetcher(queueSize int) Fetcher {
+	return &AssertFetcher{BaseFetcher: newBaseFetcher(queueSize)}
 }
 
 // Fetch fetches asset information.
@@ -83,6 +83,8 @@ Loop:
 		log.Errorf("create user info hour: %v", err)
 	}
 
+	addRowsTouched(ctx, int64(len(asserts)))
+
 	if assertsRes.Total > offset {
 		goto Loop
 	}
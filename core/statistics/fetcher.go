@@ -28,15 +28,17 @@ type BaseFetcher struct {
 }
 
 // newBaseFetcher creates a new BaseFetcher instance.
-func newBaseFetcher() BaseFetcher {
-	return BaseFetcher{jobQueue: make(chan Job, 1)}
+func newBaseFetcher(queueSize int) BaseFetcher {
+	return BaseFetcher{jobQueue: make(chan Job, queueSize)}
 }
 
-// Push adds a job to the job queue, respecting the context.
+// Push adds a job to the job queue, respecting the context. The job is attributed to the run of the context.
 func (b BaseFetcher) Push(ctx context.Context, job Job) {
+	job, done := trackJob(ctx, job)
 	select {
 	case b.jobQueue <- job:
 	case <-ctx.Done():
+		done()
 	}
 }
 
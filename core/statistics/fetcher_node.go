@@ -2,6 +2,7 @@ package statistics
 
 import (
 	"context"
+	"errors"
 	"github.com/Filecoin-Titan/titan/api/types"
 	"github.com/gnasnik/titan-explorer/core/geo"
 	"github.com/gnasnik/titan-explorer/pkg/formatter"
@@ -35,12 +36,12 @@ type NodeFetcher struct {
 
 func init() {
 	// Register newNodeFetcher during initialization
-	RegisterFetcher(newNodeFetcher)
+	RegisterFetcher("node", newNodeFetcher)
 }
 
 // newNodeFetcher creates a new NodeFetcher instance
-func newNodeFetcher() Fetcher {
-	return &NodeFetcher{BaseFetcher: newBaseFetcher()}
+func newNodeFetcher(queueSize int) Fetcher {
+	return &NodeFetcher{BaseFetcher: newBaseFetcher(queueSize)}
 }
 
 // Fetch fetches information about all nodes
@@ -70,6 +71,11 @@ loop:
 		offlineNodes []*model.DeviceInfo
 	)
 
+	var deviceIds []string
+	for _, node := range resp.Data {
+		deviceIds = append(deviceIds, node.NodeID)
+	}
+
 	for _, node := range resp.Data {
 		if node.NodeID == "" {
 			continue
@@ -77,12 +83,6 @@ loop:
 
 		nodeInfo := toDeviceInfo(ctx, node)
 		if nodeInfo.DeviceStatus == DeviceStatusOffline {
-			// just update device status
-			err = dao.UpdateDeviceStatus(ctx, nodeInfo)
-			if err != nil {
-				log.Errorf("update device status: %v", err)
-			}
-
 			offlineNodes = append(offlineNodes, nodeInfo)
 			continue
 		}
@@ -98,20 +98,74 @@ loop:
 	log.Infof("handling %d/%d nodes, online: %d offline: %d", total, resp.Total, len(onlineNodes), len(offlineNodes))
 
 	n.Push(ctx, func() error {
-		err := dao.BulkUpsertDeviceInfo(ctx, onlineNodes)
+		// the device info failed to be saved fails the run, the steps after are still done for the rows saved
+		var failed []error
+
+		// the previous rows are read in the queue, after the jobs of the previous polls saved them, and before they are
+		// updated below, the changes are recorded as device events
+		previous, err := dao.GetDeviceInfoByIDs(ctx, deviceIds)
+		if err != nil {
+			log.Errorf("get device info by ids: %v", err)
+		}
+
+		now := time.Now()
+		var events []*model.DeviceEvent
+		for _, nodeInfo := range append(onlineNodes, offlineNodes...) {
+			events = append(events, diffDeviceInfo(previous[nodeInfo.DeviceID], nodeInfo, now)...)
+		}
+
+		for _, nodeInfo := range offlineNodes {
+			// just update device status
+			if err = dao.UpdateDeviceStatus(ctx, nodeInfo); err != nil {
+				log.Errorf("update device status: %v", err)
+			}
+		}
+
+		err = dao.BulkUpsertDeviceInfo(ctx, onlineNodes)
 		if err != nil {
 			log.Errorf("bulk upsert device info: %v", err)
+			failed = append(failed, err)
+		} else {
+			addRowsTouched(ctx, int64(len(onlineNodes)))
 		}
 
 		if err = addDeviceInfoHours(ctx, onlineNodes); err != nil {
 			log.Errorf("add device info hours: %v", err)
+			failed = append(failed, err)
 		}
 
 		err = dao.BulkAddDeviceInfo(ctx, offlineNodes)
 		if err != nil {
 			log.Errorf("bulk add device info: %v", err)
+			failed = append(failed, err)
+		} else {
+			addRowsTouched(ctx, int64(len(offlineNodes)))
 		}
-		return nil
+
+		if err = dao.AddDeviceEvents(ctx, events); err != nil {
+			log.Errorf("add device events: %v", err)
+		}
+
+		if err = checkDeviceAlerts(ctx, append(onlineNodes, offlineNodes...)); err != nil {
+			log.Errorf("check device alerts: %v", err)
+		}
+
+		// the rows are read back as the nodes fetched don't carry the profits and the uptime summed by the other jobs
+		devices, err := dao.GetDeviceInfoByIDs(ctx, deviceIds)
+		if err != nil {
+			log.Errorf("get device info by ids: %v", err)
+			return errors.Join(failed...)
+		}
+
+		var ranked []*model.DeviceInfo
+		for _, device := range devices {
+			ranked = append(ranked, device)
+		}
+
+		if err = dao.UpdateDeviceLeaderboards(ctx, ranked); err != nil {
+			log.Errorf("update device leaderboards: %v", err)
+		}
+		return errors.Join(failed...)
 	})
 
 	if total < resp.Total {
@@ -13,11 +13,11 @@ type StorageFetcher struct {
 
 func init() {
 	// Register newStorageFetcher during initialization
-	RegisterFetcher(newStorageFetcher)
+	RegisterFetcher("storage", newStorageFetcher)
 }
 
-func newStorageFetcher() Fetcher {
-	return &StorageFetcher{BaseFetcher: newBaseFetcher()}
+func newStorageFetcher(queueSize int) Fetcher {
+	return &StorageFetcher{BaseFetcher: newBaseFetcher(queueSize)}
 }
 
 var _ Fetcher = &StorageFetcher{}
@@ -66,5 +66,7 @@ func (c *StorageFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error
 		log.Errorf("failed to create user info hour: %v", err)
 	}
 
+	addRowsTouched(ctx, int64(len(mus)))
+
 	return nil
 }
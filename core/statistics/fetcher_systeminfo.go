@@ -14,11 +14,11 @@ type SystemInfoFetcher struct {
 
 func init() {
 	// Register newSystemInfoFetcher during initialization
-	RegisterFetcher(newSystemInfoFetcher)
+	RegisterFetcher("system_info", newSystemInfoFetcher)
 }
 
-func newSystemInfoFetcher() Fetcher {
-	return &SystemInfoFetcher{BaseFetcher: newBaseFetcher()}
+func newSystemInfoFetcher(queueSize int) Fetcher {
+	return &SystemInfoFetcher{BaseFetcher: newBaseFetcher(queueSize)}
 }
 
 func (s *SystemInfoFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
@@ -51,7 +51,9 @@ func (s *SystemInfoFetcher) Fetch(ctx context.Context, scheduler *Scheduler) err
 			NextElectionTime: respFromValidationInfo.NextElectionTime,
 		}); err != nil {
 			log.Errorf("upsert system info: %v", err)
+			return err
 		}
+		addRowsTouched(ctx, 1)
 		return nil
 	})
 
@@ -0,0 +1,226 @@
+package statistics
+
+import (
+	"context"
+	"errors"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrJobNotFound is returned when triggering a job that is not registered.
+var ErrJobNotFound = errors.New("statistic job not found")
+
+// the stages of the jobs running on the default schedule, a stage starts after the previous one is done.
+const (
+	stageFetch = iota
+	stageSummary
+	stagePost
+	// stageSettle runs after the profits of the devices are summed in stagePost, the settlements read them.
+	stageSettle
+)
+
+// statisticJob is a job that can be scheduled and triggered by name.
+type statisticJob struct {
+	name  string
+	stage int
+	run   func() error
+}
+
+// defaultJobsLockKey is the lock of the jobs running on the default schedule, they run together under one lock.
+const defaultJobsLockKey = "FETCHER"
+
+type runKey struct{}
+
+// jobRun is a run in progress, the run is done when the jobs it queued to the fetcher workers are done.
+type jobRun struct {
+	*model.StatisticRun
+
+	pending sync.WaitGroup
+	lk      sync.Mutex
+	errs    []error
+}
+
+func (r *jobRun) addError(err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (s *Statistic) registerJobs() {
+	for _, fetcher := range s.fetchers {
+		s.jobs = append(s.jobs, statisticJob{name: fetcher.name, stage: stageFetch, run: s.fetchJob(fetcher)})
+	}
+
+	s.jobs = append(s.jobs,
+		statisticJob{name: "sum_device_info_daily", stage: stageSummary, run: s.recordJob("sum_device_info_daily", s.SumDeviceInfoDaily)},
+		statisticJob{name: "sum_device_info_profit", stage: stagePost, run: s.recordJob("sum_device_info_profit", s.SumDeviceInfoProfit)},
+		statisticJob{name: "sum_all_nodes", stage: stagePost, run: s.recordJob("sum_all_nodes", s.SumAllNodes)},
+		statisticJob{name: "sum_device_reliability", stage: stagePost, run: s.recordJob("sum_device_reliability", s.SumDeviceReliability)},
+		statisticJob{name: "claim_user_earning", stage: stageSettle, run: s.recordJob("claim_user_earning", s.ClaimUserEarning)},
+		statisticJob{name: "reconcile_user_reward", stage: stageSettle, run: s.recordJob("reconcile_user_reward", s.ReconcileUserReward)},
+		statisticJob{name: "prune_device_leaderboards", stage: stagePost, run: s.recordJob("prune_device_leaderboards", s.PruneDeviceLeaderboards)},
+	)
+}
+
+// JobNames returns the names of all statistic jobs.
+func (s *Statistic) JobNames() []string {
+	var out []string
+	for _, job := range s.jobs {
+		out = append(out, job.name)
+	}
+	return out
+}
+
+// ownSchedule returns whether the job runs on its own Crontab, the settle jobs always run on the default schedule after
+// the profits are summed and their Crontab is ignored.
+func (s *Statistic) ownSchedule(job statisticJob) bool {
+	return s.cfg.Jobs[job.name].Crontab != "" && job.stage != stageSettle
+}
+
+// lockKey returns the lock the job runs under, the jobs without their own schedule share the lock of the default
+// schedule so a triggered run can't overlap the scheduled one.
+func (s *Statistic) lockKey(job statisticJob) string {
+	if !s.ownSchedule(job) {
+		return defaultJobsLockKey
+	}
+	return job.name
+}
+
+// Trigger runs the job in background, the job will be skipped if it's running on another instance or on schedule.
+func (s *Statistic) Trigger(name string) error {
+	for _, job := range s.jobs {
+		if job.name == name {
+			s.triggered.Add(1)
+			go func(job statisticJob) {
+				defer s.triggered.Done()
+				s.Once(s.lockKey(job), job.run)()
+			}(job)
+			return nil
+		}
+	}
+
+	return ErrJobNotFound
+}
+
+// runJobs runs the jobs stage by stage, the fetch and summary jobs run in order, the post and settle jobs run
+// concurrently within their stage.
+func (s *Statistic) runJobs(jobs []statisticJob) error {
+	for _, stage := range []int{stageFetch, stageSummary, stagePost, stageSettle} {
+		var fns []func() error
+		for _, job := range jobs {
+			if job.stage == stage {
+				fns = append(fns, job.run)
+			}
+		}
+
+		if stage == stagePost || stage == stageSettle {
+			s.asyncExecute(fns)
+			continue
+		}
+
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				log.Errorf("run job: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchJob runs the fetcher for all schedulers concurrently, each scheduler is recorded as a run.
+func (s *Statistic) fetchJob(fetcher namedFetcher) func() error {
+	return func() error {
+		schedulers := s.Schedulers()
+
+		var wg sync.WaitGroup
+		wg.Add(len(schedulers))
+		for _, scheduler := range schedulers {
+			go func(scheduler *Scheduler) {
+				defer wg.Done()
+				err := s.record(fetcher.name, scheduler.Uuid, func(ctx context.Context) error {
+					return fetcher.Fetch(ctx, scheduler)
+				})
+				if err != nil {
+					log.Errorf("run fetcher %s: %v", fetcher.name, err)
+				}
+			}(scheduler)
+		}
+		wg.Wait()
+
+		return nil
+	}
+}
+
+func (s *Statistic) recordJob(name string, fn func() error) func() error {
+	return func() error {
+		return s.record(name, "", func(ctx context.Context) error {
+			return fn()
+		})
+	}
+}
+
+// record runs fn and saves the result to the statistic runs once the jobs queued by fn are done, the errors of the
+// queued jobs are the errors of the run.
+func (s *Statistic) record(job, scheduler string, fn func(ctx context.Context) error) error {
+	run := &jobRun{
+		StatisticRun: &model.StatisticRun{
+			Job:       job,
+			Scheduler: scheduler,
+			StartTime: time.Now(),
+		},
+	}
+
+	err := fn(context.WithValue(s.ctx, runKey{}, run))
+	run.pending.Wait()
+	err = errors.Join(append([]error{err}, run.errs...)...)
+
+	run.EndTime = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+		runErrors.WithLabelValues(job, scheduler).Inc()
+	} else {
+		lastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+
+	runDuration.WithLabelValues(job, scheduler).Observe(run.EndTime.Sub(run.StartTime).Seconds())
+	runRowsTouched.WithLabelValues(job, scheduler).Add(float64(atomic.LoadInt64(&run.RowsTouched)))
+
+	if e := dao.AddStatisticRun(s.ctx, run.StatisticRun); e != nil {
+		log.Errorf("add statistic run: %v", e)
+	}
+
+	return err
+}
+
+// addRowsTouched adds n to the rows touched by the current run.
+func addRowsTouched(ctx context.Context, n int64) {
+	run, ok := ctx.Value(runKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&run.RowsTouched, n)
+}
+
+// trackJob attributes the job queued to the current run, the run waits for the job and takes its error. done must be
+// called if the job is never queued.
+func trackJob(ctx context.Context, job Job) (Job, func()) {
+	run, ok := ctx.Value(runKey{}).(*jobRun)
+	if !ok {
+		return job, func() {}
+	}
+
+	run.pending.Add(1)
+	tracked := func() error {
+		defer run.pending.Done()
+		err := job()
+		if err != nil {
+			run.addError(err)
+		}
+		return err
+	}
+	return tracked, run.pending.Done
+}
@@ -0,0 +1,171 @@
+package statistics
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// useMockDB replaces the database with a mock for the test, the expectations must all be met.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := dao.DB
+	dao.DB = sqlx.NewDb(db, "mysql")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		dao.DB = prev
+		db.Close()
+	})
+
+	return mock
+}
+
+// testFetcher pushes its jobs to the queue on Fetch.
+type testFetcher struct {
+	BaseFetcher
+	jobs []Job
+}
+
+func (f *testFetcher) Fetch(ctx context.Context, scheduler *Scheduler) error {
+	for _, job := range f.jobs {
+		f.Push(ctx, job)
+	}
+	return nil
+}
+
+func jobNames(jobs []statisticJob) []string {
+	var out []string
+	for _, job := range jobs {
+		out = append(out, job.name)
+	}
+	return out
+}
+
+func TestScheduledJobs(t *testing.T) {
+	s := New(config.StatisticsConfig{
+		Crontab: "0 0 * * * *",
+		Jobs: map[string]config.StatisticJobConfig{
+			"sum_all_nodes":          {Crontab: "0 */5 * * * *"},
+			"sum_device_reliability": {Disable: true},
+			"claim_user_earning":     {Crontab: "0 */5 * * * *"},
+			"reconcile_user_reward":  {Crontab: "0 */5 * * * *", Disable: true},
+		},
+	}, nil)
+
+	ownJobs, defaultJobs := s.scheduledJobs()
+	if names := jobNames(ownJobs); !reflect.DeepEqual(names, []string{"sum_all_nodes"}) {
+		t.Errorf("jobs on their own crontab = %v, want [sum_all_nodes]", names)
+	}
+
+	scheduled := make(map[string]bool)
+	for _, name := range jobNames(defaultJobs) {
+		scheduled[name] = true
+	}
+
+	cases := []struct {
+		name      string
+		scheduled bool
+		lockKey   string
+	}{
+		{"sum_device_info_daily", true, defaultJobsLockKey},
+		{"sum_device_info_profit", true, defaultJobsLockKey},
+		{"claim_user_earning", true, defaultJobsLockKey},
+		{"sum_all_nodes", false, "sum_all_nodes"},
+		{"sum_device_reliability", false, defaultJobsLockKey},
+		{"reconcile_user_reward", false, defaultJobsLockKey},
+	}
+
+	for _, c := range cases {
+		if scheduled[c.name] != c.scheduled {
+			t.Errorf("%s on the default schedule = %v, want %v", c.name, scheduled[c.name], c.scheduled)
+		}
+		for _, job := range s.jobs {
+			if job.name == c.name && s.lockKey(job) != c.lockKey {
+				t.Errorf("lockKey(%s) = %s, want %s", c.name, s.lockKey(job), c.lockKey)
+			}
+		}
+	}
+}
+
+func TestRunCronEntries(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     config.StatisticsConfig
+		entries int
+	}{
+		{"default schedule", config.StatisticsConfig{Crontab: "0 0 * * * *"}, 1},
+		{"own crontab", config.StatisticsConfig{Crontab: "0 0 * * * *", Jobs: map[string]config.StatisticJobConfig{
+			"sum_all_nodes":          {Crontab: "0 */5 * * * *"},
+			"sum_device_reliability": {Crontab: "0 */5 * * * *"},
+		}}, 3},
+		{"invalid crontab", config.StatisticsConfig{Crontab: "0 0 * * * *", Jobs: map[string]config.StatisticJobConfig{
+			"sum_all_nodes": {Crontab: "every minute"},
+		}}, 1},
+		{"disabled", config.StatisticsConfig{Disable: true, Crontab: "0 0 * * * *"}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := New(c.cfg, nil)
+			s.Run()
+			if got := len(s.cron.Entries()); got != c.entries {
+				t.Errorf("cron entries = %d, want %d", got, c.entries)
+			}
+			s.Stop()
+		})
+	}
+}
+
+func TestRecordAfterQueuedJobs(t *testing.T) {
+	mock := useMockDB(t)
+
+	gate := make(chan struct{})
+	fetcher := &testFetcher{BaseFetcher: newBaseFetcher(4)}
+	fetcher.jobs = []Job{
+		func() error {
+			<-gate
+			return nil
+		},
+		func() error {
+			return errors.New("boom")
+		},
+	}
+
+	s := New(config.StatisticsConfig{}, []*Scheduler{{Uuid: "s0"}})
+	s.fetchers = []namedFetcher{{Fetcher: fetcher, name: "test", concurrency: 2}}
+	s.handleJobs()
+	defer s.Stop()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO statistic_runs (job, scheduler, start_time, end_time, rows_touched, error, created_at)`)).
+		WithArgs("test", "s0", sqlmock.AnyArg(), sqlmock.AnyArg(), int64(0), "boom").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	done := make(chan struct{})
+	go func() {
+		s.fetchJob(s.fetchers[0])()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		close(gate)
+		t.Fatal("the run was recorded before its queued jobs were done")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(gate)
+	<-done
+}
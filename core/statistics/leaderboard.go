@@ -0,0 +1,25 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"time"
+)
+
+// PruneDeviceLeaderboards takes the devices no longer active or bound out of the leaderboards, the leaderboards are
+// only updated with the devices fetched so the others would stay ranked.
+func (s *Statistic) PruneDeviceLeaderboards() error {
+	log.Info("start to prune device leaderboards")
+	start := time.Now()
+	defer func() {
+		log.Infof("prune device leaderboards done, cost: %v", time.Since(start))
+	}()
+
+	removed, err := dao.PruneDeviceLeaderboards(s.ctx)
+	if err != nil {
+		log.Errorf("prune device leaderboards: %v", err)
+		return err
+	}
+
+	log.Infof("prune device leaderboards: %d devices removed", removed)
+	return nil
+}
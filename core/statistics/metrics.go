@@ -0,0 +1,68 @@
+package statistics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	jobQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "job_queue_depth",
+		Help:      "Number of pending jobs in the fetcher queue.",
+	}, []string{"fetcher"})
+
+	jobLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "job_duration_seconds",
+		Help:      "Time spent handling a job pushed by the fetcher.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"fetcher"})
+)
+
+var (
+	runDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "run_duration_seconds",
+		Help:      "Time spent on a statistic job run, the scheduler is empty for the summary jobs.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"job", "scheduler"})
+
+	runRowsTouched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "rows_touched_total",
+		Help:      "Number of rows written by the statistic job runs.",
+	}, []string{"job", "scheduler"})
+
+	runErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "run_errors_total",
+		Help:      "Number of failed statistic job runs.",
+	}, []string{"job", "scheduler"})
+
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful run of the statistic job, alert on it to find the stalled jobs.",
+	}, []string{"job"})
+
+	lockAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "titan_explorer",
+		Subsystem: "statistics",
+		Name:      "lock_attempts_total",
+		Help:      "Number of attempts obtaining the redis lock of the cron jobs by result: obtained, contended or error.",
+	}, []string{"key", "result"})
+)
+
+var rewardDriftUsers = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "titan_explorer",
+	Subsystem: "statistics",
+	Name:      "reward_drift_users",
+	Help:      "Number of users whose ledger earnings drift from the cumulative profits of their devices in the last reconciliation.",
+})
@@ -0,0 +1,81 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"math"
+	"time"
+)
+
+// reconcileDriftThreshold is the difference ignored between the ledger and the device profits,
+// the earnings are settled as integers while the profits are not.
+const reconcileDriftThreshold = 1.0
+
+// ReconcileUserReward compares the earnings credited by the ledger with the cumulative profits of the devices
+// of each user since the opening of the ledger and records the users drifting apart, one record per user per day.
+func (s *Statistic) ReconcileUserReward() error {
+	earnings, err := dao.SumLedgerEarnings(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	profits, err := dao.SumUserDeviceCumulativeProfit(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	baselines, err := dao.GetRewardReconciliationBaselines(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	drifted := rewardDrifts(earnings, profits, baselines)
+	for _, record := range drifted {
+		record.Time = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		record.CreatedAt = now
+		record.UpdatedAt = now
+	}
+
+	rewardDriftUsers.Set(float64(len(drifted)))
+
+	if len(drifted) > 0 {
+		log.Warnf("reconcile user reward: %d users drift from the device profits", len(drifted))
+	}
+
+	return dao.SaveRewardReconciliations(s.ctx, now, drifted)
+}
+
+// rewardDrifts returns the users whose ledger earnings and device profits moved apart since the baseline.
+func rewardDrifts(earnings map[string]int64, profits map[string]float64, baselines map[string]*model.RewardReconciliationBaseline) []*model.RewardReconciliation {
+	usernames := make(map[string]struct{})
+	for username := range earnings {
+		usernames[username] = struct{}{}
+	}
+	for username := range profits {
+		usernames[username] = struct{}{}
+	}
+
+	var drifted []*model.RewardReconciliation
+	for username := range usernames {
+		var ledgerBase int64
+		var profitBase float64
+		if baseline, ok := baselines[username]; ok {
+			ledgerBase, profitBase = baseline.LedgerAmount, baseline.DeviceProfit
+		}
+
+		drift := (profits[username] - profitBase) - float64(earnings[username]-ledgerBase)
+		if math.Abs(drift) < reconcileDriftThreshold {
+			continue
+		}
+
+		drifted = append(drifted, &model.RewardReconciliation{
+			Username:     username,
+			LedgerAmount: earnings[username],
+			DeviceProfit: profits[username],
+			Drift:        drift,
+		})
+	}
+
+	return drifted
+}
@@ -0,0 +1,54 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+)
+
+func TestRewardDrifts(t *testing.T) {
+	baselines := map[string]*model.RewardReconciliationBaseline{
+		"alice": {Username: "alice", LedgerAmount: 500, DeviceProfit: 800},
+	}
+
+	cases := []struct {
+		name     string
+		earning  int64
+		profit   float64
+		username string
+		drift    float64
+	}{
+		{"in sync", 300, 300, "bob", 0},
+		{"under the threshold", 300, 300.5, "bob", 0},
+		{"ledger behind", 300, 310, "bob", 10},
+		{"ledger ahead", 310, 300, "bob", -10},
+		{"only devices", 0, 42, "bob", 42},
+		{"only ledger", 42, 0, "bob", -42},
+		{"gap of the baseline ignored", 700, 1000, "alice", 0},
+		{"drift since the baseline", 700, 1010, "alice", 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			earnings := map[string]int64{c.username: c.earning}
+			profits := map[string]float64{c.username: c.profit}
+
+			got := rewardDrifts(earnings, profits, baselines)
+			if c.drift == 0 {
+				if len(got) != 0 {
+					t.Fatalf("got %d drifts, want none", len(got))
+				}
+				return
+			}
+
+			if len(got) != 1 {
+				t.Fatalf("got %d drifts, want 1", len(got))
+			}
+			if got[0].Username != c.username || got[0].Drift != c.drift {
+				t.Errorf("drift = %s %v, want %s %v", got[0].Username, got[0].Drift, c.username, c.drift)
+			}
+			if got[0].LedgerAmount != c.earning || got[0].DeviceProfit != c.profit {
+				t.Errorf("amounts = %d %v, want %d %v", got[0].LedgerAmount, got[0].DeviceProfit, c.earning, c.profit)
+			}
+		})
+	}
+}
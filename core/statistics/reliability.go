@@ -0,0 +1,200 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/pkg/formatter"
+	"math"
+	"time"
+)
+
+const (
+	reliabilityDay   = 24 * time.Hour
+	reliabilityWeek  = 7 * reliabilityDay
+	reliabilityMonth = 30 * reliabilityDay
+
+	// the latency in ms below which the latency is not penalized and above which it scores nothing
+	qualityLatencyGood = 100
+	qualityLatencyBad  = 1000
+	// the points taken from the stability for each outage in the month
+	qualityOutagePenalty = 5
+)
+
+type outageStat struct {
+	count   int64
+	total   time.Duration
+	longest time.Duration
+}
+
+func (o *outageStat) add(d time.Duration) {
+	o.count++
+	o.total += d
+	if d > o.longest {
+		o.longest = d
+	}
+}
+
+// deviceOutages returns the outages of the devices from their status at since and their status changes after it,
+// ordered by time. An outage starts when the device goes offline and ends when it's back, the devices offline at since
+// are down from since. The outages not ended yet last until now.
+func deviceOutages(initial map[string]string, events []*model.DeviceEvent, since, now time.Time) map[string]*outageStat {
+	out := make(map[string]*outageStat)
+	down := make(map[string]time.Time)
+
+	for deviceId, status := range initial {
+		out[deviceId] = &outageStat{}
+		if status == DeviceStatusOffline {
+			down[deviceId] = since
+		}
+	}
+
+	for _, event := range events {
+		stat, ok := out[event.DeviceID]
+		if !ok {
+			stat = &outageStat{}
+			out[event.DeviceID] = stat
+		}
+
+		start, isDown := down[event.DeviceID]
+		switch {
+		case event.NewValue == DeviceStatusOffline && event.OldValue != DeviceStatusOffline:
+			if !isDown {
+				down[event.DeviceID] = event.CreatedAt
+			}
+		case event.OldValue == DeviceStatusOffline && event.NewValue != DeviceStatusOffline:
+			// the device was offline before the first status change known
+			if !isDown {
+				start = since
+			}
+			stat.add(event.CreatedAt.Sub(start))
+			delete(down, event.DeviceID)
+		}
+	}
+
+	for deviceId, start := range down {
+		out[deviceId].add(now.Sub(start))
+	}
+
+	return out
+}
+
+// uptimeRatio returns the percentage of the span the device was online, false if the device has no samples to tell.
+func uptimeRatio(uptime *dao.DeviceUptime) (float64, bool) {
+	if uptime == nil || uptime.Span <= 0 {
+		return 0, false
+	}
+	return math.Max(0, math.Min(100, uptime.OnlineTime/uptime.Span*100)), true
+}
+
+// qualityScore weighs the availability of the device over the month and the week with its network quality and the
+// outages of the month, it ranges from 0 to 100. The latency and the packet loss are not penalized when not reported.
+func qualityScore(r *model.DeviceReliability) float64 {
+	availability := 0.7*r.Uptime30d + 0.3*r.Uptime7d
+	loss := 100 * (1 - math.Max(0, math.Min(1, r.PkgLossRatio)))
+
+	latency := 100.0
+	if r.Latency > qualityLatencyGood {
+		latency = 100 * math.Max(0, 1-(r.Latency-qualityLatencyGood)/(qualityLatencyBad-qualityLatencyGood))
+	}
+
+	stability := math.Max(0, 100-float64(r.Outages)*qualityOutagePenalty)
+
+	return formatter.ToFixed(0.6*availability+0.15*loss+0.1*latency+0.15*stability, 2)
+}
+
+// buildDeviceReliability returns the reliability of the devices with samples in the month, the mean time between
+// outages is the time online in the month divided by the outages and zero when there's no outage.
+func buildDeviceReliability(day, now time.Time, daily, weekly, monthly map[string]*dao.DeviceUptime, outages map[string]*outageStat) []*model.DeviceReliability {
+	var out []*model.DeviceReliability
+	for deviceId, uptime := range monthly {
+		uptime30d, ok := uptimeRatio(uptime)
+		if !ok {
+			continue
+		}
+
+		uptime24h, _ := uptimeRatio(daily[deviceId])
+		uptime7d, _ := uptimeRatio(weekly[deviceId])
+
+		r := &model.DeviceReliability{
+			UserID:       uptime.UserID,
+			DeviceID:     deviceId,
+			Time:         day,
+			Uptime24h:    formatter.ToFixed(uptime24h, 2),
+			Uptime7d:     formatter.ToFixed(uptime7d, 2),
+			Uptime30d:    formatter.ToFixed(uptime30d, 2),
+			PkgLossRatio: formatter.ToFixed(uptime.PkgLossRatio, 4),
+			Latency:      formatter.ToFixed(uptime.Latency, 2),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+
+		if outage, ok := outages[deviceId]; ok && outage.count > 0 {
+			r.Outages = outage.count
+			r.OutageDuration = int64(outage.total.Seconds())
+			r.LongestOutage = int64(outage.longest.Seconds())
+			r.Mtbo = int64(uptime30d/100*uptime.Span*60) / outage.count
+		}
+
+		r.QualityScore = qualityScore(r)
+		out = append(out, r)
+	}
+
+	return out
+}
+
+// SumDeviceReliability computes the uptime of the devices over the last day, week and month from device_info_hour,
+// the outages of the month from the status changes and the quality score. The results of a day are overwritten by the
+// later runs of the day and copied to the device info.
+func (s *Statistic) SumDeviceReliability() error {
+	log.Info("start to sum device reliability")
+	start := time.Now()
+	defer func() {
+		log.Infof("sum device reliability done, cost: %v", time.Since(start))
+	}()
+
+	daily, err := dao.SumDeviceUptime(s.ctx, start.Add(-reliabilityDay), start)
+	if err != nil {
+		log.Errorf("sum device uptime: %v", err)
+		return err
+	}
+
+	weekly, err := dao.SumDeviceUptime(s.ctx, start.Add(-reliabilityWeek), start)
+	if err != nil {
+		log.Errorf("sum device uptime: %v", err)
+		return err
+	}
+
+	since := start.Add(-reliabilityMonth)
+	monthly, err := dao.SumDeviceUptime(s.ctx, since, start)
+	if err != nil {
+		log.Errorf("sum device uptime: %v", err)
+		return err
+	}
+
+	initial, err := dao.GetDeviceStatusAt(s.ctx, since)
+	if err != nil {
+		log.Errorf("get device status at: %v", err)
+		return err
+	}
+
+	events, err := dao.GetDeviceStatusEvents(s.ctx, since)
+	if err != nil {
+		log.Errorf("get device status events: %v", err)
+		return err
+	}
+
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	records := buildDeviceReliability(day, start, daily, weekly, monthly, deviceOutages(initial, events, since, start))
+
+	if err = dao.BulkUpsertDeviceReliability(s.ctx, records); err != nil {
+		log.Errorf("upsert device reliability: %v", err)
+		return err
+	}
+
+	if err = dao.UpdateDeviceInfoReliability(s.ctx, day); err != nil {
+		log.Errorf("update device info reliability: %v", err)
+		return err
+	}
+
+	return nil
+}
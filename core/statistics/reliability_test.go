@@ -0,0 +1,171 @@
+package statistics
+
+import (
+	"github.com/gnasnik/titan-explorer/core/dao"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"testing"
+	"time"
+)
+
+func statusEvent(deviceId, oldValue, newValue string, at time.Time) *model.DeviceEvent {
+	return &model.DeviceEvent{DeviceID: deviceId, Event: model.DeviceEventStatus, OldValue: oldValue, NewValue: newValue, CreatedAt: at}
+}
+
+func TestDeviceOutages(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(10 * time.Hour)
+	at := func(hours int) time.Time { return since.Add(time.Duration(hours) * time.Hour) }
+
+	cases := []struct {
+		name    string
+		initial map[string]string
+		events  []*model.DeviceEvent
+		count   int64
+		total   time.Duration
+		longest time.Duration
+	}{
+		{
+			name:    "always online",
+			initial: map[string]string{"d1": DeviceStatusOnline},
+		},
+		{
+			name:    "offline and back",
+			initial: map[string]string{"d1": DeviceStatusOnline},
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOnline, DeviceStatusOffline, at(1)),
+				statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, at(3)),
+				statusEvent("d1", DeviceStatusOnline, DeviceStatusOffline, at(5)),
+				statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, at(6)),
+			},
+			count: 2, total: 3 * time.Hour, longest: 2 * time.Hour,
+		},
+		{
+			name:    "offline until now",
+			initial: map[string]string{"d1": DeviceStatusOnline},
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOnline, DeviceStatusOffline, at(7)),
+			},
+			count: 1, total: 3 * time.Hour, longest: 3 * time.Hour,
+		},
+		{
+			name:    "offline at since",
+			initial: map[string]string{"d1": DeviceStatusOffline},
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, at(2)),
+			},
+			count: 1, total: 2 * time.Hour, longest: 2 * time.Hour,
+		},
+		{
+			name:    "offline the whole window",
+			initial: map[string]string{"d1": DeviceStatusOffline},
+			count:   1, total: 10 * time.Hour, longest: 10 * time.Hour,
+		},
+		{
+			name: "status unknown at since",
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, at(4)),
+			},
+			count: 1, total: 4 * time.Hour, longest: 4 * time.Hour,
+		},
+		{
+			name:    "abnormal is not an outage",
+			initial: map[string]string{"d1": DeviceStatusOnline},
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOnline, DeviceStatusAbnormal, at(1)),
+				statusEvent("d1", DeviceStatusAbnormal, DeviceStatusOnline, at(2)),
+			},
+		},
+		{
+			name:    "offline repeated",
+			initial: map[string]string{"d1": DeviceStatusOnline},
+			events: []*model.DeviceEvent{
+				statusEvent("d1", DeviceStatusOnline, DeviceStatusOffline, at(1)),
+				statusEvent("d1", DeviceStatusAbnormal, DeviceStatusOffline, at(2)),
+				statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, at(4)),
+			},
+			count: 1, total: 3 * time.Hour, longest: 3 * time.Hour,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := deviceOutages(c.initial, c.events, since, now)
+			stat, ok := out["d1"]
+			if !ok {
+				t.Fatal("device missing")
+			}
+			if stat.count != c.count || stat.total != c.total || stat.longest != c.longest {
+				t.Errorf("outages = %d %s %s, want %d %s %s", stat.count, stat.total, stat.longest, c.count, c.total, c.longest)
+			}
+		})
+	}
+}
+
+func TestDeviceOutagesPerDevice(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(10 * time.Hour)
+
+	events := []*model.DeviceEvent{
+		statusEvent("d1", DeviceStatusOnline, DeviceStatusOffline, since.Add(time.Hour)),
+		statusEvent("d2", DeviceStatusOffline, DeviceStatusOnline, since.Add(2*time.Hour)),
+		statusEvent("d1", DeviceStatusOffline, DeviceStatusOnline, since.Add(4*time.Hour)),
+	}
+	initial := map[string]string{"d1": DeviceStatusOnline, "d2": DeviceStatusOffline}
+
+	out := deviceOutages(initial, events, since, now)
+	if got := out["d1"].total; got != 3*time.Hour {
+		t.Errorf("d1 outage = %s, want 3h", got)
+	}
+	if got := out["d2"].total; got != 2*time.Hour {
+		t.Errorf("d2 outage = %s, want 2h", got)
+	}
+}
+
+func TestUptimeRatio(t *testing.T) {
+	cases := []struct {
+		name   string
+		uptime *dao.DeviceUptime
+		want   float64
+		ok     bool
+	}{
+		{"no samples", nil, 0, false},
+		{"no span", &dao.DeviceUptime{OnlineTime: 10}, 0, false},
+		{"half", &dao.DeviceUptime{OnlineTime: 30, Span: 60}, 50, true},
+		{"capped", &dao.DeviceUptime{OnlineTime: 70, Span: 60}, 100, true},
+		{"offline", &dao.DeviceUptime{Span: 60}, 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := uptimeRatio(c.uptime)
+			if got != c.want || ok != c.ok {
+				t.Errorf("uptimeRatio() = %v %v, want %v %v", got, ok, c.want, c.ok)
+			}
+		})
+	}
+}
+
+func TestQualityScore(t *testing.T) {
+	cases := []struct {
+		name string
+		r    *model.DeviceReliability
+		want float64
+	}{
+		{"perfect", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100}, 100},
+		{"good latency", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100, Latency: 100}, 100},
+		{"bad latency", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100, Latency: 1000}, 90},
+		{"half the packets lost", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100, PkgLossRatio: 0.5}, 92.5},
+		{"outages", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100, Outages: 4}, 97},
+		{"outages floored", &model.DeviceReliability{Uptime30d: 100, Uptime7d: 100, Outages: 100}, 85},
+		{"availability", &model.DeviceReliability{Uptime30d: 50, Uptime7d: 100}, 79},
+		{"down", &model.DeviceReliability{PkgLossRatio: 1, Latency: 5000, Outages: 20}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := qualityScore(c.r); got != c.want {
+				t.Errorf("qualityScore() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,11 @@ package statistics
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/gnasnik/titan-explorer/config"
 	"github.com/gnasnik/titan-explorer/core/dao"
 	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"github.com/gnasnik/titan-explorer/core/referral"
 	"github.com/gnasnik/titan-explorer/pkg/formatter"
 	"github.com/golang-module/carbon/v2"
 	errs "github.com/pkg/errors"
@@ -187,11 +187,6 @@ func (s *Statistic) SumDeviceInfoProfit() error {
 		log.Infof("sum device info profit done, cost: %v", time.Since(start))
 	}()
 
-	if err := s.SumDeviceInfoDaily(); err != nil {
-		log.Errorf("sum device info daily: %v", err)
-		return err
-	}
-
 	updatedDevices := make(map[string]*model.DeviceInfo)
 
 	updateDeviceInfoForTimeRange(updatedDevices, carbon.Yesterday(), carbon.Yesterday(), "YesterdayProfit")
@@ -295,83 +290,88 @@ func (s *Statistic) SumAllNodes() error {
 	return nil
 }
 
-func (s *Statistic) UpdateDeviceRank() error {
-	log.Info("start to rank device info")
+// ClaimUserEarning settles the earnings of the users by day, yesterday is settled with the final profits and closed,
+// today is settled with the profits so far and settled again by the next runs. The final profits are read from
+// device_info_daily, which is only summed for the current day, rather than from device_info.yesterday_profit that
+// SumDeviceInfoProfit may not have rolled over yet.
+func (s *Statistic) ClaimUserEarning() error {
+	log.Info("start to claim user earning")
 	start := time.Now()
 	defer func() {
-		log.Infof("rank device info done, cost: %v", time.Since(start))
+		log.Infof("claim user earning done, cost: %v", time.Since(start))
 	}()
-	if err := dao.RankDeviceInfo(s.ctx); err != nil {
-		log.Errorf("ranking device info: %v", err)
-		return err
+
+	today := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+	yesterday := today.AddDate(0, 0, -1)
+	sumYesterday := func(ctx context.Context) (map[string]int64, error) {
+		return dao.SumUserDeviceDailyReward(ctx, yesterday)
 	}
-	return nil
-}
 
-func (s *Statistic) UpdateDeviceLocation() error {
-	log.Info("start to update device location info")
-	start := time.Now()
-	defer func() {
-		log.Infof("update device location done, cost: %v", time.Since(start))
-	}()
-	if err := dao.RankDeviceInfo(s.ctx); err != nil {
-		log.Errorf("ranking device info: %v", err)
+	if err := s.settleUserEarning(yesterday, true, sumYesterday); err != nil {
 		return err
 	}
-	return nil
-}
 
-func (s *Statistic) ClaimUserEarning() error {
-	log.Info("start to claim user earning")
-	start := time.Now()
-	defer func() {
-		log.Infof("claim user earning done, cost: %v", time.Since(start))
-	}()
+	return s.settleUserEarning(today, false, dao.SumUserDeviceReward)
+}
 
-	userRewards, err := dao.SumUserDeviceReward(s.ctx)
+func (s *Statistic) settleUserEarning(day time.Time, final bool, sum func(ctx context.Context) (map[string]int64, error)) error {
+	userRewards, err := sum(s.ctx)
 	if err != nil {
 		log.Errorf("sum user rewards: %v", err)
 		return err
 	}
 
+	// the earnings are settled even if the policies fail to load, only the referral rewards wait for the next run
+	var calculator *referral.Calculator
+	policies, loadErr := referral.Load(s.ctx)
+	if loadErr != nil {
+		log.Errorf("load referral policies: %v", loadErr)
+	} else {
+		calculator = referral.NewCalculator(policies, day)
+	}
+
 	for userId, reward := range userRewards {
-		err := dao.UpdateUserReward(s.ctx, &model.RewardStatement{
+		err := dao.SettleUserReward(s.ctx, day, final, &model.RewardStatement{
 			Username:  userId,
 			FromUser:  userId,
 			Amount:    reward,
 			Event:     model.RewardEventEarning,
 			Status:    1,
-			CreatedAt: time.Now(),
+			CreatedAt: day,
 			UpdatedAt: time.Now(),
 		})
 		if err != nil {
-			log.Errorf("update user reward: %v", err)
+			log.Errorf("settle user reward: %v", err)
+			continue
 		}
 
-		referer, err := dao.GetUsersReferrer(s.ctx, userId)
-		if errors.Is(err, dao.ErrNoRow) {
+		if calculator == nil {
 			continue
 		}
 
+		payouts, err := calculator.Payouts(s.ctx, userId, reward)
 		if err != nil {
-			log.Errorf("get user referer: %v", err)
+			log.Errorf("get referral payouts: %v", err)
 			continue
 		}
 
 		// referral rewards
-		err = dao.UpdateUserReward(s.ctx, &model.RewardStatement{
-			Username:  referer.Username,
-			FromUser:  userId,
-			Amount:    reward * 10 / 100,
-			Event:     model.RewardEventReferrals,
-			Status:    1,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		})
-		if err != nil {
-			log.Errorf("update user reward: %v", err)
+		for _, payout := range payouts {
+			err = dao.SettleUserReward(s.ctx, day, final, &model.RewardStatement{
+				Username:  payout.Username,
+				FromUser:  payout.FromUser,
+				Amount:    payout.Amount,
+				Event:     model.RewardEventReferrals,
+				Status:    1,
+				CreatedAt: day,
+				UpdatedAt: time.Now(),
+			})
+			if err != nil {
+				log.Errorf("settle user reward: %v", err)
+			}
 		}
 	}
 
-	return nil
+	return loadErr
 }
@@ -17,22 +17,50 @@ var log = logging.Logger("statistics")
 const LockerTTL = 30 * time.Second
 const statisticLockerKeyPrefix = "TITAN::STATISTIC"
 
+const (
+	defaultWorkerConcurrency = 2
+	defaultJobQueueSize      = 8
+)
+
+// registeredFetcher is a fetcher constructor with the name of its job.
+type registeredFetcher struct {
+	name string
+	new  func(queueSize int) Fetcher
+}
+
+// namedFetcher is a fetcher with the name of its job.
+type namedFetcher struct {
+	Fetcher
+	name        string
+	concurrency int
+}
+
 // FetcherRegistry to keep track of registered fetchers
-var FetcherRegistry []func() Fetcher
+var FetcherRegistry []registeredFetcher
 
-// RegisterFetcher allows registering new fetchers
-func RegisterFetcher(fetcher func() Fetcher) {
-	FetcherRegistry = append(FetcherRegistry, fetcher)
+// RegisterFetcher allows registering new fetchers, the name is used to configure the schedule of the fetcher.
+func RegisterFetcher(name string, fetcher func(queueSize int) Fetcher) {
+	FetcherRegistry = append(FetcherRegistry, registeredFetcher{name: name, new: fetcher})
 }
 
 // Statistic represents the statistics manager.
 type Statistic struct {
-	ctx        context.Context
-	cfg        config.StatisticsConfig
-	cron       *cron.Cron
-	locker     *redislock.Client
-	fetchers   []Fetcher
+	ctx      context.Context
+	cancel   context.CancelFunc
+	cfg      config.StatisticsConfig
+	cron     *cron.Cron
+	locker   *redislock.Client
+	fetchers []namedFetcher
+	jobs     []statisticJob
+
+	lk         sync.RWMutex
 	schedulers []*Scheduler
+
+	// stopping is closed on Stop, the workers exit after draining their queues.
+	stopping chan struct{}
+	workers  sync.WaitGroup
+	// triggered tracks the jobs triggered manually.
+	triggered sync.WaitGroup
 }
 
 // New creates a new Statistic instance.
@@ -42,19 +70,41 @@ func New(cfg config.StatisticsConfig, scheduler []*Scheduler) *Statistic {
 		cron.WithLocation(time.Local),
 	)
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	s := &Statistic{
-		ctx:        context.Background(),
+		ctx:        ctx,
+		cancel:     cancel,
+		stopping:   make(chan struct{}),
 		cron:       c,
 		cfg:        cfg,
 		schedulers: scheduler,
 		locker:     redislock.New(dao.RedisCache),
-		fetchers:   make([]Fetcher, 0),
+		fetchers:   make([]namedFetcher, 0),
 	}
 
 	for _, fetcher := range FetcherRegistry {
-		s.fetchers = append(s.fetchers, fetcher())
+		jobCfg := cfg.Jobs[fetcher.name]
+
+		concurrency := jobCfg.Concurrency
+		if concurrency <= 0 {
+			concurrency = defaultWorkerConcurrency
+		}
+
+		queueSize := jobCfg.QueueSize
+		if queueSize <= 0 {
+			queueSize = defaultJobQueueSize
+		}
+
+		s.fetchers = append(s.fetchers, namedFetcher{
+			Fetcher:     fetcher.new(queueSize),
+			name:        fetcher.name,
+			concurrency: concurrency,
+		})
 	}
 
+	s.registerJobs()
+
 	return s
 }
 
@@ -63,63 +113,154 @@ func (s *Statistic) Run() {
 	if s.cfg.Disable {
 		return
 	}
-	s.cron.AddFunc(s.cfg.Crontab, s.Once("FETCHER", s.runFetchers))
+
+	ownJobs, defaultJobs := s.scheduledJobs()
+	for _, job := range ownJobs {
+		if _, err := s.cron.AddFunc(s.cfg.Jobs[job.name].Crontab, s.Once(job.name, job.run)); err != nil {
+			log.Errorf("add cron job %s: %v", job.name, err)
+		}
+	}
+
+	if len(defaultJobs) > 0 {
+		s.cron.AddFunc(s.cfg.Crontab, s.Once(defaultJobsLockKey, func() error {
+			return s.runJobs(defaultJobs)
+		}))
+	}
+
 	s.cron.Start()
 	s.handleJobs()
 }
 
+// scheduledJobs splits the enabled jobs into the jobs running on their own crontab and the jobs of the default schedule.
+func (s *Statistic) scheduledJobs() (ownJobs, defaultJobs []statisticJob) {
+	for _, job := range s.jobs {
+		jobCfg := s.cfg.Jobs[job.name]
+		if jobCfg.Disable {
+			continue
+		}
+
+		if !s.ownSchedule(job) {
+			if jobCfg.Crontab != "" {
+				log.Warnf("job %s runs after sum_device_info_profit on the default schedule, its crontab is ignored", job.name)
+			}
+			defaultJobs = append(defaultJobs, job)
+			continue
+		}
+
+		ownJobs = append(ownJobs, job)
+	}
+
+	return ownJobs, defaultJobs
+}
+
+// handleJobs starts the workers of each fetcher, the workers keep running until Stop is called.
 func (s *Statistic) handleJobs() {
 	for _, fetcher := range s.fetchers {
-		go func(f Fetcher) {
+		s.workers.Add(fetcher.concurrency)
+		for i := 0; i < fetcher.concurrency; i++ {
+			go s.worker(fetcher)
+		}
+	}
+}
+
+func (s *Statistic) worker(f namedFetcher) {
+	defer s.workers.Done()
+
+	for {
+		select {
+		case job := <-f.GetJobQueue():
+			s.execute(f, job)
+		case <-s.stopping:
+			// drain the pending jobs before exit
 			for {
 				select {
 				case job := <-f.GetJobQueue():
-					if err := job(); err != nil {
-						log.Errorf("run job: %v", err)
-					}
-				case <-s.ctx.Done():
+					s.execute(f, job)
+				default:
 					return
 				}
 			}
-		}(fetcher)
+		}
 	}
 }
 
-func (s *Statistic) runFetchers() error {
-	var wg sync.WaitGroup
-	wg.Add(len(s.schedulers))
-	for _, scheduler := range s.schedulers {
-		go func(scheduler *Scheduler) {
-			defer wg.Done()
-			for _, fetcher := range s.fetchers {
-				err := fetcher.Fetch(s.ctx, scheduler)
-				if err != nil {
-					log.Errorf("run fetcher: %v", err)
-				}
-			}
-		}(scheduler)
+func (s *Statistic) execute(f namedFetcher, job Job) {
+	jobQueueDepth.WithLabelValues(f.name).Set(float64(len(f.GetJobQueue())))
+
+	start := time.Now()
+	if err := job(); err != nil {
+		log.Errorf("run job: %v", err)
 	}
-	wg.Wait()
+	jobLatency.WithLabelValues(f.name).Observe(time.Since(start).Seconds())
+}
 
-	s.asyncExecute([]func() error{
-		s.SumDeviceInfoProfit,
-		s.SumAllNodes,
-		s.UpdateDeviceRank,
-		s.ClaimUserEarning,
-	})
+// AddScheduler adds a scheduler to the statistics set, the scheduler with the same uuid will be replaced and closed.
+func (s *Statistic) AddScheduler(scheduler *Scheduler) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for i, old := range s.schedulers {
+		if old.Uuid != scheduler.Uuid {
+			continue
+		}
+		s.schedulers[i] = scheduler
+		closeScheduler(old)
+		return
+	}
 
-	return nil
+	s.schedulers = append(s.schedulers, scheduler)
 }
 
-// Stop stops the cron jobs and closes schedulers.
+// RemoveScheduler removes the scheduler from the statistics set and closes it.
+func (s *Statistic) RemoveScheduler(uuid string) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for i, old := range s.schedulers {
+		if old.Uuid != uuid {
+			continue
+		}
+		s.schedulers = append(s.schedulers[:i], s.schedulers[i+1:]...)
+		closeScheduler(old)
+		return
+	}
+}
+
+// Schedulers returns a snapshot of the current schedulers.
+func (s *Statistic) Schedulers() []*Scheduler {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	out := make([]*Scheduler, len(s.schedulers))
+	copy(out, s.schedulers)
+	return out
+}
+
+func closeScheduler(scheduler *Scheduler) {
+	if scheduler.Closer != nil {
+		scheduler.Closer()
+	}
+}
+
+// Stop stops the cron jobs, waits for the pending jobs to be done and closes schedulers.
 func (s *Statistic) Stop() {
 	ctx := s.cron.Stop()
 	select {
 	case <-ctx.Done():
 	}
+
+	s.triggered.Wait()
+	close(s.stopping)
+	s.workers.Wait()
+	s.cancel()
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
 	for _, scheduler := range s.schedulers {
-		scheduler.Closer()
+		closeScheduler(scheduler)
 	}
+	s.schedulers = nil
 }
 
 func (s *Statistic) Once(key string, fn func() error) func() {
@@ -127,15 +268,19 @@ func (s *Statistic) Once(key string, fn func() error) func() {
 		dKey := fmt.Sprintf("%s::%s", statisticLockerKeyPrefix, key)
 		lock, err := s.locker.Obtain(s.ctx, dKey, LockerTTL, nil)
 		if err == redislock.ErrNotObtained {
+			lockAttempts.WithLabelValues(key, "contended").Inc()
 			log.Debugf("%s: %v", dKey, redislock.ErrNotObtained)
 			return
 		}
 
 		if err != nil {
+			lockAttempts.WithLabelValues(key, "error").Inc()
 			log.Errorf("obtain redis lock: %v", err)
 			return
 		}
 
+		lockAttempts.WithLabelValues(key, "obtained").Inc()
+
 		defer lock.Release(s.ctx)
 		if err = fn(); err != nil {
 			log.Errorf("execute cron job: %v", err)
@@ -0,0 +1,110 @@
+package statistics
+
+import (
+	"context"
+	"github.com/gnasnik/titan-explorer/config"
+	"github.com/gnasnik/titan-explorer/core/generated/model"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopDrainsQueues(t *testing.T) {
+	s := New(config.StatisticsConfig{}, nil)
+	fetcher := &testFetcher{BaseFetcher: newBaseFetcher(4)}
+	s.fetchers = []namedFetcher{{Fetcher: fetcher, name: "test", concurrency: 1}}
+	s.handleJobs()
+
+	var executed int32
+	gate := make(chan struct{})
+	fetcher.Push(context.Background(), func() error {
+		<-gate
+		atomic.AddInt32(&executed, 1)
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		fetcher.Push(context.Background(), func() error {
+			atomic.AddInt32(&executed, 1)
+			return nil
+		})
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+
+	// release the worker once it's told to stop, the queued jobs must still run
+	<-s.stopping
+	close(gate)
+	<-stopped
+
+	if n := atomic.LoadInt32(&executed); n != 4 {
+		t.Errorf("executed %d jobs before Stop returned, want 4", n)
+	}
+}
+
+func TestPushBlocksWhenFull(t *testing.T) {
+	fetcher := newBaseFetcher(1)
+	noop := func() error { return nil }
+
+	fetcher.Push(context.Background(), noop)
+
+	pushed := make(chan struct{})
+	go func() {
+		fetcher.Push(context.Background(), noop)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push returned with the queue full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-fetcher.GetJobQueue()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push still blocked after a job was taken from the queue")
+	}
+}
+
+func TestPushCanceled(t *testing.T) {
+	fetcher := newBaseFetcher(1)
+	noop := func() error { return nil }
+
+	run := &jobRun{StatisticRun: &model.StatisticRun{}}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), runKey{}, run))
+
+	fetcher.Push(ctx, noop)
+
+	pushed := make(chan struct{})
+	go func() {
+		fetcher.Push(ctx, noop)
+		close(pushed)
+	}()
+
+	cancel()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push still blocked after the context was canceled")
+	}
+
+	// only the queued job is pending, the run must not wait for the dropped one
+	job := <-fetcher.GetJobQueue()
+	job()
+
+	waited := make(chan struct{})
+	go func() {
+		run.pending.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("the run is waiting for the job dropped on cancel")
+	}
+}
@@ -0,0 +1,285 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var log = logging.Logger("webhook")
+
+const (
+	defaultQueueSize  = 256
+	defaultWorkers    = 2
+	defaultMaxRetries = 5
+	defaultTimeout    = 5 * time.Second
+)
+
+// the delay before retrying a failed delivery, doubled on each retry up to retryMaxDelay
+var (
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+var (
+	ErrQueueFull        = errors.New("webhook queue is full")
+	ErrForbiddenAddress = errors.New("webhook address is not public")
+)
+
+// the shared address space of the carrier grade nats, it's not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+var defaultDispatcher *Dispatcher
+
+type job struct {
+	url      string
+	body     []byte
+	attempts int
+}
+
+// Dispatcher posts the queued payloads to the webhooks, the failed deliveries are retried with exponential backoff.
+type Dispatcher struct {
+	client     *http.Client
+	maxRetries int
+
+	queue   chan *job
+	closing chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// Init creates the default dispatcher, the webhooks are only posted to the public addresses.
+func Init() {
+	SetDefault(New(NewClient()))
+}
+
+// SetDefault replaces the default dispatcher, the previous one is closed.
+func SetDefault(d *Dispatcher) {
+	if defaultDispatcher != nil {
+		defaultDispatcher.Close()
+	}
+	defaultDispatcher = d
+}
+
+// NewClient returns a client refusing to connect to the loopback, private, link-local and the other non-public
+// addresses. The address is checked after it's resolved, so a public host name resolving to a private address is
+// refused as well.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: defaultTimeout,
+		Control: controlPublicAddress,
+	}
+
+	return &http.Client{
+		Timeout: defaultTimeout,
+		Transport: &http.Transport{
+			// no proxy, the address checked must be the one of the webhook
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: defaultTimeout,
+		},
+	}
+}
+
+func controlPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	return !sharedAddressSpace.Contains(ip)
+}
+
+// CheckURL returns an error if the url is not a http or https url, or if its host is a non-public address.
+// The host names are checked when the webhook is posted.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("missing host")
+	}
+
+	if host == "localhost" {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+func New(client *http.Client) *Dispatcher {
+	d := &Dispatcher{
+		client:     client,
+		maxRetries: defaultMaxRetries,
+		queue:      make(chan *job, defaultQueueSize),
+		closing:    make(chan struct{}),
+	}
+
+	d.wg.Add(defaultWorkers)
+	for i := 0; i < defaultWorkers; i++ {
+		go d.worker()
+	}
+
+	return d
+}
+
+// Post sends the body to the webhook right away without retry.
+func (d *Dispatcher) Post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Enqueue encodes the payload as json and queues it for delivery.
+func (d *Dispatcher) Enqueue(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return d.push(&job{url: url, body: body})
+}
+
+func (d *Dispatcher) push(j *job) error {
+	select {
+	case <-d.closing:
+		return errors.New("webhook dispatcher closed")
+	default:
+	}
+
+	select {
+	case d.queue <- j:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case j := <-d.queue:
+			d.deliver(j)
+		case <-d.closing:
+			// deliver the queued payloads once before exit, the failed ones are not retried
+			for {
+				select {
+				case j := <-d.queue:
+					if err := d.Post(context.Background(), j.url, j.body); err != nil {
+						log.Errorf("post webhook %s: %v", j.url, err)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(j *job) {
+	err := d.Post(context.Background(), j.url, j.body)
+	if err == nil {
+		return
+	}
+
+	// the address won't become public by retrying
+	if errors.Is(err, ErrForbiddenAddress) {
+		log.Errorf("post webhook %s: %v", j.url, err)
+		return
+	}
+
+	j.attempts++
+	if j.attempts > d.maxRetries {
+		log.Errorf("post webhook %s failed after %d attempts: %v", j.url, j.attempts, err)
+		return
+	}
+
+	delay := retryDelay(j.attempts)
+	log.Warnf("post webhook %s: %v, retry in %s", j.url, err, delay)
+
+	time.AfterFunc(delay, func() {
+		if err := d.push(j); err != nil {
+			log.Errorf("requeue webhook %s: %v", j.url, err)
+		}
+	})
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay << uint(attempts-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// Close stops the workers after the queued payloads are posted.
+func (d *Dispatcher) Close() {
+	d.once.Do(func() {
+		close(d.closing)
+		d.wg.Wait()
+	})
+}
+
+// Enqueue queues the payload to the default dispatcher.
+func Enqueue(url string, payload interface{}) error {
+	if defaultDispatcher == nil {
+		return fmt.Errorf("webhook dispatcher is not initialized")
+	}
+	return defaultDispatcher.Enqueue(url, payload)
+}
+
+// Close closes the default dispatcher.
+func Close() {
+	if defaultDispatcher != nil {
+		defaultDispatcher.Close()
+	}
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPublicIP(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, c := range cases {
+		if got := publicIP(net.ParseIP(c.ip)); got != c.want {
+			t.Errorf("publicIP(%s) = %v, want %v", c.ip, got, c.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	cases := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://8.8.8.8:8080/hook", true},
+		{"ftp://example.com/hook", false},
+		{"https:///hook", false},
+		{"http://localhost/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]:80/hook", false},
+		{"http://10.0.0.1/hook", false},
+	}
+
+	for _, c := range cases {
+		if err := CheckURL(c.url); (err == nil) != c.ok {
+			t.Errorf("CheckURL(%s) = %v, want ok %v", c.url, err, c.ok)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the loopback webhook is posted")
+	}))
+	defer server.Close()
+
+	d := New(NewClient())
+	defer d.Close()
+
+	err := d.Post(context.Background(), server.URL, []byte(`{}`))
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("post = %v, want %v", err, ErrForbiddenAddress)
+	}
+}
+
+func TestEnqueueRetries(t *testing.T) {
+	base, max := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = time.Millisecond, 10*time.Millisecond
+	defer func() { retryBaseDelay, retryMaxDelay = base, max }()
+
+	var calls int32
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer server.Close()
+
+	d := New(http.DefaultClient)
+	defer d.Close()
+
+	if err := d.Enqueue(server.URL, map[string]string{"device_id": "d1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case body := <-received:
+		if body != `{"device_id":"d1"}` {
+			t.Errorf("body = %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{100, retryMaxDelay},
+	}
+
+	for _, c := range cases {
+		if got := retryDelay(c.attempts); got != c.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", c.attempts, got, c.want)
+		}
+	}
+}
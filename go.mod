@@ -6,12 +6,15 @@ toolchain go1.21.6
 
 require (
 	github.com/Filecoin-Titan/titan v0.0.0-20230414233209-f4fad7df425f
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/Filecoin-Titan/titan-container v0.0.0-20230807102055-6ff1c07eb035
+	github.com/alicebob/miniredis/v2 v2.31.0
 	github.com/appleboy/gin-jwt/v2 v2.9.0
 	github.com/bsm/redislock v0.8.2
 	github.com/docker/go-units v0.5.0
 	github.com/ethereum/go-ethereum v1.13.6
 	github.com/filecoin-project/go-address v1.1.0
+	github.com/filecoin-project/go-jsonrpc v0.3.1
 	github.com/filecoin-project/lotus v1.25.2
 	github.com/filecoin-project/pubsub v1.0.0
 	github.com/gin-gonic/gin v1.9.1
@@ -21,6 +24,7 @@ require (
 	github.com/golang/geo v0.0.0-20230421003525-6adc56603217
 	github.com/ipfs/go-cid v0.4.1
 	github.com/ipfs/go-log/v2 v2.5.1
+	github.com/ipld/go-car v0.6.1
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/libp2p/go-libp2p v0.31.1
 	github.com/mssola/user_agent v0.5.3
@@ -28,11 +32,14 @@ require (
 	github.com/multiformats/go-multihash v0.2.3
 	github.com/oschwald/geoip2-golang v1.7.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.16.0
 	github.com/quic-go/quic-go v0.41.0
 	github.com/robfig/cron/v3 v3.0.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.14.0
+	go.etcd.io/etcd/api/v3 v3.5.9
 	go.etcd.io/etcd/client/pkg/v3 v3.5.9
+	go.etcd.io/etcd/client/v3 v3.5.9
 	golang.org/x/crypto v0.17.0
 	golang.org/x/net v0.18.0
 )
@@ -95,6 +102,7 @@ require (
 	github.com/StackExchange/wmi v1.2.1 // indirect
 	github.com/akavel/rsrc v0.8.0 // indirect
 	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.3.2 // indirect
 	github.com/bytedance/sonic v1.9.1 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
@@ -114,7 +122,6 @@ require (
 	github.com/filecoin-project/go-hamt-ipld v0.1.5 // indirect
 	github.com/filecoin-project/go-hamt-ipld/v2 v2.0.0 // indirect
 	github.com/filecoin-project/go-hamt-ipld/v3 v3.1.0 // indirect
-	github.com/filecoin-project/go-jsonrpc v0.3.1 // indirect
 	github.com/filecoin-project/go-padreader v0.0.1 // indirect
 	github.com/filecoin-project/go-state-types v0.12.8 // indirect
 	github.com/filecoin-project/go-statemachine v1.0.3 // indirect
@@ -162,7 +169,6 @@ require (
 	github.com/ipfs/go-merkledag v0.11.0 // indirect
 	github.com/ipfs/go-metrics-interface v0.0.1 // indirect
 	github.com/ipfs/go-verifcid v0.0.2 // indirect
-	github.com/ipld/go-car v0.6.1 // indirect
 	github.com/ipld/go-codec-dagpb v1.6.0 // indirect
 	github.com/ipld/go-ipld-prime v0.20.0 // indirect
 	github.com/jessevdk/go-flags v1.4.0 // indirect
@@ -197,8 +203,7 @@ require (
 	github.com/whyrusleeping/bencher v0.0.0-20190829221104-bb6607aa8bba // indirect
 	github.com/whyrusleeping/cbor-gen v0.0.0-20230923211252-36a87e1ba72f // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	go.etcd.io/etcd/api/v3 v3.5.9 // indirect
-	go.etcd.io/etcd/client/v3 v3.5.9 // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 	go.opentelemetry.io/otel v1.16.0 // indirect
 	go.opentelemetry.io/otel/metric v1.16.0 // indirect
 	go.opentelemetry.io/otel/trace v1.16.0 // indirect
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 )
 
 var privateIPNets = []string{
@@ -29,6 +30,39 @@ func IsPrivateIP(ip net.IP) bool {
 	return false
 }
 
+// IPAllowed checks the ip matches one of the addresses or the CIDRs in the allow list.
+func IPAllowed(ip string, allowList []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, entry := range allowList {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ipNet.Contains(addr) {
+				return true
+			}
+			continue
+		}
+
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidIPOrCIDR checks the entry is an ip address or a CIDR.
+func ValidIPOrCIDR(entry string) bool {
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return true
+	}
+	return net.ParseIP(entry) != nil
+}
+
+// GetClientIP returns the X-Real-IP header or the remote address of the request.
+//
+// Deprecated: the header is taken from any client and can be spoofed, use GetTrustedClientIP.
 func GetClientIP(r *http.Request) string {
 	reqIP := r.Header.Get("X-Real-IP")
 	if reqIP == "" {
@@ -38,6 +72,39 @@ func GetClientIP(r *http.Request) string {
 	return reqIP
 }
 
+// GetTrustedClientIP returns the remote address of the request, the X-Forwarded-For and the X-Real-IP headers are only
+// taken when the remote address is one of the trusted proxies. The X-Forwarded-For is read from the right, the first
+// address not a trusted proxy is the client.
+func GetTrustedClientIP(r *http.Request, trustedProxies []string) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	if !IPAllowed(remote, trustedProxies) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if i == 0 || !IPAllowed(hop, trustedProxies) {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remote
+}
+
 func GetLocationByIP(ip string) string {
 	if IsPrivateIP(net.ParseIP(ip)) {
 		return "LAN"
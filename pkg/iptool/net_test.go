@@ -0,0 +1,57 @@
+package iptool
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTrustedClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.1", "192.168.0.0/16"}
+
+	cases := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"direct", "8.8.8.8:1234", "", "", "8.8.8.8"},
+		{"spoofed real ip", "8.8.8.8:1234", "", "1.2.3.4", "8.8.8.8"},
+		{"spoofed forwarded for", "8.8.8.8:1234", "1.2.3.4", "", "8.8.8.8"},
+		{"real ip of a trusted proxy", "10.0.0.1:80", "", "1.2.3.4", "1.2.3.4"},
+		{"forwarded for of a trusted proxy", "10.0.0.1:80", "1.2.3.4", "5.6.7.8", "1.2.3.4"},
+		{"forged hop before the client", "10.0.0.1:80", "6.6.6.6, 1.2.3.4", "", "1.2.3.4"},
+		{"trusted hops skipped", "10.0.0.1:80", "1.2.3.4, 192.168.1.1", "", "1.2.3.4"},
+		{"all hops trusted", "10.0.0.1:80", "192.168.1.2, 192.168.1.1", "", "192.168.1.2"},
+		{"invalid hop", "10.0.0.1:80", "1.2.3.4, junk", "", "10.0.0.1"},
+		{"invalid real ip", "10.0.0.1:80", "", "junk", "10.0.0.1"},
+		{"trusted proxy without headers", "192.168.1.1:80", "", "", "192.168.1.1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = c.remote
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			if c.realIP != "" {
+				r.Header.Set("X-Real-IP", c.realIP)
+			}
+
+			if got := GetTrustedClientIP(r, trusted); got != c.want {
+				t.Errorf("GetTrustedClientIP() = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGetTrustedClientIPNoProxy(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Real-IP", "1.2.3.4")
+
+	if got := GetTrustedClientIP(r, nil); got != "127.0.0.1" {
+		t.Errorf("GetTrustedClientIP() = %s, want the remote address without trusted proxies", got)
+	}
+}
@@ -1,8 +1,12 @@
 package mail
 
 import (
+	"bytes"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 )
 
@@ -15,6 +19,8 @@ type EmailMessage struct {
 	Subject     string
 	ContentType string
 	Content     string
+	// TextContent is the plain text alternative of the html Content, optional.
+	TextContent string
 	Attach      string
 }
 
@@ -65,26 +71,67 @@ func NewEmailClient(host, username, password string, port int, message *EmailMes
 // SendMessage 发送邮件
 func (c *EmailClient) SendMessage() (bool, error) {
 	auth := smtp.PlainAuth("", c.Username, c.Password, c.Host)
-	cc := strings.Join(c.Message.Cc, ";")
-	to := strings.Join(c.Message.To, ";")
-	if c.Message.Nickname == "" {
-		c.Message.Nickname = c.Message.From
+	msg, err := c.Message.Bytes()
+	if err != nil {
+		return false, err
 	}
-	from := fmt.Sprintf("%s <%s>", c.Message.Nickname, c.Message.From)
-	msg := []byte("From: " + from + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + c.Message.Subject + "\r\n" +
-		"Cc: " + cc + "\r\n" +
-		"Content-Type: " + c.Message.ContentType + "; charset=UTF-8" + "\r\n" +
-		"\r\n" +
-		c.Message.Content + "\r\n",
-	)
 
 	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
-	err := smtp.SendMail(addr, auth, c.Message.From, c.Message.To, msg)
+	err = smtp.SendMail(addr, auth, c.Message.From, c.Message.To, msg)
 	if err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
+
+// Bytes 返回邮件的原始内容, 同时有 TextContent 时为 multipart/alternative
+func (m *EmailMessage) Bytes() ([]byte, error) {
+	nickname := m.Nickname
+	if nickname == "" {
+		nickname = m.From
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + fmt.Sprintf("%s <%s>", nickname, m.From) + "\r\n")
+	buf.WriteString("To: " + strings.Join(m.To, ";") + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", m.Subject) + "\r\n")
+	buf.WriteString("Cc: " + strings.Join(m.Cc, ";") + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.TextContent == "" {
+		buf.WriteString("Content-Type: " + m.ContentType + "; charset=UTF-8" + "\r\n")
+		buf.WriteString("\r\n" + m.Content + "\r\n")
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", m.TextContent},
+		{m.ContentType, m.Content},
+	}
+
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType + "; charset=UTF-8"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
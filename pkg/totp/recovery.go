@@ -0,0 +1,46 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// recoveryCodeSize is the size of a recovery code in bytes, it's encoded into 8 base32 characters.
+const recoveryCodeSize = 5
+
+// GenerateRecoveryCodes returns n recovery codes shown to the user and their hashes to be saved.
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash of the recovery code, the case, the dash and the spaces around are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// UseRecoveryCode returns the hashes left once the code is used, false if the code is not one of the hashes.
+func UseRecoveryCode(hashes []string, code string) ([]string, bool) {
+	hash := HashRecoveryCode(code)
+	for i, h := range hashes {
+		if h == hash {
+			return append(hashes[:i:i], hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
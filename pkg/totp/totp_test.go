@@ -0,0 +1,113 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the secret of the SHA1 test vectors of RFC 6238 Appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// the codes of Appendix B are 8 digits, the 6 digits codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("time %d: got %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int64
+		ok     bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -1, 0, false},
+		{"previous step", -1, 1, true},
+		{"next step", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := Validate(rfcSecret, code, now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("got %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("got step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+}
+
+func TestUseRecoveryCodeOnce(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 3 || len(hashes) != 3 {
+		t.Fatalf("got %d codes %d hashes, want 3", len(codes), len(hashes))
+	}
+
+	// the code is accepted regardless of the case and the dash
+	remaining, ok := UseRecoveryCode(hashes, " "+strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))+" ")
+	if !ok {
+		t.Fatal("recovery code rejected")
+	}
+	if len(remaining) != 2 || remaining[0] != hashes[0] || remaining[1] != hashes[2] {
+		t.Fatalf("got remaining %v", remaining)
+	}
+
+	if _, ok = UseRecoveryCode(remaining, codes[1]); ok {
+		t.Fatal("recovery code accepted twice")
+	}
+
+	for _, code := range []string{codes[0], codes[2]} {
+		if remaining, ok = UseRecoveryCode(remaining, code); !ok {
+			t.Fatalf("recovery code %s rejected", code)
+		}
+	}
+
+	if len(remaining) != 0 {
+		t.Errorf("got %d codes left, want 0", len(remaining))
+	}
+}
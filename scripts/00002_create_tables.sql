@@ -34,3 +34,254 @@ CREATE TABLE signature (
 `updated_at` DATETIME(3) NOT NULL DEFAULT 0,
 PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+
+DROP TABLE IF EXISTS `statistic_runs`;
+CREATE TABLE statistic_runs (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`job` VARCHAR(64) NOT NULL DEFAULT '',
+`scheduler` VARCHAR(256) NOT NULL DEFAULT '',
+`start_time` DATETIME(3) NOT NULL DEFAULT 0,
+`end_time` DATETIME(3) NOT NULL DEFAULT 0,
+`rows_touched` bigint(20) NOT NULL DEFAULT 0,
+`error` TEXT NOT NULL,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_job` (`job`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `user_totp`;
+CREATE TABLE user_totp (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`secret` VARCHAR(64) NOT NULL DEFAULT '',
+`enabled` TINYINT(1) NOT NULL DEFAULT 0,
+`recovery_codes` TEXT NOT NULL,
+`last_used_step` bigint(20) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `withdraw_audit`;
+CREATE TABLE withdraw_audit (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`withdraw_id` bigint(20) NOT NULL DEFAULT 0,
+`operator` VARCHAR(255) NOT NULL DEFAULT '',
+`from_status` int(1) NOT NULL DEFAULT 0,
+`to_status` int(1) NOT NULL DEFAULT 0,
+`hash` VARCHAR(128) NOT NULL DEFAULT '',
+`reason` VARCHAR(255) NOT NULL DEFAULT '',
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_withdraw_id` (`withdraw_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `referral_policy`;
+CREATE TABLE referral_policy (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`name` VARCHAR(128) NOT NULL DEFAULT '',
+`level` int(11) NOT NULL DEFAULT 1,
+`percentage` DECIMAL(5,2) NOT NULL DEFAULT 0,
+`min_referees` bigint(20) NOT NULL DEFAULT 0,
+`max_reward` bigint(20) NOT NULL DEFAULT 0,
+`invite_reward` bigint(20) NOT NULL DEFAULT 0,
+`bind_reward` bigint(20) NOT NULL DEFAULT 0,
+`priority` int(11) NOT NULL DEFAULT 0,
+`enabled` TINYINT(1) NOT NULL DEFAULT 1,
+`start_at` DATETIME(3) NOT NULL DEFAULT 0,
+`end_at` DATETIME(3) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_level` (`level`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- the default policy keeps paying 10% of the earnings to the direct referrer
+INSERT INTO referral_policy (name, level, percentage, created_at, updated_at) VALUES ('default', 1, 10, now(), now());
+
+DROP TABLE IF EXISTS `reward_ledger`;
+CREATE TABLE reward_ledger (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`tx_id` VARCHAR(128) NOT NULL DEFAULT '',
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`account` VARCHAR(32) NOT NULL DEFAULT '',
+`event` VARCHAR(32) NOT NULL DEFAULT '',
+`amount` bigint(20) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_tx_id` (`tx_id`),
+KEY `idx_username_account` (`username`, `account`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `reward_settlement`;
+CREATE TABLE reward_settlement (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`from_user` VARCHAR(255) NOT NULL DEFAULT '',
+`event` VARCHAR(32) NOT NULL DEFAULT '',
+`period` VARCHAR(16) NOT NULL DEFAULT '',
+`amount` bigint(20) NOT NULL DEFAULT 0,
+`closed` TINYINT(1) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_settlement` (`username`, `period`, `event`, `from_user`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `reward_reconciliation`;
+CREATE TABLE reward_reconciliation (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`time` DATE NOT NULL,
+`ledger_amount` bigint(20) NOT NULL DEFAULT 0,
+`device_profit` DOUBLE NOT NULL DEFAULT 0,
+`drift` DOUBLE NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_username_time` (`username`, `time`),
+KEY `idx_time` (`time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `reward_reconciliation_baseline`;
+CREATE TABLE reward_reconciliation_baseline (
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`ledger_amount` bigint(20) NOT NULL DEFAULT 0,
+`device_profit` DOUBLE NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `user_wallet`;
+CREATE TABLE user_wallet (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`chain` VARCHAR(32) NOT NULL DEFAULT '',
+`address` VARCHAR(128) NOT NULL DEFAULT '',
+`is_primary` TINYINT(1) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_chain_address` (`chain`, `address`),
+KEY `idx_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_events`;
+CREATE TABLE device_events (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`event` VARCHAR(32) NOT NULL DEFAULT '',
+`old_value` VARCHAR(255) NOT NULL DEFAULT '',
+`new_value` VARCHAR(255) NOT NULL DEFAULT '',
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_device_id` (`device_id`, `created_at`),
+KEY `idx_user_id` (`user_id`, `created_at`),
+KEY `idx_event` (`event`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_alert_rule`;
+CREATE TABLE device_alert_rule (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`type` VARCHAR(32) NOT NULL DEFAULT '',
+`threshold` DOUBLE NOT NULL DEFAULT 0,
+`channel` VARCHAR(32) NOT NULL DEFAULT '',
+`webhook` VARCHAR(512) NOT NULL DEFAULT '',
+`enabled` TINYINT(1) NOT NULL DEFAULT 1,
+`triggered` TINYINT(1) NOT NULL DEFAULT 0,
+`triggered_at` DATETIME(3) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_device_id` (`device_id`),
+KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_group`;
+CREATE TABLE device_group (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`name` VARCHAR(64) NOT NULL DEFAULT '',
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_user_name` (`user_id`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_group_member`;
+CREATE TABLE device_group_member (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`group_id` bigint(20) NOT NULL DEFAULT 0,
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_user_device` (`user_id`, `device_id`),
+KEY `idx_group_id` (`group_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_tag`;
+CREATE TABLE device_tag (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`tag` VARCHAR(32) NOT NULL DEFAULT '',
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_user_device_tag` (`user_id`, `device_id`, `tag`),
+KEY `idx_user_tag` (`user_id`, `tag`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_unbind_batch`;
+CREATE TABLE device_unbind_batch (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`username` VARCHAR(255) NOT NULL DEFAULT '',
+`total` bigint(20) NOT NULL DEFAULT 0,
+`undone` TINYINT(1) NOT NULL DEFAULT 0,
+`undone_at` DATETIME(3) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_unbind_item`;
+CREATE TABLE device_unbind_item (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`batch_id` bigint(20) NOT NULL DEFAULT 0,
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`prev_user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`prev_bind_status` CHAR(28) NOT NULL DEFAULT '',
+`prev_bound_at` DATETIME(3) NOT NULL DEFAULT 0,
+`restored` TINYINT(1) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+KEY `idx_batch_id` (`batch_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `device_reliability_daily`;
+CREATE TABLE device_reliability_daily (
+`id` bigint(20) NOT NULL AUTO_INCREMENT,
+`user_id` VARCHAR(255) NOT NULL DEFAULT '',
+`device_id` VARCHAR(128) NOT NULL DEFAULT '',
+`time` DATETIME(3) NOT NULL DEFAULT 0,
+`uptime_24h` FLOAT(32) NOT NULL DEFAULT 0,
+`uptime_7d` FLOAT(32) NOT NULL DEFAULT 0,
+`uptime_30d` FLOAT(32) NOT NULL DEFAULT 0,
+`outages` bigint(20) NOT NULL DEFAULT 0,
+`outage_duration` bigint(20) NOT NULL DEFAULT 0,
+`longest_outage` bigint(20) NOT NULL DEFAULT 0,
+`mtbo` bigint(20) NOT NULL DEFAULT 0,
+`pkg_loss_ratio` FLOAT(32) NOT NULL DEFAULT 0,
+`latency` FLOAT(32) NOT NULL DEFAULT 0,
+`quality_score` FLOAT(32) NOT NULL DEFAULT 0,
+`created_at` DATETIME(3) NOT NULL DEFAULT 0,
+`updated_at` DATETIME(3) NOT NULL DEFAULT 0,
+PRIMARY KEY (`id`),
+UNIQUE KEY `uniq_device_id_time` (`device_id`, `time`),
+KEY `idx_time` (`time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -26,4 +26,67 @@ ALTER TABLE users ADD COLUMN frozen_reward  BIGINT(20) NOT NULL DEFAULT 0 AFTER
 ALTER TABLE users RENAME COLUMN address TO wallet_address;
 
 
-ALTER  TABLE  device_info ADD COLUMN available_profit FLOAT(32) NOT NULL DEFAULT 0 AFTER cumulative_profit;
\ No newline at end of file
+ALTER  TABLE  device_info ADD COLUMN available_profit FLOAT(32) NOT NULL DEFAULT 0 AFTER cumulative_profit;
+
+-- roles: 0 user, 1 admin, 2 operator, 3 read-only
+UPDATE users SET role = 1 WHERE username = 'admin';
+
+-- api key scopes, the existing keys keep the access to all routes of the api key
+ALTER TABLE user_secret ADD COLUMN perms VARCHAR(255) NOT NULL DEFAULT '' AFTER app_secret;
+ALTER TABLE user_secret ADD COLUMN ip_allow_list VARCHAR(1024) NOT NULL DEFAULT '' AFTER perms;
+ALTER TABLE user_secret ADD COLUMN expired_at DATETIME(3) NOT NULL DEFAULT 0 AFTER ip_allow_list;
+ALTER TABLE user_secret ADD COLUMN last_used_at DATETIME(3) NOT NULL DEFAULT 0 AFTER expired_at;
+UPDATE user_secret SET perms = 'fil_storage:write,backup:read,backup:write' WHERE perms = '';
+
+-- withdraw status: 0 pending, 1 approved, 2 broadcast, 3 confirmed, 4 rejected, 5 failed
+ALTER TABLE withdraw_record ADD COLUMN reason VARCHAR(255) NOT NULL DEFAULT '' AFTER status;
+ALTER TABLE withdraw_record ADD KEY idx_status (status);
+
+-- opening balances of the reward ledger, the earnings already recorded in reward_statement are posted apart so the
+-- reconciliation against device_info.cumulative_profit starts from the right amount
+CREATE TABLE ledger_opening AS
+SELECT u.username, u.reward, u.frozen_reward, u.payout, IFNULL(e.amount, 0) AS earning
+FROM users u LEFT JOIN (SELECT username, SUM(amount) AS amount FROM reward_statement WHERE event = 'earning' GROUP BY username) e
+ON e.username = u.username;
+
+INSERT INTO reward_ledger (tx_id, username, account, event, amount, created_at)
+SELECT CONCAT('opening:', username), username, 'reward', 'earning', earning, now(3) FROM ledger_opening WHERE earning <> 0
+UNION ALL
+SELECT CONCAT('opening:', username), username, 'reward', 'opening', reward - earning, now(3) FROM ledger_opening WHERE reward - earning <> 0
+UNION ALL
+SELECT CONCAT('opening:', username), username, 'frozen', 'opening', frozen_reward, now(3) FROM ledger_opening WHERE frozen_reward <> 0
+UNION ALL
+SELECT CONCAT('opening:', username), username, 'payout', 'opening', payout, now(3) FROM ledger_opening WHERE payout <> 0
+UNION ALL
+SELECT CONCAT('opening:', username), '', 'system_earning', 'earning', -earning, now(3) FROM ledger_opening WHERE earning <> 0
+UNION ALL
+SELECT CONCAT('opening:', username), '', 'system_opening', 'opening', -(reward - earning + frozen_reward + payout), now(3) FROM ledger_opening WHERE reward - earning + frozen_reward + payout <> 0;
+
+DROP TABLE ledger_opening;
+
+-- the earnings of today and yesterday are already paid into users.reward through reward_statement, they are settled
+-- with the amounts paid so the first settlements only post the difference. the referral statements were credited to
+-- from_user instead of the referrer, they are left to the settlements.
+INSERT IGNORE INTO reward_settlement (username, from_user, event, period, amount, closed, created_at, updated_at)
+SELECT username, from_user, event, DATE_FORMAT(created_at, '%Y-%m-%d'), SUM(amount), 0, now(3), now(3)
+FROM reward_statement WHERE event = 'earning' AND created_at >= CURDATE() - INTERVAL 1 DAY
+GROUP BY username, from_user, event, DATE_FORMAT(created_at, '%Y-%m-%d');
+
+-- the device profits earned before reward_statement existed are not in the ledger, the reconciliation only reports the
+-- drift since the opening
+INSERT INTO reward_reconciliation_baseline (username, ledger_amount, device_profit, created_at)
+SELECT username, SUM(ledger_amount), SUM(device_profit), now(3) FROM (
+SELECT user_id AS username, 0 AS ledger_amount, cumulative_profit AS device_profit FROM device_info WHERE user_id <> ''
+UNION ALL
+SELECT username, amount, 0 FROM reward_ledger WHERE account = 'reward' AND event = 'earning' AND username <> ''
+) b GROUP BY username;
+
+-- the wallets bound before are evm wallets, users.wallet_address keeps the primary payout address
+INSERT IGNORE INTO user_wallet (username, chain, address, is_primary, created_at, updated_at)
+SELECT username, 'evm', wallet_address, 1, now(3), now(3) FROM users WHERE wallet_address <> '';
+
+-- reliability of the devices, updated from device_reliability_daily
+ALTER TABLE device_info ADD COLUMN uptime_24h FLOAT(32) NOT NULL DEFAULT 0;
+ALTER TABLE device_info ADD COLUMN uptime_7d FLOAT(32) NOT NULL DEFAULT 0;
+ALTER TABLE device_info ADD COLUMN uptime_30d FLOAT(32) NOT NULL DEFAULT 0;
+ALTER TABLE device_info ADD COLUMN quality_score FLOAT(32) NOT NULL DEFAULT 0;